@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	mode := fs.String("mode", string(internal.ModeComparison), "recognizer to evaluate: comparison, classifier or ocr")
+	out := fs.String("out", "", "write the full results as JSON to this file")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: grid-reader bench [-mode comparison] [-out results.json] <dir>")
+		fmt.Fprintln(fs.Output(), "dir holds one directory per grid, each with a grid.png and truth.json")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	recognizer, err := internal.ParseMode(*mode)
+	if err != nil {
+		return err
+	}
+
+	worker := internal.NewGridWorker()
+	worker.Start()
+
+	e, err := internal.Evaluate(fs.Arg(0), recognizer, worker)
+	if err != nil {
+		return err
+	}
+
+	for _, g := range e.PerGrid {
+		if g.Error != "" {
+			fmt.Printf("%s: failed in %.0fms: %s\n", g.Name, g.LatencyMs, g.Error)
+			continue
+		}
+		fmt.Printf("%s: %d/%d cells correct in %.0fms\n", g.Name, g.CorrectCells, g.Cells, g.LatencyMs)
+	}
+
+	fmt.Println()
+	fmt.Printf("grids: %d (%d failed), grid accuracy %.2f%%, cell accuracy %.2f%%\n",
+		e.Grids, e.GridsFailed, e.GridAccuracy*100, e.CellAccuracy*100)
+	for _, t := range []internal.CellType{internal.CellTypeValue, internal.CellTypePlaceholders, internal.CellTypeEmpty} {
+		pr := e.CellTypes[t]
+		fmt.Printf("%-13s precision %.2f%%, recall %.2f%%\n", t, pr.Precision*100, pr.Recall*100)
+	}
+	fmt.Printf("placeholder exact match %.2f%% of %d cells\n", e.PlaceholderExactMatch*100, e.PlaceholderCells)
+	fmt.Printf("latency mean %.0fms, p50 %.0fms, p95 %.0fms, max %.0fms\n",
+		e.Latency.MeanMs, e.Latency.P50Ms, e.Latency.P95Ms, e.Latency.MaxMs)
+
+	fmt.Println()
+	fmt.Println("digit confusion (rows truth, columns predicted, - is not a value)")
+	fmt.Printf("%5s%5s", "", "-")
+	for p := 1; p <= 9; p++ {
+		fmt.Printf("%5d", p)
+	}
+	fmt.Println()
+	for t, row := range e.DigitConfusion {
+		if t == 0 {
+			fmt.Printf("%5s", "-")
+		} else {
+			fmt.Printf("%5d", t)
+		}
+		for _, count := range row {
+			fmt.Printf("%5d", count)
+		}
+		fmt.Println()
+	}
+
+	if *out != "" {
+		b, err := json.MarshalIndent(e, "", "  ")
+		if err != nil {
+			return fmt.Errorf("marshalling results: %v", err)
+		}
+
+		if err := os.WriteFile(*out, b, 0644); err != nil {
+			return fmt.Errorf("writing results: %v", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runDebug(args []string) error {
+	fs := flag.NewFlagSet("debug", flag.ContinueOnError)
+	out := fs.String("out", "debug", "directory to write the stage images to")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: grid-reader debug [-out debug] <file>")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	p := fs.Arg(0)
+
+	img, err := internal.LoadImage(p)
+	if err != nil {
+		return err
+	}
+
+	worker := internal.NewGridWorker()
+	worker.Start()
+
+	bundle := internal.NewDebugBundle()
+	grid, err := internal.ReadGrid(img, filepath.Base(p), worker, internal.ReadOptions{Debug: bundle})
+	if err != nil {
+		// still write whatever stages were collected before failing
+		if writeErr := bundle.WriteDir(*out); writeErr != nil {
+			return fmt.Errorf("writing debug files: %v", writeErr)
+		}
+		return err
+	}
+
+	result, err := grid.Encode(internal.FormatJSON)
+	if err != nil {
+		return err
+	}
+	bundle.Add("result.json", result)
+
+	overlay, err := grid.DebugOverlay()
+	if err != nil {
+		return err
+	}
+	bundle.Add("overlay.png", overlay)
+
+	if err := bundle.WriteDir(*out); err != nil {
+		return fmt.Errorf("writing debug files: %v", err)
+	}
+
+	fmt.Printf("wrote debug files to %s\n", *out)
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runDiff(args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ContinueOnError)
+	modeName := fs.String("mode", string(internal.ModeComparison), "recognizer: comparison, classifier or ocr")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: grid-reader diff [-mode comparison] <before> <after>")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args, 2); err != nil {
+		return err
+	}
+
+	mode, err := internal.ParseMode(*modeName)
+	if err != nil {
+		return err
+	}
+
+	worker := internal.NewGridWorker()
+	worker.Start()
+
+	var grids []*internal.Grid
+	for _, p := range fs.Args() {
+		img, err := internal.LoadImage(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+
+		grid, err := internal.ReadGrid(img, filepath.Base(p), worker, internal.ReadOptions{Mode: mode})
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+		grids = append(grids, grid)
+	}
+
+	diff, err := internal.CompareGrids(grids[0], grids[1])
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(b)
+	fmt.Println()
+
+	return nil
+}
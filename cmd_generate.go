@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runGenerate(args []string) error {
+	defaults := internal.DefaultGenerateOptions()
+
+	fs := flag.NewFlagSet("generate", flag.ContinueOnError)
+	n := fs.Int("n", 100, "number of grids to generate")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "random seed, set it to reproduce a corpus")
+	style := fs.String("style", "", "nyt or sudokucom, mixed when empty")
+	minCell := fs.Int("min-cell", defaults.MinCellWidth, "smallest cell width in pixels")
+	maxCell := fs.Int("max-cell", defaults.MaxCellWidth, "largest cell width in pixels")
+	pencilMarks := fs.Float64("pencil-marks", defaults.PencilMarkRate, "chance of an empty cell holding pencil marks")
+	entered := fs.Float64("entered", defaults.EnteredRate, "chance of an empty cell holding a player entered digit")
+	highlights := fs.Float64("highlights", defaults.HighlightRate, "chance of a grid having highlighted cells")
+	jpeg := fs.Float64("jpeg", defaults.JPEGRate, "chance of a grid being re-encoded as a jpeg")
+	rotation := fs.Float64("max-rotation", defaults.MaxRotation, "rotate grids by up to this many degrees either way")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: grid-reader generate [flags] <dir>")
+		fmt.Fprintln(fs.Output(), "writes numbered directories each holding a grid.png and truth.json")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	if *minCell > *maxCell {
+		return fmt.Errorf("min-cell must not be larger than max-cell")
+	}
+
+	opts := internal.GenerateOptions{
+		Style:          internal.Style(*style),
+		MinCellWidth:   *minCell,
+		MaxCellWidth:   *maxCell,
+		PencilMarkRate: *pencilMarks,
+		EnteredRate:    *entered,
+		HighlightRate:  *highlights,
+		JPEGRate:       *jpeg,
+		MaxRotation:    *rotation,
+	}
+
+	if err := internal.WriteSyntheticCorpus(fs.Arg(0), *n, *seed, opts); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %d grids to %s (seed %d)\n", *n, fs.Arg(0), *seed)
+
+	return nil
+}
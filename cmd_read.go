@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runRead(args []string) error {
+	fs := flag.NewFlagSet("read", flag.ContinueOnError)
+	formatName := fs.String("format", string(internal.FormatJSON), "output format: json, line, sdk, hodoku, sudoku-exchange, pretty or fpuzzles")
+	modeName := fs.String("mode", string(internal.ModeComparison), "recognizer: comparison, classifier or ocr")
+	multiple := fs.Bool("multiple", false, "read every grid in each image (i.e. a newspaper page) rather than one")
+	orient := fs.String("orient", "", "auto to search for the orientation of photos without EXIF, reading each grid up to four times")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: grid-reader read [-format json] [-mode comparison] [-multiple] [-orient auto] <file...>")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args, -1); err != nil {
+		return err
+	}
+
+	format, err := internal.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+
+	mode, err := internal.ParseMode(*modeName)
+	if err != nil {
+		return err
+	}
+
+	if *orient != "" && *orient != "auto" {
+		return fmt.Errorf("unsupported orient %q, expected auto", *orient)
+	}
+	opts := internal.ReadOptions{Mode: mode, AutoOrient: *orient == "auto"}
+
+	worker := internal.NewGridWorker()
+	worker.Start()
+
+	for _, p := range fs.Args() {
+		img, err := internal.LoadImage(p)
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+
+		var grids []*internal.Grid
+		if *multiple {
+			grids, err = internal.ReadGrids(img, filepath.Base(p), worker, opts)
+		} else {
+			var grid *internal.Grid
+			grid, err = internal.ReadGrid(img, filepath.Base(p), worker, opts)
+			grids = append(grids, grid)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", p, err)
+		}
+
+		for _, grid := range grids {
+			b, err := grid.Encode(format)
+			if err != nil {
+				return fmt.Errorf("%s: %v", p, err)
+			}
+
+			os.Stdout.Write(b)
+			if format == internal.FormatJSON || format == internal.FormatSudokuExchange || format == internal.FormatFPuzzles {
+				fmt.Println()
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"flag"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runServe(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	if err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	server := internal.NewSudokuServer()
+	server.Start(*addr)
+
+	return nil
+}
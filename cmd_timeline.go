@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runTimeline(args []string) error {
+	fs := flag.NewFlagSet("timeline", flag.ContinueOnError)
+	modeName := fs.String("mode", string(internal.ModeComparison), "recognizer: comparison, classifier or ocr")
+	interval := fs.Duration("interval", time.Second, "how long each screenshot in a directory is shown for")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: grid-reader timeline [-mode comparison] [-interval 1s] <dir|file>")
+		fmt.Fprintln(fs.Output(), "reads a directory of screenshots, or an animated GIF or APNG, as frames of a recording")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+	p := fs.Arg(0)
+
+	mode, err := internal.ParseMode(*modeName)
+	if err != nil {
+		return err
+	}
+
+	worker := internal.NewGridWorker()
+	worker.Start()
+
+	reader := internal.NewTimelineReader(filepath.Base(p), worker, internal.ReadOptions{Mode: mode})
+	if err := internal.LoadFrames(p, *interval, reader.Add); err != nil {
+		return fmt.Errorf("%s: %v", p, err)
+	}
+
+	timeline, err := reader.Timeline()
+	if err != nil {
+		return fmt.Errorf("%s: %v", p, err)
+	}
+
+	b, err := json.MarshalIndent(timeline, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	os.Stdout.Write(b)
+	fmt.Println()
+
+	return nil
+}
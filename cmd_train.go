@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/korziee/grid-reader/internal"
+)
+
+func runTrain(args []string) error {
+	fs := flag.NewFlagSet("train", flag.ContinueOnError)
+	out := fs.String("out", "templates", "directory to write t-values and t-placeholders to")
+	maxSamples := fs.Int("max-samples", 50, "most instances of a digit compared when picking its templates, or kept in the classifier")
+	perDigit := fs.Int("k", 1, "templates to write per digit, the medoid then the most distinct instances")
+	source := fs.String("source", "", "write the templates into a subdirectory for this source, i.e. the app or theme")
+	classifier := fs.String("classifier", "", "write a classifier model to this file instead of templates")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "usage: grid-reader train [-out templates] [-k 1] [-source name] [-classifier model.json] <dir>")
+		fmt.Fprintln(fs.Output(), "dir holds one directory per labelled grid, each with a grid.png and truth.json")
+		fmt.Fprintln(fs.Output(), "run the reader with TEMPLATES_DIR set to the output directory to use the templates,")
+		fmt.Fprintln(fs.Output(), "or with CLASSIFIER_PATH set to the model and -mode classifier to use the classifier")
+		fs.PrintDefaults()
+	}
+	if err := parseArgs(fs, args, 1); err != nil {
+		return err
+	}
+
+	if *maxSamples < 1 || *perDigit < 1 {
+		return fmt.Errorf("max-samples and k must be at least 1")
+	}
+
+	opts := internal.TrainOptions{
+		MaxSamples: *maxSamples,
+		PerDigit:   *perDigit,
+		Source:     *source,
+	}
+
+	if *classifier != "" {
+		report, err := internal.TrainClassifier(fs.Arg(0), *classifier, opts)
+		if err != nil {
+			return err
+		}
+
+		for idx := range report.Values {
+			// the values of larger grids are only listed when the corpus has them
+			if idx >= 9 && report.Values[idx] == 0 && report.Placeholders[idx] == 0 {
+				continue
+			}
+			fmt.Printf("%s: %d value instances, %d placeholder instances\n", internal.Symbol(idx+1), report.Values[idx], report.Placeholders[idx])
+		}
+
+		return nil
+	}
+
+	report, err := internal.Train(fs.Arg(0), *out, opts)
+	if err != nil {
+		return err
+	}
+
+	for idx := range report.Values {
+		if idx >= 9 && report.Values[idx] == 0 && report.Placeholders[idx] == 0 {
+			continue
+		}
+		fmt.Printf("%s: %d value instances, %d placeholder instances\n", internal.Symbol(idx+1), report.Values[idx], report.Placeholders[idx])
+		if idx < 9 && (report.Values[idx] == 0 || report.Placeholders[idx] == 0) {
+			fmt.Printf("   warning: no template written for some of digit %d, the set in %s is incomplete\n", idx+1, *out)
+		}
+	}
+
+	return nil
+}
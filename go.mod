@@ -4,6 +4,7 @@ go 1.23
 
 require (
 	github.com/joho/godotenv v1.5.1
+	golang.org/x/image v0.25.0
 	gopkg.in/gographics/imagick.v3 v3.7.1
 )
 
@@ -11,6 +12,7 @@ require (
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/vitali-fedulov/images4 v1.3.1 // indirect
 	gocv.io/x/gocv v0.39.0 // indirect
+	golang.org/x/text v0.23.0 // indirect
 )
 
 require (
@@ -2,34 +2,106 @@ package internal
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
 	"io"
+	"mime"
 	"net/http"
-
-	_ "image/png"
+	"net/url"
+	"path"
+	"strings"
+	"time"
 )
 
 type SudokuServer struct {
-	worker *GridWorker
+	worker  *GridWorker
+	fetcher *imageFetcher
 }
 
 func (s *SudokuServer) pong(w http.ResponseWriter, req *http.Request) {
 	w.Write([]byte("pong\n"))
 }
 
-func (s *SudokuServer) readGrid(w http.ResponseWriter, req *http.Request) {
+// imageRequest is the json body of a request for bots that have an image as
+// a url or a base64 string rather than a file, it holds one of them
+type imageRequest struct {
+	// the image base64 encoded, optionally as a data url
+	// (data:image/png;base64,...)
+	ImageBase64 string `json:"image_base64"`
+	// fetched when its host is allowed, see imageFetcher
+	ImageURL string `json:"image_url"`
+	// names the grid, defaults to the file name in image_url or "image"
+	Name string `json:"name"`
+}
+
+// reads the image in the request, the recognizer in ?mode= and ?orient=auto
+// to search for the grid's orientation. The image is uploaded in the
+// multipart "file" field, or given in a json body (see imageRequest) when the
+// content type is application/json. An error response has already been
+// written when ok is false.
+func (s *SudokuServer) imageFromRequest(w http.ResponseWriter, req *http.Request) (img image.Image, name string, opts ReadOptions, ok bool) {
+	opts, err := readOptions(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", opts, false
+	}
+
+	var b []byte
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); mediaType == "application/json" {
+		b, name, ok = s.imageFromJSON(w, req)
+	} else {
+		b, name, ok = imageFromMultipart(w, req, "file")
+	}
+	if !ok {
+		return nil, "", opts, false
+	}
+
+	img, err = DecodeImage(b)
+	if err != nil {
+		Logger.Error("failed to decode image", "grid_id", name, "error", err)
+		http.Error(w, "unable to decode provided image", http.StatusInternalServerError)
+		return nil, "", opts, false
+	}
+
+	return img, name, opts, true
+}
+
+// the recognizer in ?mode=, and ?orient=auto to search for the grid's
+// orientation
+func readOptions(req *http.Request) (ReadOptions, error) {
+	mode, err := ParseMode(req.URL.Query().Get("mode"))
+	if err != nil {
+		return ReadOptions{}, err
+	}
+	opts := ReadOptions{Mode: mode}
+
+	switch orient := req.URL.Query().Get("orient"); orient {
+	case "":
+	case "auto":
+		opts.AutoOrient = true
+	default:
+		return ReadOptions{}, fmt.Errorf("unsupported orient %q, expected auto", orient)
+	}
+
+	return opts, nil
+}
+
+// reads the file uploaded in the multipart field, an error response has
+// already been written when ok is false
+func imageFromMultipart(w http.ResponseWriter, req *http.Request, field string) (b []byte, name string, ok bool) {
 	err := req.ParseMultipartForm(5 << 20) // 5MB
 	if err != nil {
 		http.Error(w, "failed to parse form", http.StatusBadRequest)
-		return
+		return nil, "", false
 	}
 
-	file, header, err := req.FormFile("file")
+	file, header, err := req.FormFile(field)
 	if err != nil {
-		http.Error(w, "failed to get file from multipart form", http.StatusBadRequest)
-		return
+		http.Error(w, fmt.Sprintf("failed to get %s from multipart form", field), http.StatusBadRequest)
+		return nil, "", false
 	}
 	defer file.Close()
 
@@ -37,77 +109,412 @@ func (s *SudokuServer) readGrid(w http.ResponseWriter, req *http.Request) {
 	_, err = io.Copy(&buf, file)
 	if err != nil {
 		http.Error(w, "unable to read file", http.StatusInternalServerError)
+		return nil, "", false
+	}
+
+	return buf.Bytes(), header.Filename, true
+}
+
+func (s *SudokuServer) imageFromJSON(w http.ResponseWriter, req *http.Request) (b []byte, name string, ok bool) {
+	// base64 is a third larger than the image it holds
+	body := http.MaxBytesReader(w, req.Body, s.fetcher.maxBytes*4/3+1024)
+
+	var r imageRequest
+	if err := json.NewDecoder(body).Decode(&r); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "image too large", http.StatusRequestEntityTooLarge)
+			return nil, "", false
+		}
+
+		http.Error(w, "failed to parse json body", http.StatusBadRequest)
+		return nil, "", false
+	}
+
+	switch {
+	case (r.ImageBase64 == "") == (r.ImageURL == ""):
+		http.Error(w, "expected one of image_base64 or image_url", http.StatusBadRequest)
+		return nil, "", false
+	case r.ImageBase64 != "":
+		data := r.ImageBase64
+		if strings.HasPrefix(data, "data:") {
+			_, data, _ = strings.Cut(data, ",")
+		}
+
+		var err error
+		b, err = base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			http.Error(w, "unable to decode image_base64", http.StatusBadRequest)
+			return nil, "", false
+		}
+		name = "image"
+	default:
+		u, err := url.Parse(r.ImageURL)
+		if err != nil {
+			http.Error(w, "unable to parse image_url", http.StatusBadRequest)
+			return nil, "", false
+		}
+
+		b, err = s.fetcher.fetch(req.Context(), u)
+		if err != nil {
+			Logger.Error("failed to fetch image", "url", u.Redacted(), "error", err)
+			switch {
+			case errors.Is(err, errURLNotAllowed):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			case errors.Is(err, errImageTooLarge):
+				http.Error(w, "image too large", http.StatusRequestEntityTooLarge)
+			default:
+				http.Error(w, "failed to fetch image_url", http.StatusBadGateway)
+			}
+			return nil, "", false
+		}
+
+		name = path.Base(u.Path)
+		if name == "/" || name == "." {
+			name = u.Hostname()
+		}
+	}
+
+	if r.Name != "" {
+		name = r.Name
+	}
+
+	return b, name, true
+}
+
+// reads, splits and processes the grid in the request with the options in
+// the query (see imageFromRequest), an error response has already been
+// written when ok is false. debug may be nil.
+func (s *SudokuServer) gridFromRequest(w http.ResponseWriter, req *http.Request, debug *DebugBundle) (grid *Grid, ok bool) {
+	img, name, opts, ok := s.imageFromRequest(w, req)
+	if !ok {
+		return nil, false
+	}
+
+	opts.Debug = debug
+	grid, err := ReadGrid(img, name, s.worker, opts)
+	if err != nil {
+		Logger.Error("failed to read grid", "grid_id", name, "error", err)
+		http.Error(w, "failed to read grid", http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return grid, true
+}
+
+// the response format is taken from ?format=, then the Accept header
+func requestFormat(req *http.Request) (Format, error) {
+	if f := req.URL.Query().Get("format"); f != "" {
+		return ParseFormat(f)
+	}
+
+	return FormatFromAccept(req.Header.Get("Accept")), nil
+}
+
+// ?debug=overlay responds with the detection geometry drawn over the
+// uploaded image instead of the grid, ?debug=bundle responds with a zip of
+// every pre-processing stage, distortion score and the result
+func (s *SudokuServer) readGrid(w http.ResponseWriter, req *http.Request) {
+	format, err := requestFormat(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	debug := req.URL.Query().Get("debug")
+	if debug != "" && debug != "overlay" && debug != "bundle" {
+		http.Error(w, fmt.Sprintf("unsupported debug output %q", debug), http.StatusBadRequest)
+		return
+	}
+
+	var bundle *DebugBundle
+	if debug == "bundle" {
+		bundle = NewDebugBundle()
+	}
+
+	grid, ok := s.gridFromRequest(w, req, bundle)
+	if !ok {
+		return
+	}
+
+	if debug == "overlay" {
+		b, err := grid.DebugOverlay()
+		if err != nil {
+			http.Error(w, "failed to draw debug overlay", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "image/png")
+		w.Write(b)
+		return
+	}
+
+	if bundle != nil {
+		result, err := grid.Encode(FormatJSON)
+		if err != nil {
+			http.Error(w, "failed to encode response", http.StatusInternalServerError)
+			return
+		}
+		bundle.Add("result.json", result)
+
+		overlay, err := grid.DebugOverlay()
+		if err != nil {
+			http.Error(w, "failed to draw debug overlay", http.StatusInternalServerError)
+			return
+		}
+		bundle.Add("overlay.png", overlay)
+
+		b, err := bundle.Zip()
+		if err != nil {
+			http.Error(w, "failed to zip debug bundle", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/zip")
+		w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%q", grid.Name+"-debug.zip"))
+		w.Write(b)
 		return
 	}
 
-	img, _, err := image.Decode(&buf)
+	resB, err := grid.Encode(format)
+	if errors.Is(err, errUnsupportedShape) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
-		http.Error(w, "unable to decode provided image", http.StatusInternalServerError)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", format.ContentType())
+	w.Write(resB)
+}
+
+// reads every grid in the uploaded image (i.e. a newspaper page), responding
+// with a json array of them in the order they were found, each with the
+// bounds it was found at
+func (s *SudokuServer) readGrids(w http.ResponseWriter, req *http.Request) {
+	if f := req.URL.Query().Get("format"); f != "" && f != string(FormatJSON) {
+		http.Error(w, fmt.Sprintf("unsupported format %q, several grids are only written as json", f), http.StatusBadRequest)
+		return
+	}
+
+	img, name, opts, ok := s.imageFromRequest(w, req)
+	if !ok {
+		return
+	}
+
+	grids, err := ReadGrids(img, name, s.worker, opts)
+	if err != nil {
+		Logger.Error("failed to read grids", "grid_id", name, "error", err)
+		http.Error(w, "failed to read grids", http.StatusInternalServerError)
 		return
 	}
 
-	grid := GridFromImage(img, header.Filename)
-	if err := grid.SplitCells(ModeComparison); err != nil {
-		http.Error(w, "failed to split cells", http.StatusInternalServerError)
+	res := make([]gridJSON, len(grids))
+	for idx, grid := range grids {
+		res[idx] = grid.toJSON()
+	}
+
+	resB, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
 		return
 	}
 
-	if err := grid.Process(s.worker.jobs); err != nil {
-		http.Error(w, "failed to process cells", http.StatusInternalServerError)
+	w.Header().Add("Content-Type", FormatJSON.ContentType())
+	w.Write(resB)
+}
+
+// reads the moves made in a recording of a grid being solved, uploaded as an
+// animated GIF or APNG in the multipart "file" field, or as a screenshot per
+// frame in several "file" fields shown for ?interval= each (1s by default).
+// Responds with the timeline as json, see Timeline.
+func (s *SudokuServer) readTimeline(w http.ResponseWriter, req *http.Request) {
+	opts, err := readOptions(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	type CellRes struct {
-		Identifier   string   `json:"identifier"`
-		Type         CellType `json:"type"`
-		Val          int      `json:"val"`
-		Placeholders []int    `json:"placeholders"`
+	interval := time.Second
+	if i := req.URL.Query().Get("interval"); i != "" {
+		interval, err = time.ParseDuration(i)
+		if err != nil || interval <= 0 {
+			http.Error(w, fmt.Sprintf("invalid interval %q, expected a duration like 500ms", i), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := req.ParseMultipartForm(5 << 20); err != nil { // 5MB
+		http.Error(w, "failed to parse form", http.StatusBadRequest)
+		return
 	}
 
-	type Res struct {
-		ID                      string      `json:"id"`
-		CharacterRepresentation string      `json:"character_representation"`
-		GridRepresentation      [][]CellRes `json:"grid_json"`
+	headers := req.MultipartForm.File["file"]
+	if len(headers) == 0 {
+		http.Error(w, "failed to get file from multipart form", http.StatusBadRequest)
+		return
 	}
+	name := headers[0].Filename
 
-	gridRep := make([][]CellRes, len(grid.Cells))
+	// each frame is read as it's decoded
+	reader := NewTimelineReader(name, s.worker, opts)
+	for idx, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			http.Error(w, "unable to read file", http.StatusInternalServerError)
+			return
+		}
+		b, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			http.Error(w, "unable to read file", http.StatusInternalServerError)
+			return
+		}
 
-	for rIdx, row := range grid.Cells {
-		gridRep[rIdx] = make([]CellRes, len(row))
-		for cIdx, cell := range row {
-			gridRep[rIdx][cIdx] = CellRes{
-				Identifier:   cell.Identifier,
-				Type:         cell.Type(),
-				Val:          cell.comparisonValue,
-				Placeholders: cell.comparisonPlaceholders,
+		if len(headers) == 1 {
+			err = DecodeFrames(b, reader.Add)
+		} else {
+			var img image.Image
+			if img, err = DecodeImage(b); err == nil {
+				reader.Add(Frame{Image: img, Time: time.Duration(idx) * interval})
 			}
 		}
+		if err != nil {
+			Logger.Error("failed to decode frames", "grid_id", name, "file", header.Filename, "error", err)
+			http.Error(w, "unable to decode provided image", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	r := Res{
-		ID:                      header.Filename,
-		CharacterRepresentation: grid.String(),
-		GridRepresentation:      gridRep,
+	timeline, err := reader.Timeline()
+	if err != nil {
+		Logger.Error("failed to read timeline", "grid_id", name, "error", err)
+		http.Error(w, "failed to read timeline", http.StatusInternalServerError)
+		return
 	}
 
-	resB, err := json.Marshal(r)
+	resB, err := json.Marshal(timeline)
 	if err != nil {
-		http.Error(w, "failed to marshal response", http.StatusInternalServerError)
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Add("Content-Type", "application/json")
+	w.Header().Add("Content-Type", FormatJSON.ContentType())
 	w.Write(resB)
 }
 
-func (s *SudokuServer) Start() {
+// compares two screenshots of a puzzle, uploaded in the multipart "before"
+// and "after" fields, responding with the moves made and the highlights
+// changed between them as json (see GridDiff). Screenshots of different
+// puzzles are unprocessable.
+func (s *SudokuServer) diffGrids(w http.ResponseWriter, req *http.Request) {
+	opts, err := readOptions(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var grids []*Grid
+	for _, field := range []string{"before", "after"} {
+		b, name, ok := imageFromMultipart(w, req, field)
+		if !ok {
+			return
+		}
+
+		img, err := DecodeImage(b)
+		if err != nil {
+			Logger.Error("failed to decode image", "grid_id", name, "error", err)
+			http.Error(w, "unable to decode provided image", http.StatusInternalServerError)
+			return
+		}
+
+		grid, err := ReadGrid(img, name, s.worker, opts)
+		if err != nil {
+			Logger.Error("failed to read grid", "grid_id", name, "error", err)
+			http.Error(w, fmt.Sprintf("failed to read %s grid", field), http.StatusInternalServerError)
+			return
+		}
+		grids = append(grids, grid)
+	}
+
+	diff, err := CompareGrids(grids[0], grids[1])
+	if errors.Is(err, errDifferentPuzzles) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		Logger.Error("failed to compare grids", "grid_id", grids[0].Name, "error", err)
+		http.Error(w, "failed to compare grids", http.StatusInternalServerError)
+		return
+	}
+
+	resB, err := json.Marshal(diff)
+	if err != nil {
+		http.Error(w, "failed to encode response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", FormatJSON.ContentType())
+	w.Write(resB)
+}
+
+// renders the recognised grid, ?format= can be "svg" (default) or "png",
+// ?composite=true places the original crop next to a png render
+func (s *SudokuServer) renderGrid(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = "svg"
+	}
+
+	composite := req.URL.Query().Get("composite") == "true"
+	if format != "svg" && format != "png" {
+		http.Error(w, fmt.Sprintf("unsupported render format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	grid, ok := s.gridFromRequest(w, req, nil)
+	if !ok {
+		return
+	}
+
+	size := grid.boundaries.Size()
+
+	switch {
+	case composite:
+		b, err := grid.RenderComposite()
+		if err != nil {
+			http.Error(w, "failed to render composite", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", "image/png")
+		w.Write(b)
+	case format == "png":
+		b, err := grid.RenderPNG(size.X, size.Y)
+		if err != nil {
+			http.Error(w, "failed to render png", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-Type", "image/png")
+		w.Write(b)
+	default:
+		w.Header().Add("Content-Type", "image/svg+xml")
+		w.Write(grid.RenderSVG(size.X, size.Y))
+	}
+}
+
+func (s *SudokuServer) Start(addr string) {
 	s.worker.Start()
 	http.HandleFunc("/ping", s.pong)
 	http.HandleFunc("/read-grid", s.readGrid)
+	http.HandleFunc("/read-grids", s.readGrids)
+	http.HandleFunc("/read-timeline", s.readTimeline)
+	http.HandleFunc("/diff-grids", s.diffGrids)
+	http.HandleFunc("/render-grid", s.renderGrid)
 
-	fmt.Println("listening on port 8080")
-	// todo: make this localhost when not in container
-	err := http.ListenAndServe(":8080", nil)
+	fmt.Printf("listening on %s\n", addr)
+	err := http.ListenAndServe(addr, nil)
 	if err != nil {
 		panic(err)
 	}
@@ -115,6 +522,7 @@ func (s *SudokuServer) Start() {
 
 func NewSudokuServer() *SudokuServer {
 	return &SudokuServer{
-		worker: NewGridWorker(),
+		worker:  NewGridWorker(),
+		fetcher: newImageFetcher(allowedImageHosts()),
 	}
 }
@@ -0,0 +1,161 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSudokuServer_imageFromRequest(t *testing.T) {
+	png, err := os.ReadFile("../formats/grid.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+	want, err := DecodeImage(png)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	images := http.NewServeMux()
+	images.HandleFunc("/grid.png", func(w http.ResponseWriter, req *http.Request) {
+		w.Write(png)
+	})
+	images.HandleFunc("/chunked/grid.png", func(w http.ResponseWriter, req *http.Request) {
+		// flushing first leaves out the content length
+		w.(http.Flusher).Flush()
+		w.Write(png)
+	})
+	images.HandleFunc("/slow.png", func(w http.ResponseWriter, req *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		w.Write(png)
+	})
+	images.HandleFunc("/missing.png", http.NotFound)
+	srv := httptest.NewServer(images)
+	defer srv.Close()
+
+	// the allow-list holds the ip, localhost is another host
+	u, err := url.Parse(srv.URL)
+	if !assert.NoError(t, err) {
+		return
+	}
+	images.HandleFunc("/elsewhere.png", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "http://localhost:"+u.Port()+"/grid.png", http.StatusFound)
+	})
+	images.HandleFunc("/redirect.png", func(w http.ResponseWriter, req *http.Request) {
+		http.Redirect(w, req, "/grid.png", http.StatusFound)
+	})
+
+	multipartRequest := func() *http.Request {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "upload.png")
+		part.Write(png)
+		mw.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/read-grid", &body)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+		return req
+	}
+
+	jsonRequest := func(r imageRequest) *http.Request {
+		b, _ := json.Marshal(r)
+		req := httptest.NewRequest(http.MethodPost, "/read-grid", bytes.NewReader(b))
+		req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		return req
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(png)
+	for _, tc := range []struct {
+		name    string
+		req     *http.Request
+		fetcher func(f *imageFetcher)
+		status  int
+		// the grid's name when the image is read
+		grid string
+	}{
+		{name: "multipart upload", req: multipartRequest(), grid: "upload.png"},
+		{name: "base64", req: jsonRequest(imageRequest{ImageBase64: encoded}), grid: "image"},
+		{name: "base64 data url", req: jsonRequest(imageRequest{ImageBase64: "data:image/png;base64," + encoded, Name: "bot"}), grid: "bot"},
+		{name: "url", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/grid.png"}), grid: "grid.png"},
+		{name: "url without a content length", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/chunked/grid.png"}), grid: "grid.png"},
+		{name: "url redirected on the same host", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/redirect.png"}), grid: "redirect.png"},
+		{name: "both", req: jsonRequest(imageRequest{ImageBase64: encoded, ImageURL: srv.URL + "/grid.png"}), status: http.StatusBadRequest},
+		{name: "neither", req: jsonRequest(imageRequest{}), status: http.StatusBadRequest},
+		{name: "invalid base64", req: jsonRequest(imageRequest{ImageBase64: "not base64!"}), status: http.StatusBadRequest},
+		{name: "invalid json", req: func() *http.Request {
+			req := httptest.NewRequest(http.MethodPost, "/read-grid", strings.NewReader("{"))
+			req.Header.Set("Content-Type", "application/json")
+			return req
+		}(), status: http.StatusBadRequest},
+		{name: "host not allowed", req: jsonRequest(imageRequest{ImageURL: "http://localhost:" + u.Port() + "/grid.png"}), status: http.StatusForbidden},
+		{name: "redirected to a host not allowed", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/elsewhere.png"}), status: http.StatusForbidden},
+		{name: "unsupported scheme", req: jsonRequest(imageRequest{ImageURL: "file:///etc/passwd"}), status: http.StatusForbidden},
+		{name: "nothing allowed", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/grid.png"}), fetcher: func(f *imageFetcher) {
+			f.allowedHosts = nil
+		}, status: http.StatusForbidden},
+		{name: "url too large", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/grid.png"}), fetcher: func(f *imageFetcher) {
+			f.maxBytes = 1000
+		}, status: http.StatusRequestEntityTooLarge},
+		{name: "url too large without a content length", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/chunked/grid.png"}), fetcher: func(f *imageFetcher) {
+			f.maxBytes = 1000
+		}, status: http.StatusRequestEntityTooLarge},
+		{name: "base64 too large", req: jsonRequest(imageRequest{ImageBase64: encoded}), fetcher: func(f *imageFetcher) {
+			f.maxBytes = 1000
+		}, status: http.StatusRequestEntityTooLarge},
+		{name: "url timed out", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/slow.png"}), fetcher: func(f *imageFetcher) {
+			f.client.Timeout = 50 * time.Millisecond
+		}, status: http.StatusBadGateway},
+		{name: "url not found", req: jsonRequest(imageRequest{ImageURL: srv.URL + "/missing.png"}), status: http.StatusBadGateway},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &SudokuServer{fetcher: newImageFetcher([]string{u.Hostname()})}
+			if tc.fetcher != nil {
+				tc.fetcher(s.fetcher)
+			}
+
+			w := httptest.NewRecorder()
+			img, name, _, ok := s.imageFromRequest(w, tc.req)
+			if tc.status != 0 {
+				assert.False(t, ok)
+				assert.Equal(t, tc.status, w.Code, w.Body.String())
+				return
+			}
+
+			if !assert.True(t, ok, w.Body.String()) {
+				return
+			}
+			assert.Equal(t, tc.grid, name)
+			assert.Equal(t, want.Bounds(), img.Bounds())
+			assert.Equal(t, want.At(100, 100), img.At(100, 100))
+		})
+	}
+}
+
+func TestImageFetcher_check(t *testing.T) {
+	f := newImageFetcher([]string{"cdn.example.com", "localhost:8080"})
+	for raw, allowed := range map[string]bool{
+		"https://cdn.example.com/grid.png":      true,
+		"https://CDN.example.com:443/grid.png":  true,
+		"http://localhost:8080/grid.png":        true,
+		"http://localhost:9090/grid.png":        false,
+		"https://example.com/grid.png":          false,
+		"https://cdn.example.com.evil/grid.png": false,
+		"ftp://cdn.example.com/grid.png":        false,
+	} {
+		u, err := url.Parse(raw)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Equal(t, allowed, f.check(u) == nil, raw)
+	}
+}
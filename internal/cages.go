@@ -0,0 +1,298 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+	"slices"
+	"strconv"
+)
+
+const (
+	// cage outlines are looked for this far in from the cell edge, as a
+	// fraction of the cell width
+	maxCageInset = 0.2
+	// a row of pixels is a dashed line when this share of it is ink...
+	minDashInk = 0.2
+	maxDashInk = 0.85
+	// ...split into at least this many dashes
+	minDashes = 4
+	// the cage sum sits in this much of the top left of a cell
+	cageSumWidth  = 0.5
+	cageSumHeight = 0.4
+	// cage sum digits are between these heights relative to the cell
+	minCageSumHeight = 0.08
+	maxCageSumHeight = 0.35
+)
+
+// Cage is a killer cage, the cells it covers in reading order and the sum
+// written in its top left cell. Sum is 0 when it couldn't be read.
+type Cage struct {
+	Cells []string `json:"cells"`
+	Sum   int      `json:"sum"`
+}
+
+type side int
+
+const (
+	sideTop side = iota
+	sideRight
+	sideBottom
+	sideLeft
+)
+
+// isDashed reports whether the ink along a row of pixels looks like a dashed
+// line: regular gaps, neither solid (a grid line) nor a few strokes of a
+// glyph
+func isDashed(ink []bool) bool {
+	var count, dashes, longest, run int
+	for idx, on := range ink {
+		if on {
+			count += 1
+			run += 1
+			if idx == 0 || !ink[idx-1] {
+				dashes += 1
+			}
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+
+	share := float64(count) / float64(len(ink))
+	return share >= minDashInk && share <= maxDashInk && dashes >= minDashes && longest <= len(ink)/minDashes
+}
+
+// cageWalls looks for a dashed cage outline along each side of the cell,
+// sampling rows (or columns) parallel to the side at increasing depth. Only
+// the middle half of each side is sampled, the top left corner holds the cage
+// sum. inset is the deepest outline found.
+func (c *Cell) cageWalls() (walls [4]bool, inset int) {
+	bounds := c.image.Image.Bounds()
+	// a highlighted cell's background isn't ink, the outline is whatever
+	// colour it's drawn in
+	isInk := c.image.Mask().Ink
+
+	maxDepth := int(float64(bounds.Dx()) * maxCageInset)
+	from := func(length int) (int, int) {
+		return length / 4, length * 3 / 4
+	}
+
+	for s := sideTop; s <= sideLeft; s++ {
+		for depth := 0; depth < maxDepth && !walls[s]; depth++ {
+			var ink []bool
+			switch s {
+			case sideTop, sideBottom:
+				y := bounds.Min.Y + depth
+				if s == sideBottom {
+					y = bounds.Max.Y - 1 - depth
+				}
+				start, end := from(bounds.Dx())
+				for x := bounds.Min.X + start; x < bounds.Min.X+end; x++ {
+					ink = append(ink, isInk(x, y))
+				}
+			case sideLeft, sideRight:
+				x := bounds.Min.X + depth
+				if s == sideRight {
+					x = bounds.Max.X - 1 - depth
+				}
+				start, end := from(bounds.Dy())
+				for y := bounds.Min.Y + start; y < bounds.Min.Y+end; y++ {
+					ink = append(ink, isInk(x, y))
+				}
+			}
+
+			if isDashed(ink) {
+				walls[s] = true
+				inset = max(inset, depth+1)
+			}
+		}
+	}
+
+	return walls, inset
+}
+
+// findCages traces the killer cages in the grid. Neighbouring cells without a
+// cage outline between them are joined, a group of cells is only a cage when
+// an outline runs all the way around it and it's at most as many cells as a
+// row. Every cell in a cage has its cageInset set to the deepest outline in
+// the cage, the top left cell its cageSumRect.
+func (g *Grid) findCages() [][]*Cell {
+	n := len(g.Cells)
+	walls := make([][4]bool, n*n)
+	insets := make([]int, n*n)
+	for r, row := range g.Cells {
+		for col, cell := range row {
+			walls[r*n+col], insets[r*n+col] = cell.cageWalls()
+		}
+	}
+
+	// union find over every cell
+	parent := make([]int, n*n)
+	for idx := range parent {
+		parent[idx] = idx
+	}
+	var find func(int) int
+	find = func(idx int) int {
+		if parent[idx] != idx {
+			parent[idx] = find(parent[idx])
+		}
+		return parent[idx]
+	}
+	join := func(a, b int) {
+		parent[find(a)] = find(b)
+	}
+
+	for r := 0; r < n; r++ {
+		for col := 0; col < n; col++ {
+			idx := r*n + col
+			if col < n-1 && !walls[idx][sideRight] && !walls[idx+1][sideLeft] {
+				join(idx, idx+1)
+			}
+			if r < n-1 && !walls[idx][sideBottom] && !walls[idx+n][sideTop] {
+				join(idx, idx+n)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for idx := range n * n {
+		groups[find(idx)] = append(groups[find(idx)], idx)
+	}
+
+	cages := make([][]*Cell, 0)
+	for idx := range n * n {
+		group := groups[find(idx)]
+		// each group once, from its first cell in reading order
+		if group[0] != idx || len(group) > n {
+			continue
+		}
+
+		enclosed := true
+		for _, member := range group {
+			r, col := member/n, member%n
+			neighbours := [4][2]int{{r - 1, col}, {r, col + 1}, {r + 1, col}, {r, col - 1}}
+			for s, next := range neighbours {
+				inGroup := next[0] >= 0 && next[0] < n && next[1] >= 0 && next[1] < n && slices.Contains(group, next[0]*n+next[1])
+				if !inGroup && !walls[member][s] {
+					enclosed = false
+				}
+			}
+		}
+
+		if !enclosed {
+			continue
+		}
+
+		var inset int
+		for _, member := range group {
+			inset = max(inset, insets[member])
+		}
+
+		cage := make([]*Cell, 0, len(group))
+		for _, member := range group {
+			cell := g.Cells[member/n][member%n]
+			cell.cageInset = inset
+			cage = append(cage, cell)
+		}
+
+		anchor := cage[0].image.Image.Bounds()
+		cage[0].cageSumRect = image.Rect(
+			anchor.Min.X,
+			anchor.Min.Y,
+			anchor.Min.X+int(float64(anchor.Dx())*cageSumWidth),
+			anchor.Min.Y+int(float64(anchor.Dy())*cageSumHeight),
+		)
+
+		cages = append(cages, cage)
+	}
+
+	return cages
+}
+
+// readCageSum classifies the glyphs in the cage sum corner of the cell left
+// to right, returning 0 when there are none or the sum isn't possible for a
+// cage of size cells in a grid of digits up to n
+func (c *Cell) readCageSum(classifier *Classifier, size, n int) (int, error) {
+	glyphs, err := c.glyphsIn(c.cageSumRect, minCageSumHeight, maxCageSumHeight, func(b image.Rectangle) bool {
+		// what's left of the dashed outline, not a digit
+		return b.Dx()*5 >= b.Dy()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	slices.SortFunc(glyphs, func(a, b *placeholderGlyph) int {
+		return a.rect.Min.X - b.rect.Min.X
+	})
+
+	digits := &Classifier{K: 1, Placeholders: slices.Concat(classifier.Placeholders, zeroSamples())}
+
+	var str string
+	for _, glyph := range glyphs {
+		img, err := glyph.image.Processed()
+		if err != nil {
+			return 0, err
+		}
+
+		if img == nil {
+			continue
+		}
+
+		if classification := digits.ClassifyPlaceholder(glyphFeatures(img)); classification != nil {
+			str += strconv.Itoa(classification.Digit)
+		}
+	}
+
+	if str == "" {
+		return 0, nil
+	}
+
+	sum, err := strconv.Atoi(str)
+	if err != nil {
+		return 0, fmt.Errorf("parsing cage sum %q: %v", str, err)
+	}
+
+	// the smallest and largest sums of size distinct digits
+	lowest, highest := size*(size+1)/2, size*(2*n+1-size)/2
+	if sum < lowest || sum > highest {
+		Logger.Debug("impossible cage sum", "cell", c.Identifier, "sum", sum, "size", size)
+		return 0, nil
+	}
+
+	return sum, nil
+}
+
+// FindCages traces the killer cages in the grid and reads their sums, it must
+// be called after SplitCells and before Process so the cage outlines and sums
+// aren't taken for pencil marks. Grids without cages have none.
+func (g *Grid) FindCages() error {
+	cages := g.findCages()
+	if len(cages) == 0 {
+		g.Cages = []Cage{}
+		return nil
+	}
+
+	classifier, err := defaultClassifier()
+	if err != nil {
+		return fmt.Errorf("loading classifier: %v", err)
+	}
+
+	g.Cages = make([]Cage, 0, len(cages))
+	for _, cells := range cages {
+		sum, err := cells[0].readCageSum(classifier, len(cells), g.Shape.Size)
+		if err != nil {
+			return fmt.Errorf("reading cage sum in %s: %v", cells[0].Identifier, err)
+		}
+
+		cage := Cage{Sum: sum}
+		for _, cell := range cells {
+			cage.Cells = append(cage.Cells, cell.Identifier)
+		}
+
+		g.Cages = append(g.Cages, cage)
+	}
+
+	Logger.Debug("found killer cages", "grid_id", g.Name, "cages", len(g.Cages))
+
+	return nil
+}
@@ -0,0 +1,155 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCageTestImage draws a blank grid in the geometry SplitCells expects with
+// a dashed killer cage outline inside the edge of every cage, cages maps each
+// cell to its cage (0 for none)
+func newCageTestImage(cages [9][9]int) image.Image {
+	const cell, thick, thin, margin, inset = 80, 6, 3, 40, 5
+	gridWidth := 4*thick + 6*thin + 9*cell + 1
+
+	img := image.NewRGBA(image.Rect(0, 0, gridWidth+margin*2, gridWidth+margin*2))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(margin, margin, margin+gridWidth, margin+gridWidth), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	var origins [9]int
+	pos := margin + thick
+	for i := range origins {
+		origins[i] = pos
+		pos += cell + thin
+		if i == 2 || i == 5 {
+			pos += thick - thin
+		}
+	}
+
+	dash := color.RGBA{0x44, 0x44, 0x44, 0xff}
+	// horizontal or vertical, 4px dashes with 3px gaps
+	dashed := func(x0, y0, x1, y1 int) {
+		dx, dy := 1, 0
+		if x0 == x1 {
+			dx, dy = 0, 1
+		}
+
+		for i := 0; x0+i*dx <= x1 && y0+i*dy <= y1; i++ {
+			if i%7 < 4 {
+				img.Set(x0+i*dx, y0+i*dy, dash)
+			}
+		}
+	}
+
+	for r := 0; r < 9; r++ {
+		for c := 0; c < 9; c++ {
+			x, y := origins[c], origins[r]
+			draw.Draw(img, image.Rect(x, y, x+cell, y+cell), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+			id := cages[r][c]
+			if id == 0 {
+				continue
+			}
+
+			other := func(r, c int) bool {
+				return r < 0 || r > 8 || c < 0 || c > 8 || cages[r][c] != id
+			}
+			if other(r-1, c) {
+				dashed(x+inset, y+inset, x+cell-inset, y+inset)
+			}
+			if other(r, c+1) {
+				dashed(x+cell-inset, y+inset, x+cell-inset, y+cell-inset)
+			}
+			if other(r+1, c) {
+				dashed(x+inset, y+cell-inset, x+cell-inset, y+cell-inset)
+			}
+			if other(r, c-1) {
+				dashed(x+inset, y+inset, x+inset, y+cell-inset)
+			}
+		}
+	}
+
+	return img
+}
+
+func TestGrid_FindCages(t *testing.T) {
+	tests := []struct {
+		name     string
+		layout   [9][9]int
+		expected [][]string
+	}{
+		{
+			name:     "classic",
+			expected: [][]string{},
+		},
+		{
+			name: "killer",
+			layout: [9][9]int{
+				{1, 1, 2, 2, 2, 0, 3, 3, 0},
+				{4, 1, 0, 0, 0, 0, 3, 0, 0},
+				{4, 0, 0, 5, 0, 0, 0, 0, 0},
+				{0, 0, 0, 5, 5, 0, 0, 0, 6},
+				{0, 0, 0, 0, 0, 0, 0, 0, 6},
+				{0, 0, 0, 0, 0, 0, 0, 0, 0},
+				{0, 0, 0, 0, 0, 0, 7, 7, 7},
+				{0, 8, 0, 0, 0, 0, 7, 7, 7},
+				{0, 0, 0, 0, 0, 0, 7, 7, 7},
+			},
+			expected: [][]string{
+				{"R1C1", "R1C2", "R2C2"},
+				{"R1C3", "R1C4", "R1C5"},
+				{"R1C7", "R1C8", "R2C7"},
+				{"R2C1", "R3C1"},
+				{"R3C4", "R4C4", "R4C5"},
+				{"R4C9", "R5C9"},
+				{"R7C7", "R7C8", "R7C9", "R8C7", "R8C8", "R8C9", "R9C7", "R9C8", "R9C9"},
+				{"R8C2"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := GridFromImage(newCageTestImage(tt.layout), tt.name)
+			if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+				return
+			}
+
+			found := make([][]string, 0)
+			for _, cage := range g.findCages() {
+				var ids []string
+				for _, c := range cage {
+					ids = append(ids, c.Identifier)
+					assert.Positive(t, c.cageInset, c.Identifier)
+				}
+				found = append(found, ids)
+
+				assert.False(t, cage[0].cageSumRect.Empty(), fmt.Sprintf("cage sum rect of %s", cage[0].Identifier))
+			}
+
+			assert.Equal(t, tt.expected, found)
+		})
+	}
+}
+
+func TestIsDashed(t *testing.T) {
+	row := func(pattern string) []bool {
+		ink := make([]bool, 0, len(pattern))
+		for _, r := range pattern {
+			ink = append(ink, r == '#')
+		}
+		return ink
+	}
+
+	assert.True(t, isDashed(row("####...####...####...####...####...")))
+	// a grid line
+	assert.False(t, isDashed(row("###################################")))
+	// a couple of strokes of a digit
+	assert.False(t, isDashed(row("..........###......###.............")))
+	assert.False(t, isDashed(row("...................................")))
+}
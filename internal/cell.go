@@ -3,8 +3,7 @@ package internal
 import (
 	"fmt"
 	"image"
-
-	"gopkg.in/gographics/imagick.v3/imagick"
+	"image/color"
 )
 
 type CellType string
@@ -20,19 +19,53 @@ type Mode string
 const (
 	ModeOCR        Mode = "ocr"
 	ModeComparison Mode = "comparison"
+	// ModeClassifier shares the comparison results, only how they're
+	// recognised differs
+	ModeClassifier Mode = "classifier"
 )
 
+// ParseMode validates a recognizer name, empty is ModeComparison
+func ParseMode(s string) (Mode, error) {
+	switch m := Mode(s); m {
+	case "":
+		return ModeComparison, nil
+	case ModeOCR, ModeComparison, ModeClassifier:
+		return m, nil
+	}
+
+	return "", fmt.Errorf("unknown mode %q, expected comparison, classifier or ocr", s)
+}
+
 type Cell struct {
 	Identifier string // i.e, R1C1
 
 	image *GridImage
 	mode  Mode
+	// the largest value the grid holds, its size
+	maxValue int
 
 	ocrValue        int
 	ocrPlaceholders []int
 
 	comparisonValue        int
 	comparisonPlaceholders []int
+	// lowest distortion percentage seen against the value representations,
+	// -1 until ProcessValues (or ClassifyValues) has run
+	comparisonDistortion float64
+
+	// pencil marks split by how they were written, see markCentreGlyphs.
+	// comparisonPlaceholders holds both.
+	cornerMarks []int
+	centreMarks []int
+
+	// bounds of each pencil mark glyph found, in grid image coordinates
+	placeholderRects []image.Rectangle
+
+	// how far in from the cell edge a killer cage outline was found, 0 when
+	// the cell isn't in a cage
+	cageInset int
+	// where the cage sum is written when this is the top left cell of a cage
+	cageSumRect image.Rectangle
 }
 
 func (c *Cell) Type() CellType {
@@ -48,7 +81,7 @@ func (c *Cell) Type() CellType {
 		return CellTypeEmpty
 	}
 
-	if c.mode == ModeComparison {
+	if c.mode == ModeComparison || c.mode == ModeClassifier {
 		if c.comparisonValue != -1 {
 			return CellTypeValue
 		}
@@ -71,89 +104,251 @@ func (c *Cell) Contents() (t CellType, val int, placeholders []int) {
 	return c.Type(), c.comparisonValue, c.comparisonPlaceholders
 }
 
-func (c *Cell) ProcessValues(representations []*GridImage) error {
+// Marks splits the placeholders into corner marks (including those written
+// at the position of their digit) and centre marks, both are empty in ocr
+// mode
+func (c *Cell) Marks() (corner, centre []int) {
+	if c.mode == ModeOCR {
+		return nil, nil
+	}
+
+	return c.cornerMarks, c.centreMarks
+}
+
+// Confidence is how sure we are of the cell's value as a percentage, derived
+// from the distortion of the best matching representation (or the classifier
+// vote). It's only known for comparison and classifier mode cells that have
+// been processed.
+func (c *Cell) Confidence() (float64, bool) {
+	if c.mode == ModeOCR || c.comparisonDistortion < 0 {
+		return 0, false
+	}
+
+	return max(0, 100-c.comparisonDistortion), true
+}
+
+// Background is the dominant colour of the cell, which tells us whether the
+// cell was highlighted
+func (c *Cell) Background() color.Color {
+	if c.image == nil {
+		return color.White
+	}
+
+	return c.image.DominantColour()
+}
+
+// Label is the cell contents in the notation used by the truth tables,
+// "5" for a value, "p123" for placeholders and "" when empty. Values over 9
+// are written as letters, see Symbol.
+func (c *Cell) Label() string {
+	t, val, placeholders := c.Contents()
+	switch t {
+	case CellTypeValue:
+		return Symbol(val)
+	case CellTypePlaceholders:
+		label := "p"
+		for _, p := range placeholders {
+			label += Symbol(p)
+		}
+		return label
+	}
+
+	return ""
+}
+
+// ParseLabel is the inverse of Label, values over 9 can also be written out
+// (i.e. "12")
+func ParseLabel(label string) (t CellType, val int, placeholders []int, err error) {
+	if label == "" {
+		return CellTypeEmpty, -1, nil, nil
+	}
+
+	if label[0] == 'p' {
+		for _, r := range label[1:] {
+			p, err := ParseSymbol(string(r))
+			if err != nil {
+				return "", -1, nil, fmt.Errorf("parsing placeholder %q: %v", r, err)
+			}
+			placeholders = append(placeholders, p)
+		}
+		return CellTypePlaceholders, -1, placeholders, nil
+	}
+
+	val, err = ParseSymbol(label)
+	if err != nil {
+		return "", -1, nil, fmt.Errorf("parsing value %q: %v", label, err)
+	}
+
+	return CellTypeValue, val, nil, nil
+}
+
+// ProcessValues compares the cell against every template, taking the digit
+// of the best match if it's close enough
+func (c *Cell) ProcessValues(templates []*Template) error {
 	if err := c.image.RunPreProcessing(); err != nil {
 		return fmt.Errorf("running pre-processing on cell: %v", err)
 	}
 
-	for repIdx, r := range representations {
-		_, distortion := c.image.wand.CompareImages(r.wand, imagick.METRIC_ABSOLUTE_ERROR)
-		resolution := r.wand.GetImageWidth() * r.wand.GetImageHeight()
-		distortionPercentage := distortion / float64(resolution) * 100
-
+	best := BestMatch(c.image, templates, func(t *Template, distortionPercentage float64) {
 		Logger.Debug(
 			"calculating value distortion percentage",
 			"cell", c.Identifier,
-			"comparison_val", repIdx+1,
+			"comparison_val", t.Digit,
+			"template", t.Name(),
 			"distortion_percentage", distortionPercentage,
 		)
+		c.image.debug.AddScore(DistortionScore{
+			Cell:                 c.Identifier,
+			Kind:                 "value",
+			Comparison:           t.Digit,
+			Template:             t.Name(),
+			DistortionPercentage: distortionPercentage,
+		})
+	})
+
+	if best == nil {
+		return nil
+	}
+
+	c.comparisonDistortion = best.DistortionPercentage
+	if best.DistortionPercentage < 5 && best.Template.Digit <= c.maxValue {
+		c.comparisonValue = best.Template.Digit
+	}
+
+	return nil
+}
 
-		if distortionPercentage < 5 {
-			c.comparisonValue = repIdx + 1
-			break
+// ProcessPlaceholders matches each pencil mark glyph against every
+// template, taking the digit of the best match if it's close enough
+func (c *Cell) ProcessPlaceholders(templates []*Template) error {
+	glyphs, err := c.placeholderGlyphs()
+	if err != nil {
+		return err
+	}
+
+	for _, glyph := range glyphs {
+		best := BestMatch(glyph.image, templates, func(t *Template, distortionPercentage float64) {
+			Logger.Debug(
+				"calculating placeholder distortion percentage",
+				"cell", c.Identifier,
+				"comparison_placeholder_value", t.Digit,
+				"template", t.Name(),
+				"distortion_percentage", distortionPercentage,
+			)
+			c.image.debug.AddScore(DistortionScore{
+				Cell:                 c.Identifier,
+				Kind:                 "placeholder",
+				Position:             glyph.slot,
+				Comparison:           t.Digit,
+				Template:             t.Name(),
+				DistortionPercentage: distortionPercentage,
+			})
+		})
+
+		// if the distortion is less than 20% then we consider it a match
+		// note: I was getting success at 5% but it failed on a "6" placeholder
+		// on a selected cell
+		if best != nil && best.DistortionPercentage < 20 {
+			glyph.digit = best.Template.Digit
 		}
 	}
 
+	c.setMarks(glyphs)
+
 	return nil
 }
 
-func (c *Cell) ProcessPlaceholders(representations []*GridImage) error {
-	cellBounds := c.image.Image.Bounds()
+// ClassifyValues runs the classifier over the pre-processed cell, ignoring
+// glyphs too short to be a value (i.e. a cell of placeholders)
+func (c *Cell) ClassifyValues(classifier *Classifier) error {
+	if err := c.image.RunPreProcessing(); err != nil {
+		return fmt.Errorf("running pre-processing on cell: %v", err)
+	}
 
-	offset := 6
-	xPos := cellBounds.Min.X + offset
-	yPos := cellBounds.Min.Y + offset
+	img, err := c.image.Processed()
+	if err != nil {
+		return err
+	}
 
-	cellPos := 1
-	for row := 0; row < 3; row++ {
-		for col := 0; col < 3; col++ {
-			placeholderRect := image.Rect(
-				xPos+(col*39),
-				yPos+(row*39),
-				xPos+(col*39)+20,
-				yPos+(row*39)+25,
-			)
+	if img == nil {
+		return nil
+	}
 
-			placeholderPosition := row*3 + col + 1
+	cellHeight := c.image.Image.Bounds().Dy()
+	if tallest := tallestComponent(img); float64(tallest) < float64(cellHeight)*minValueHeight {
+		Logger.Debug("glyph too short to be a value", "cell", c.Identifier, "height", tallest, "cell_height", cellHeight)
+		return nil
+	}
 
-			cropped := NewGridImage(
-				c.image.CropImage(placeholderRect),
-				fmt.Sprintf("%s/p%d/", c.Identifier, placeholderPosition),
-			)
+	if c.maxValue > 9 {
+		if val, confidence, ok := classifyTwoDigits(classifier, img, float64(cellHeight)*minValueHeight); ok && val <= c.maxValue {
+			Logger.Debug("classified two digit value", "cell", c.Identifier, "value", val, "confidence", confidence)
 
-			if err := cropped.RunPreProcessing(); err != nil {
-				return fmt.Errorf("running pre-processing on placeholder: %v", err)
-			}
+			c.comparisonValue = val
+			c.comparisonDistortion = 100 - confidence
+			return nil
+		}
+	}
 
-			if cropped.wand.GetImageHeight() == 1 || cropped.wand.GetImageWidth() == 1 {
-				// image is likely empty after the trim, means the placeholder was empty
-				continue
-			}
+	classification := classifier.ClassifyValue(glyphFeatures(img))
+	if classification == nil {
+		return nil
+	}
 
-			for repIdx, r := range representations {
-				_, distortion := cropped.wand.CompareImages(r.wand, imagick.METRIC_ABSOLUTE_ERROR)
-				resolution := r.wand.GetImageWidth() * r.wand.GetImageHeight()
-				distortionPercentage := distortion / float64(resolution) * 100
-
-				Logger.Debug(
-					"calculating placeholder distortion percentage",
-					"cell", c.Identifier,
-					"comparison_placeholder_value", repIdx+1,
-					"distortion_percentage", distortionPercentage,
-				)
-
-				// if the distortion is less than 20% then we consider it a match
-				// note: I was getting success at 5% but it failed on a "6" placeholder
-				// on a selected cell
-				if distortionPercentage < 20 {
-					c.comparisonPlaceholders = append(c.comparisonPlaceholders, repIdx+1)
-				}
-			}
+	if classification.Digit > c.maxValue {
+		Logger.Debug("classified value larger than the grid", "cell", c.Identifier, "digit", classification.Digit, "max", c.maxValue)
+		return nil
+	}
+
+	Logger.Debug(
+		"classified value",
+		"cell", c.Identifier,
+		"digit", classification.Digit,
+		"confidence", classification.Confidence,
+		"distance", classification.Distance,
+	)
+
+	c.comparisonValue = classification.Digit
+	c.comparisonDistortion = 100 - classification.Confidence
+
+	return nil
+}
+
+// ClassifyPlaceholders runs the classifier over each pencil mark glyph
+func (c *Cell) ClassifyPlaceholders(classifier *Classifier) error {
+	glyphs, err := c.placeholderGlyphs()
+	if err != nil {
+		return err
+	}
+
+	for _, glyph := range glyphs {
+		img, err := glyph.image.Processed()
+		if err != nil {
+			return err
+		}
+
+		if img == nil {
+			continue
+		}
 
-			cellPos += 1
+		classification := classifier.ClassifyPlaceholder(glyphFeatures(img))
+		if classification == nil {
+			continue
 		}
+
+		Logger.Debug(
+			"classified placeholder",
+			"cell", c.Identifier,
+			"position", glyph.slot,
+			"digit", classification.Digit,
+			"confidence", classification.Confidence,
+		)
+
+		glyph.digit = classification.Digit
 	}
 
+	c.setMarks(glyphs)
+
 	return nil
 }
 
@@ -188,13 +383,19 @@ func (c *Cell) IdentifyOCR() error {
 }
 
 func NewCellFromGridImage(cellBounds image.Rectangle, img *GridImage, identifier string, mode Mode) *Cell {
+	cellImage := NewGridImage(img.CropImage(cellBounds), identifier)
+	cellImage.debug = img.debug
+	cellImage.mask = img.Mask()
+
 	return &Cell{
 		Identifier: identifier,
-		image:      NewGridImage(img.CropImage(cellBounds), identifier),
+		image:      cellImage,
 		mode:       mode,
+		maxValue:   ClassicShape.Size,
 
-		ocrValue:        -1,
-		comparisonValue: -1,
+		ocrValue:             -1,
+		comparisonValue:      -1,
+		comparisonDistortion: -1,
 	}
 }
 
@@ -203,8 +404,10 @@ func NewCell(gridBounds image.Rectangle, img image.Image, identifier string, mod
 		image:      NewGridImage(img, identifier),
 		Identifier: identifier,
 		mode:       mode,
+		maxValue:   ClassicShape.Size,
 
-		ocrValue:        -1,
-		comparisonValue: -1,
+		ocrValue:             -1,
+		comparisonValue:      -1,
+		comparisonDistortion: -1,
 	}
 }
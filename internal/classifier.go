@@ -0,0 +1,367 @@
+package internal
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+)
+
+// the model shipped with the binary, trained offline from grids/ and the
+// t-values and t-placeholders templates, rebuild it with
+// `grid-reader train -classifier internal/classifier.json grids`
+//
+//go:embed classifier.json
+var embeddedClassifier []byte
+
+const (
+	// glyphs are scaled to fit this size (keeping their aspect ratio) before
+	// their features are taken
+	glyphWidth  = 16
+	glyphHeight = 24
+	// histogram of oriented gradients over 4x4 pixel blocks with 9
+	// orientation bins between 0 and 180 degrees
+	hogBlock = 4
+	hogBins  = 9
+
+	// neighbours that vote on a glyph's digit
+	classifierK = 3
+	// a glyph further than this from every sample of the digit voted for
+	// isn't one the model knows. Glyphs of the same digit are well under it,
+	// even at another size, the closest samples of different digits are
+	// around 190 apart.
+	maxClassifierDistance = 150.0
+	// confidence falls from 100 to 100 minus this over maxClassifierDistance,
+	// which is the distortion the templates accept a value at
+	classifierConfidenceRange = 5.0
+
+	// a value glyph must be at least this tall relative to the cell,
+	// placeholders are much smaller
+	minValueHeight = 0.35
+)
+
+// ClassifierSample is a labelled glyph, its features are quantised to a byte
+// each to keep the embedded model small
+type ClassifierSample struct {
+	Digit    int    `json:"digit"`
+	Features []byte `json:"features"`
+}
+
+// Classifier is a k-nearest-neighbour model over the gradient histograms of
+// pre-processed glyphs. Unlike the absolute error used by the templates it
+// doesn't care about the size of a glyph or a pixel of anti-aliasing.
+type Classifier struct {
+	K            int                `json:"k"`
+	Values       []ClassifierSample `json:"values"`
+	Placeholders []ClassifierSample `json:"placeholders"`
+}
+
+// Classification is the digit most of the k nearest samples agreed on.
+// Distance is to the closest sample of that digit, Confidence is derived from
+// it on the same scale as the templates (100 minus their distortion).
+type Classification struct {
+	Digit      int
+	Confidence float64
+	Distance   float64
+}
+
+func (c *Classifier) classify(samples []ClassifierSample, features []byte) *Classification {
+	if len(samples) == 0 {
+		return nil
+	}
+
+	type neighbour struct {
+		digit    int
+		distance int
+	}
+
+	neighbours := make([]neighbour, 0, len(samples))
+	for _, s := range samples {
+		neighbours = append(neighbours, neighbour{s.Digit, featureDistance(s.Features, features)})
+	}
+	sort.SliceStable(neighbours, func(i, j int) bool {
+		return neighbours[i].distance < neighbours[j].distance
+	})
+
+	k := max(1, min(c.K, len(neighbours)))
+	var votes [maxSymbol + 1]int
+	for _, n := range neighbours[:k] {
+		votes[n.digit] += 1
+	}
+
+	// ties go to the digit with the closest sample
+	best := neighbours[0].digit
+	for digit, v := range votes {
+		if v > votes[best] {
+			best = digit
+		}
+	}
+
+	var distance float64
+	for _, n := range neighbours[:k] {
+		if n.digit == best {
+			distance = math.Sqrt(float64(n.distance))
+			break
+		}
+	}
+
+	if distance > maxClassifierDistance {
+		return nil
+	}
+
+	return &Classification{
+		Digit:      best,
+		Confidence: 100 - distance/maxClassifierDistance*classifierConfidenceRange,
+		Distance:   distance,
+	}
+}
+
+// ClassifyValue returns nil when the model has no value samples, or none
+// close enough to the glyph
+func (c *Classifier) ClassifyValue(features []byte) *Classification {
+	return c.classify(c.Values, features)
+}
+
+// ClassifyPlaceholder returns nil when the model has no placeholder samples,
+// or none close enough to the glyph
+func (c *Classifier) ClassifyPlaceholder(features []byte) *Classification {
+	return c.classify(c.Placeholders, features)
+}
+
+func (c *Classifier) Save(p string) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("marshalling classifier: %v", err)
+	}
+
+	if err := os.WriteFile(p, b, 0644); err != nil {
+		return fmt.Errorf("writing classifier: %v", err)
+	}
+
+	return nil
+}
+
+func parseClassifier(b []byte) (*Classifier, error) {
+	var c Classifier
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("unmarshalling classifier: %v", err)
+	}
+
+	featureCount := len(glyphFeatures(image.NewNRGBA(image.Rect(0, 0, 1, 1))))
+	for _, s := range slices.Concat(c.Values, c.Placeholders) {
+		// 10 to 16 are the letters (or two digit values) of larger grids
+		if s.Digit < 1 || s.Digit > maxSymbol || len(s.Features) != featureCount {
+			return nil, fmt.Errorf("classifier sample for digit %d has %d features, expected %d", s.Digit, len(s.Features), featureCount)
+		}
+	}
+
+	return &c, nil
+}
+
+// LoadClassifier reads a model written by Save
+func LoadClassifier(p string) (*Classifier, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading classifier: %v", err)
+	}
+
+	return parseClassifier(b)
+}
+
+// defaultClassifier is the embedded model, or the one at CLASSIFIER_PATH when
+// set. It's only parsed once, the first time a classifier mode grid is read.
+var defaultClassifier = sync.OnceValues(func() (*Classifier, error) {
+	if p := os.Getenv("CLASSIFIER_PATH"); p != "" {
+		return LoadClassifier(p)
+	}
+
+	return parseClassifier(embeddedClassifier)
+})
+
+// ink is how dark and opaque a pixel is between 0 and 1, pre-processed
+// glyphs are black on a transparent background
+func ink(c color.Color) float64 {
+	nc := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+	lum := (0.2126*float64(nc.R) + 0.7152*float64(nc.G) + 0.0722*float64(nc.B)) / 0xffff
+
+	return float64(nc.A) / 0xffff * (1 - lum)
+}
+
+// glyphFeatures scales the glyph into a glyphWidth x glyphHeight box, centred
+// and keeping its aspect ratio, and returns its L2 normalised histogram of
+// oriented gradients followed by its aspect ratio
+func glyphFeatures(img image.Image) []byte {
+	bounds := img.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	scale := min(glyphWidth/w, glyphHeight/h)
+	offsetX := (glyphWidth - w*scale) / 2
+	offsetY := (glyphHeight - h*scale) / 2
+
+	// area sampling, each target pixel averages the source pixels under it
+	var canvas [glyphHeight][glyphWidth]float64
+	const samples = 4
+	for y := 0; y < glyphHeight; y++ {
+		for x := 0; x < glyphWidth; x++ {
+			var total float64
+			for sy := 0; sy < samples; sy++ {
+				for sx := 0; sx < samples; sx++ {
+					srcX := (float64(x) + (float64(sx)+0.5)/samples - offsetX) / scale
+					srcY := (float64(y) + (float64(sy)+0.5)/samples - offsetY) / scale
+					if srcX < 0 || srcY < 0 || srcX >= w || srcY >= h {
+						continue
+					}
+					total += ink(img.At(bounds.Min.X+int(srcX), bounds.Min.Y+int(srcY)))
+				}
+			}
+			canvas[y][x] = total / (samples * samples)
+		}
+	}
+
+	at := func(x, y int) float64 {
+		if x < 0 || y < 0 || x >= glyphWidth || y >= glyphHeight {
+			return 0
+		}
+		return canvas[y][x]
+	}
+
+	histogram := make([]float64, (glyphWidth/hogBlock)*(glyphHeight/hogBlock)*hogBins)
+	for y := 0; y < glyphHeight; y++ {
+		for x := 0; x < glyphWidth; x++ {
+			gx := at(x+1, y) - at(x-1, y)
+			gy := at(x, y+1) - at(x, y-1)
+			magnitude := math.Hypot(gx, gy)
+			if magnitude == 0 {
+				continue
+			}
+
+			// unsigned orientation, a stroke's two edges land in the same bin
+			angle := math.Atan2(gy, gx)
+			if angle < 0 {
+				angle += math.Pi
+			}
+			bin := min(hogBins-1, int(angle/math.Pi*hogBins))
+
+			block := (y/hogBlock)*(glyphWidth/hogBlock) + x/hogBlock
+			histogram[block*hogBins+bin] += magnitude
+		}
+	}
+
+	var norm float64
+	for _, v := range histogram {
+		norm += v * v
+	}
+	norm = math.Sqrt(norm)
+
+	features := make([]byte, 0, len(histogram)+1)
+	for _, v := range histogram {
+		if norm > 0 {
+			v /= norm
+		}
+		features = append(features, byte(math.Round(min(1, v)*255)))
+	}
+
+	// a 1 and a 7 can have similar strokes once scaled, their widths differ
+	features = append(features, byte(math.Round(min(1, w/h/2)*255)))
+
+	return features
+}
+
+func featureDistance(a, b []byte) int {
+	var d int
+	for i := range a {
+		diff := int(a[i]) - int(b[i])
+		d += diff * diff
+	}
+
+	return d
+}
+
+// Processed decodes the image as it is after pre-processing, nil when
+// nothing was left after the trim
+func (g *GridImage) Processed() (image.Image, error) {
+	if g.wand.GetImageHeight() <= 1 || g.wand.GetImageWidth() <= 1 {
+		return nil, nil
+	}
+
+	if err := g.wand.SetImageFormat("png"); err != nil {
+		return nil, fmt.Errorf("setting png format: %v", err)
+	}
+
+	b, err := g.Bytes()
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("decoding pre-processed image: %v", err)
+	}
+
+	return img, nil
+}
+
+// tallestComponent is the height of the tallest connected glyph in img
+func tallestComponent(img image.Image) int {
+	var tallest int
+	for _, c := range findComponents(img.Bounds(), func(x, y int) bool {
+		return ink(img.At(x, y)) > 0.5
+	}) {
+		tallest = max(tallest, c.bounds.Dy())
+	}
+
+	return tallest
+}
+
+// classifyTwoDigits reads the values 10 to 16 written out in a grid larger
+// than 9x9, two glyphs at least minHeight tall side by side, a 1 followed by
+// a digit up to 6. The confidence is the lower of the two.
+func classifyTwoDigits(classifier *Classifier, img image.Image, minHeight float64) (int, float64, bool) {
+	glyphs := make([]component, 0, 2)
+	for _, c := range findComponents(img.Bounds(), func(x, y int) bool {
+		return ink(img.At(x, y)) > 0.5
+	}) {
+		if float64(c.bounds.Dy()) >= minHeight {
+			glyphs = append(glyphs, c)
+		}
+	}
+
+	if len(glyphs) != 2 {
+		return 0, 0, false
+	}
+
+	slices.SortFunc(glyphs, func(a, b component) int {
+		return a.bounds.Min.X - b.bounds.Min.X
+	})
+	if glyphs[0].bounds.Max.X > glyphs[1].bounds.Min.X {
+		return 0, 0, false
+	}
+
+	// zero is never a value on its own so isn't in the model
+	digits := &Classifier{K: 1, Values: slices.Concat(classifier.Values, zeroSamples())}
+
+	var read [2]*Classification
+	for idx, glyph := range glyphs {
+		crop := image.NewNRGBA(glyph.bounds)
+		draw.Draw(crop, glyph.bounds, img, glyph.bounds.Min, draw.Src)
+
+		read[idx] = digits.ClassifyValue(glyphFeatures(crop))
+		if read[idx] == nil {
+			return 0, 0, false
+		}
+	}
+
+	if read[0].Digit != 1 || read[1].Digit > 6 {
+		return 0, 0, false
+	}
+
+	return 10 + read[1].Digit, min(read[0].Confidence, read[1].Confidence), true
+}
@@ -0,0 +1,169 @@
+package internal
+
+import (
+	"image"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+func TestClassifier_Embedded(t *testing.T) {
+	c, err := parseClassifier(embeddedClassifier)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// how well it reads is tested on grids it wasn't trained on, see
+	// TestClassifier_HeldOut
+	for _, samples := range [][]ClassifierSample{c.Values, c.Placeholders} {
+		var digits []int
+		for _, s := range samples {
+			if !slices.Contains(digits, s.Digit) {
+				digits = append(digits, s.Digit)
+			}
+		}
+		slices.Sort(digits)
+		assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, digits)
+	}
+}
+
+// TestClassifier_HeldOut trains a model on the templates and all but one of
+// the grids in grids/, and classifies the cells of the grid left out
+func TestClassifier_HeldOut(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	const minValueAccuracy, minPlaceholderAccuracy = 0.9, 0.8
+
+	dirs, err := filepath.Glob("../grids/*")
+	if !assert.NoError(t, err) || !assert.Greater(t, len(dirs), 1) {
+		return
+	}
+
+	type corpus struct{ values, placeholders [maxSymbol][]*GridImage }
+	corpora := make([]corpus, len(dirs))
+	for idx, dir := range dirs {
+		if !assert.NoError(t, collectSamples(dir, &corpora[idx].values, &corpora[idx].placeholders)) {
+			return
+		}
+	}
+
+	valueTemplates, placeholderTemplates := loadDigitComparisons(), loadPlaceholderComparisons()
+	for held, dir := range dirs {
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			var values, placeholders [maxSymbol][]*GridImage
+			for idx, c := range corpora {
+				if idx == held {
+					continue
+				}
+				for digit := range c.values {
+					values[digit] = append(values[digit], c.values[digit]...)
+					placeholders[digit] = append(placeholders[digit], c.placeholders[digit]...)
+				}
+			}
+
+			var err error
+			c := &Classifier{K: classifierK}
+			if c.Values, err = classifierSamples(valueTemplates, values, 50); !assert.NoError(t, err) {
+				return
+			}
+			if c.Placeholders, err = classifierSamples(placeholderTemplates, placeholders, 50); !assert.NoError(t, err) {
+				return
+			}
+
+			accuracy := func(instances [maxSymbol][]*GridImage, classify func([]byte) *Classification) float64 {
+				var total, correct int
+				for idx, digitInstances := range instances {
+					for _, img := range digitInstances {
+						processed, err := img.Processed()
+						if !assert.NoError(t, err) || processed == nil {
+							continue
+						}
+
+						total++
+						if classification := classify(glyphFeatures(processed)); classification != nil && classification.Digit == idx+1 {
+							correct++
+						}
+					}
+				}
+
+				if total == 0 {
+					return 1
+				}
+				return float64(correct) / float64(total)
+			}
+
+			assert.GreaterOrEqual(t, accuracy(corpora[held].values, c.ClassifyValue), minValueAccuracy)
+			assert.GreaterOrEqual(t, accuracy(corpora[held].placeholders, c.ClassifyPlaceholder), minPlaceholderAccuracy)
+		})
+	}
+}
+
+func TestGlyphFeatures_Scale(t *testing.T) {
+	img, err := LoadImage("../t-values/4.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// the same glyph at twice the size has (almost) the same features
+	bounds := img.Bounds()
+	doubled := image.NewNRGBA(image.Rect(0, 0, bounds.Dx()*2, bounds.Dy()*2))
+	for y := 0; y < bounds.Dy()*2; y++ {
+		for x := 0; x < bounds.Dx()*2; x++ {
+			doubled.Set(x, y, img.At(bounds.Min.X+x/2, bounds.Min.Y+y/2))
+		}
+	}
+
+	c := &Classifier{K: 1, Values: []ClassifierSample{{Digit: 4, Features: glyphFeatures(img)}}}
+	classification := c.ClassifyValue(glyphFeatures(doubled))
+	assert.Less(t, classification.Distance, 100.0)
+}
+
+func TestClassifier_TwoDigitSamples(t *testing.T) {
+	img, err := LoadImage("../t-values/4.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// a model for 12x12 and 16x16 grids holds samples of the letters
+	features := glyphFeatures(img)
+	c := &Classifier{K: 3, Values: []ClassifierSample{{Digit: 12, Features: features}}}
+	classification := c.ClassifyValue(features)
+	if assert.NotNil(t, classification) {
+		assert.Equal(t, 12, classification.Digit)
+	}
+
+	c.Values = append(c.Values, ClassifierSample{Digit: maxSymbol, Features: features}, ClassifierSample{Digit: maxSymbol, Features: features})
+	classification = c.ClassifyValue(features)
+	if assert.NotNil(t, classification) {
+		assert.Equal(t, maxSymbol, classification.Digit)
+	}
+}
+
+func TestClassifier_Distance(t *testing.T) {
+	c := &Classifier{K: 1, Values: []ClassifierSample{
+		{Digit: 1, Features: []byte{0, 0}},
+		{Digit: 7, Features: []byte{200, 0}},
+	}}
+
+	classification := c.ClassifyValue([]byte{0, 0})
+	if assert.NotNil(t, classification) {
+		assert.Equal(t, 1, classification.Digit)
+		assert.Equal(t, 100.0, classification.Confidence)
+	}
+
+	// on the templates' scale, a value only just close enough is 95% sure
+	classification = c.ClassifyValue([]byte{30, 40})
+	if assert.NotNil(t, classification) {
+		assert.Equal(t, 1, classification.Digit)
+		assert.Equal(t, 50.0, classification.Distance)
+		assert.InDelta(t, 100-50/maxClassifierDistance*classifierConfidenceRange, classification.Confidence, 0.001)
+		assert.Greater(t, classification.Confidence, renderMinConfidence)
+	}
+
+	// nothing the model knows
+	assert.Nil(t, c.ClassifyValue([]byte{100, 160}))
+}
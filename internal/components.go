@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"image"
+)
+
+// component is a set of 8-connected foreground pixels
+type component struct {
+	bounds image.Rectangle
+	pixels int
+
+	sumX int
+	sumY int
+}
+
+func (c component) centroid() (x, y float64) {
+	return float64(c.sumX) / float64(c.pixels), float64(c.sumY) / float64(c.pixels)
+}
+
+// findComponents labels the connected foreground pixels within bounds,
+// returning them in scan order (top to bottom, left to right)
+func findComponents(bounds image.Rectangle, foreground func(x, y int) bool) []component {
+	components, _ := labelComponents(bounds, foreground)
+	return components
+}
+
+// labelComponents is findComponents that also returns which component each
+// pixel belongs to, indexed by (y-bounds.Min.Y)*bounds.Dx()+(x-bounds.Min.X).
+// The label is the component's index plus one, 0 is background.
+func labelComponents(bounds image.Rectangle, foreground func(x, y int) bool) ([]component, []int) {
+	w, h := bounds.Dx(), bounds.Dy()
+	labels := make([]int, w*h)
+	components := make([]component, 0)
+
+	var stack []image.Point
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if labels[y*w+x] != 0 || !foreground(bounds.Min.X+x, bounds.Min.Y+y) {
+				continue
+			}
+
+			label := len(components) + 1
+			labels[y*w+x] = label
+			c := component{bounds: image.Rect(x, y, x+1, y+1)}
+			stack = append(stack[:0], image.Point{x, y})
+
+			for len(stack) > 0 {
+				p := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+
+				c.pixels += 1
+				c.sumX += p.X
+				c.sumY += p.Y
+				c.bounds = c.bounds.Union(image.Rect(p.X, p.Y, p.X+1, p.Y+1))
+
+				for dy := -1; dy <= 1; dy++ {
+					for dx := -1; dx <= 1; dx++ {
+						nx, ny := p.X+dx, p.Y+dy
+						if nx < 0 || ny < 0 || nx >= w || ny >= h || labels[ny*w+nx] != 0 {
+							continue
+						}
+
+						if foreground(bounds.Min.X+nx, bounds.Min.Y+ny) {
+							labels[ny*w+nx] = label
+							stack = append(stack, image.Point{nx, ny})
+						}
+					}
+				}
+			}
+
+			// back into the coordinates of bounds
+			c.bounds = c.bounds.Add(bounds.Min)
+			c.sumX += bounds.Min.X * c.pixels
+			c.sumY += bounds.Min.Y * c.pixels
+			components = append(components, c)
+		}
+	}
+
+	return components, labels
+}
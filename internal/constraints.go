@@ -0,0 +1,504 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"slices"
+)
+
+const (
+	// the line between two cell centres is part of a thermometer or arrow when
+	// this share of it is inked, only the part near the cell edges is
+	// sampled as a digit may sit over the centre
+	minPathInk  = 0.9
+	pathReach   = 0.3
+	circleSteps = 72
+	// bulbs are filled out to at least maxBulbProbe of the cell width, arrow
+	// circles are rings between these radii
+	maxBulbProbe    = 0.2
+	minCircleRadius = 0.25
+	maxCircleRadius = 0.42
+	// share of a bulb or circle outline that must be inked, and how much of
+	// the inside of a circle may be (the digit written in it)
+	minCircleInk  = 0.85
+	maxRingInside = 0.6
+	// kropki dots sit over the cell edge, the black ones filled out to at
+	// least minDotRadius and the white ones outlined within maxDotRadius
+	minDotRadius = 0.07
+	maxDotRadius = 0.2
+	minDotInk    = 0.9
+	// how far along the edge from a dot the separator is measured
+	dotClearance = 0.3
+	// X and V markers reach at least xvReach into both cells, are at least
+	// minXVHeight tall and are looked for within this much of the cell edge
+	xvReach     = 0.06
+	minXVHeight = 0.12
+	xvAcross    = 0.15
+	xvAlong     = 0.2
+	// how dark (see ink) a pixel must be to be part of a dot or marker
+	darkInk  = 0.5
+	lightInk = 0.2
+	// a pixel is part of a constraint when it's this far from the cell
+	// backgrounds, lower than for glyphs as constraints are often light
+	markColourDistance = 40
+)
+
+type ConstraintType string
+
+const (
+	// a main diagonal where digits can't repeat (X-Sudoku)
+	ConstraintDiagonal ConstraintType = "diagonal"
+	// digits increase from the bulb along the line
+	ConstraintThermo ConstraintType = "thermo"
+	// the digits along the line sum to the digit in the circle
+	ConstraintArrow ConstraintType = "arrow"
+	// the two digits are consecutive
+	ConstraintKropkiWhite ConstraintType = "kropki_white"
+	// one of the two digits is double the other
+	ConstraintKropkiBlack ConstraintType = "kropki_black"
+	// the two digits sum to 10
+	ConstraintX ConstraintType = "x"
+	// the two digits sum to 5
+	ConstraintV ConstraintType = "v"
+)
+
+// Constraint is a variant rule drawn over the grid and the cells it covers:
+// a diagonal from its top row, a thermometer from its bulb, an arrow from its
+// circle, and the two cells either side of a kropki dot or XV marker.
+// Branching thermometers and arrows are a constraint per branch.
+type Constraint struct {
+	Type  ConstraintType `json:"type"`
+	Cells []string       `json:"cells"`
+}
+
+type centreMark int
+
+const (
+	markNone centreMark = iota
+	markBulb
+	markCircle
+)
+
+// centre is the middle of the cell in grid image coordinates
+func (c *Cell) centre() (x, y float64) {
+	b := c.image.Image.Bounds()
+	return float64(b.Min.X+b.Max.X) / 2, float64(b.Min.Y+b.Max.Y) / 2
+}
+
+// isMarkInk reports whether the pixel at x, y differs from every background,
+// constraints are often drawn in light greys so this is looser than a glyph
+func (g *Grid) isMarkInk(x, y int, backgrounds ...color.Color) bool {
+	if !(image.Point{x, y}).In(g.boundaries) {
+		return false
+	}
+
+	c := g.img.At(x, y)
+	for _, bg := range backgrounds {
+		if colourDistance(c, bg) <= markColourDistance {
+			return false
+		}
+	}
+
+	return true
+}
+
+// circleShare is the share of points on the circle of radius r around x, y
+// that meet is, a point counts when any pixel out to r+band does so thin
+// outlines aren't missed between pixels
+func circleShare(x, y, r, band float64, is func(x, y int) bool) float64 {
+	var count int
+	for step := range circleSteps {
+		angle := 2 * math.Pi * float64(step) / circleSteps
+		for d := r; d <= r+band; d += 0.5 {
+			if is(int(math.Round(x+d*math.Cos(angle))), int(math.Round(y+d*math.Sin(angle)))) {
+				count += 1
+				break
+			}
+		}
+	}
+
+	return float64(count) / circleSteps
+}
+
+// discShare is the share of pixels within radius r of x, y that meet is
+func discShare(x, y, r float64, is func(x, y int) bool) float64 {
+	var count, total int
+	for dy := -int(r); dy <= int(r); dy++ {
+		for dx := -int(r); dx <= int(r); dx++ {
+			if float64(dx*dx+dy*dy) > r*r {
+				continue
+			}
+
+			total += 1
+			if is(int(math.Round(x))+dx, int(math.Round(y))+dy) {
+				count += 1
+			}
+		}
+	}
+
+	if total == 0 {
+		return 0
+	}
+	return float64(count) / float64(total)
+}
+
+// centreMark looks for a thermometer bulb (a filled disc) or an arrow circle
+// (a ring, its radius is returned so paths are followed from its edge) in the
+// middle of the cell
+func (g *Grid) centreMark(c *Cell) (centreMark, float64) {
+	x, y := c.centre()
+	u := float64(g.cellWidth)
+	background := c.Background()
+	is := func(x, y int) bool { return g.isMarkInk(x, y, background) }
+
+	if circleShare(x, y, u*maxBulbProbe/2, 0, is) >= minCircleInk && circleShare(x, y, u*maxBulbProbe, 0, is) >= minCircleInk {
+		return markBulb, 0
+	}
+
+	// the outer edge of the innermost ring
+	var radius float64
+	inside := u * (minCircleRadius - maxBulbProbe/2)
+	for r := u * minCircleRadius; r <= u*maxCircleRadius; r++ {
+		if circleShare(x, y, r, 1, is) >= minCircleInk && circleShare(x, y, r-inside, 0, is) < maxRingInside {
+			radius = r + 1
+		} else if radius > 0 {
+			break
+		}
+	}
+
+	if radius > 0 {
+		return markCircle, radius
+	}
+
+	return markNone, 0
+}
+
+// isPath reports whether a line joins the centres of a and b, followed from
+// the edge of any circle they hold
+func (g *Grid) isPath(a, b *Cell, radiusA, radiusB float64) bool {
+	ax, ay := a.centre()
+	bx, by := b.centre()
+	dist := math.Hypot(bx-ax, by-ay)
+	from, to := max(dist*pathReach, radiusA+2), dist-max(dist*pathReach, radiusB+2)
+	if to <= from {
+		return false
+	}
+
+	backgroundA, backgroundB := a.Background(), b.Background()
+	var count, total int
+	for t := from; t <= to; t++ {
+		total += 1
+		x, y := ax+(bx-ax)*t/dist, ay+(by-ay)*t/dist
+		if g.isMarkInk(int(math.Round(x)), int(math.Round(y)), backgroundA, backgroundB) {
+			count += 1
+		}
+	}
+
+	return float64(count)/float64(total) >= minPathInk
+}
+
+// borderMark looks for a kropki dot or XV marker over the edge between a and
+// b, which are side by side or one above the other
+func (g *Grid) borderMark(a, b *Cell) (ConstraintType, bool) {
+	ab, bb := a.image.Image.Bounds(), b.image.Image.Bounds()
+	horizontal := ab.Min.Y == bb.Min.Y
+	u := float64(g.cellWidth)
+
+	// the gap between the cells holds the separator, x, y is its middle
+	var gap image.Rectangle
+	var x, y float64
+	if horizontal {
+		gap = image.Rect(ab.Max.X, ab.Min.Y, bb.Min.X, ab.Max.Y)
+		x, y = float64(ab.Max.X+bb.Min.X)/2, float64(ab.Min.Y+ab.Max.Y)/2
+	} else {
+		gap = image.Rect(ab.Min.X, ab.Max.Y, ab.Max.X, bb.Min.Y)
+		x, y = float64(ab.Min.X+ab.Max.X)/2, float64(ab.Max.Y+bb.Min.Y)/2
+	}
+
+	dark := func(x, y int) bool { return ink(g.img.At(x, y)) > darkInk }
+	light := func(x, y int) bool { return ink(g.img.At(x, y)) < lightInk }
+
+	// the dark run across the edge through x, y plus offset along it, a
+	// black dot is wider than the separator it sits on
+	across := func(offset float64) int {
+		px, py := int(math.Round(x)), int(math.Round(y))
+		step := image.Point{1, 0}
+		if horizontal {
+			py += int(offset)
+		} else {
+			px += int(offset)
+			step = image.Point{0, 1}
+		}
+
+		run := 0
+		for _, dir := range []int{-1, 1} {
+			for p := (image.Point{px, py}).Add(step.Mul(max(0, dir))); dark(p.X, p.Y); p = p.Add(step.Mul(dir)) {
+				run += 1
+			}
+		}
+		return run
+	}
+	if discShare(x, y, u*minDotRadius, dark) >= minDotInk &&
+		float64(across(0)) >= float64(max(across(-u*dotClearance), across(u*dotClearance)))+u*minDotRadius {
+		return ConstraintKropkiBlack, true
+	}
+
+	// white dots are drawn over the separator, hiding it
+	if discShare(x, y, max(2, u*minDotRadius/2), light) == 1 {
+		for r := u * minDotRadius / 2; r <= u*maxDotRadius; r++ {
+			if circleShare(x, y, r, 1, dark) >= minCircleInk {
+				return ConstraintKropkiWhite, true
+			}
+		}
+	}
+
+	return g.xvMark(a, b, gap, horizontal, dark)
+}
+
+// xvMark looks for an X or V written over the edge between a and b. The
+// separator (and any cage outline along the edge) is left out, what remains
+// of a marker must reach into both cells. A V narrows to a point at the
+// bottom where an X is as wide as at the top.
+func (g *Grid) xvMark(a, b *Cell, gap image.Rectangle, horizontal bool, dark func(x, y int) bool) (ConstraintType, bool) {
+	u := float64(g.cellWidth)
+	across, along := int(u*xvAcross), int(u*xvAlong)
+	reach := int(u * xvReach)
+
+	window := gap
+	if horizontal {
+		window = image.Rect(gap.Min.X-across, gap.Min.Y+gap.Dy()/2-along, gap.Max.X+across, gap.Min.Y+gap.Dy()/2+along)
+	} else {
+		window = image.Rect(gap.Min.X+gap.Dx()/2-along, gap.Min.Y-across, gap.Min.X+gap.Dx()/2+along, gap.Max.Y+across)
+	}
+
+	// depth is how far into a (negative) or b a pixel is from the gap
+	depth := func(x, y int) int {
+		pos, start, end := y, gap.Min.Y, gap.Max.Y
+		if horizontal {
+			pos, start, end = x, gap.Min.X, gap.Max.X
+		}
+		if pos < start {
+			return pos - start
+		}
+		if pos >= end {
+			return pos - end + 1
+		}
+		return 0
+	}
+
+	var bounds image.Rectangle
+	var reachesA, reachesB bool
+	marks := make([]image.Point, 0)
+	for py := window.Min.Y; py < window.Max.Y; py++ {
+		for px := window.Min.X; px < window.Max.X; px++ {
+			d := depth(px, py)
+			if d == 0 || (d < 0 && -d <= a.cageInset+1) || (d > 0 && d <= b.cageInset+1) || !dark(px, py) {
+				continue
+			}
+
+			if d < 0 && -d <= a.cageInset+reach {
+				reachesA = true
+			}
+			if d > 0 && d <= b.cageInset+reach {
+				reachesB = true
+			}
+
+			p := image.Point{px, py}
+			bounds = bounds.Union(image.Rectangle{p, p.Add(image.Point{1, 1})})
+			marks = append(marks, p)
+		}
+	}
+
+	if !reachesA || !reachesB || float64(bounds.Dy()) < u*minXVHeight {
+		return "", false
+	}
+
+	// the width of the marker across its top and bottom quarters
+	width := func(from, to int) int {
+		left, right := bounds.Max.X, bounds.Min.X
+		for _, p := range marks {
+			if p.Y >= from && p.Y < to {
+				left, right = min(left, p.X), max(right, p.X+1)
+			}
+		}
+		return max(0, right-left)
+	}
+	quarter := bounds.Dy() / 4
+	top, bottom := width(bounds.Min.Y, bounds.Min.Y+quarter), width(bounds.Max.Y-quarter, bounds.Max.Y)
+
+	if bottom*2 < top {
+		return ConstraintV, true
+	}
+	return ConstraintX, true
+}
+
+// pathGraph lists the cells each cell is joined to by a line, cells are
+// numbered row*n+col
+type pathGraph map[int][]int
+
+func (p pathGraph) joined(a, b int) bool {
+	return slices.Contains(p[a], b)
+}
+
+func (p pathGraph) join(a, b int) {
+	p[a] = append(p[a], b)
+	p[b] = append(p[b], a)
+}
+
+func (p pathGraph) split(a, b int) {
+	p[a] = slices.DeleteFunc(p[a], func(next int) bool { return next == b })
+	p[b] = slices.DeleteFunc(p[b], func(next int) bool { return next == a })
+}
+
+// lines groups the joined cells into thermometers and arrows, following
+// every branch from the bulb or circle to its end
+func (g *Grid) lines(marks []centreMark, paths pathGraph) []Constraint {
+	n := g.Shape.Size
+	constraints := make([]Constraint, 0)
+
+	seen := make([]bool, n*n)
+	for idx := range n * n {
+		if seen[idx] || len(paths[idx]) == 0 {
+			continue
+		}
+
+		seen[idx] = true
+		group := []int{idx}
+		for i := 0; i < len(group); i++ {
+			for _, next := range paths[group[i]] {
+				if !seen[next] {
+					seen[next] = true
+					group = append(group, next)
+				}
+			}
+		}
+
+		starts := slices.DeleteFunc(slices.Clone(group), func(cell int) bool { return marks[cell] == markNone })
+		if len(starts) != 1 {
+			Logger.Debug("line without a single bulb or circle", "grid_id", g.Name, "cell", g.cell(idx).Identifier, "starts", len(starts))
+			continue
+		}
+
+		t := ConstraintThermo
+		if marks[starts[0]] == markCircle {
+			t = ConstraintArrow
+		}
+
+		visited := make([]bool, n*n)
+		var walk func(cell int, branch []string)
+		walk = func(cell int, branch []string) {
+			visited[cell] = true
+			branch = append(branch, g.cell(cell).Identifier)
+
+			next := slices.DeleteFunc(slices.Clone(paths[cell]), func(next int) bool { return visited[next] })
+			if len(next) == 0 {
+				constraints = append(constraints, Constraint{Type: t, Cells: branch})
+				return
+			}
+
+			for _, nextCell := range next {
+				visited[nextCell] = true
+			}
+			for _, nextCell := range next {
+				walk(nextCell, slices.Clone(branch))
+			}
+		}
+		walk(starts[0], nil)
+	}
+
+	return constraints
+}
+
+// cell is the cell numbered idx, see pathGraph
+func (g *Grid) cell(idx int) *Cell {
+	return g.Cells[idx/g.Shape.Size][idx%g.Shape.Size]
+}
+
+// FindConstraints looks for variant constraints drawn over the grid: the main
+// diagonals, thermometers, arrows, kropki dots and XV markers. Thermometers
+// and arrows are lines between the centres of neighbouring cells grouped by
+// the bulb or circle they start from, lines without one (or with several)
+// are left out. It must be called after FindCages so cage outlines aren't
+// taken for markers.
+func (g *Grid) FindConstraints() {
+	n := g.Shape.Size
+	g.Constraints = []Constraint{}
+
+	marks := make([]centreMark, n*n)
+	radii := make([]float64, n*n)
+	for idx := range n * n {
+		marks[idx], radii[idx] = g.centreMark(g.cell(idx))
+	}
+
+	// lines between every cell and its neighbours, in all eight directions
+	paths := make(pathGraph)
+	for idx := range n * n {
+		row, col := idx/n, idx%n
+		for _, step := range [4][2]int{{0, 1}, {1, 0}, {1, 1}, {1, -1}} {
+			toRow, toCol := row+step[0], col+step[1]
+			if toRow >= n || toCol < 0 || toCol >= n {
+				continue
+			}
+
+			to := toRow*n + toCol
+			if g.isPath(g.cell(idx), g.cell(to), radii[idx], radii[to]) {
+				paths.join(idx, to)
+			}
+		}
+	}
+
+	// a diagonal is a line through every cell along it, which then isn't
+	// part of any other line
+	for _, diagonal := range [][]int{
+		diagonalCells(n, 0, n+1),
+		diagonalCells(n, n-1, n-1),
+	} {
+		whole := true
+		for i := 1; i < len(diagonal); i++ {
+			whole = whole && paths.joined(diagonal[i-1], diagonal[i])
+		}
+		if !whole {
+			continue
+		}
+
+		constraint := Constraint{Type: ConstraintDiagonal}
+		for i, idx := range diagonal {
+			constraint.Cells = append(constraint.Cells, g.cell(idx).Identifier)
+			if i > 0 {
+				paths.split(diagonal[i-1], idx)
+			}
+		}
+		g.Constraints = append(g.Constraints, constraint)
+	}
+
+	g.Constraints = append(g.Constraints, g.lines(marks, paths)...)
+
+	for idx := range n * n {
+		row, col := idx/n, idx%n
+		for _, step := range [2][2]int{{0, 1}, {1, 0}} {
+			toRow, toCol := row+step[0], col+step[1]
+			to := toRow*n + toCol
+			if toRow >= n || toCol >= n || paths.joined(idx, to) {
+				continue
+			}
+
+			a, b := g.cell(idx), g.cell(to)
+			if t, ok := g.borderMark(a, b); ok {
+				g.Constraints = append(g.Constraints, Constraint{Type: t, Cells: []string{a.Identifier, b.Identifier}})
+			}
+		}
+	}
+
+	Logger.Debug("found constraints", "grid_id", g.Name, "constraints", len(g.Constraints))
+}
+
+// diagonalCells numbers the n cells of a diagonal from start, each step moving
+// by step
+func diagonalCells(n, start, step int) []int {
+	cells := make([]int, n)
+	for i := range cells {
+		cells[i] = start + i*step
+	}
+	return cells
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// drawDisc fills the circle of radius r around x, y, or just its outline of
+// the given width when width is above 0
+func drawDisc(img draw.Image, x, y, r, width float64, c color.Color) {
+	for py := int(y - r - 1); py <= int(y+r+1); py++ {
+		for px := int(x - r - 1); px <= int(x+r+1); px++ {
+			d := math.Hypot(float64(px)+0.5-x, float64(py)+0.5-y)
+			if d <= r && (width == 0 || d > r-width) {
+				img.Set(px, py, c)
+			}
+		}
+	}
+}
+
+// drawLine draws a line of the given width between two points
+func drawLine(img draw.Image, x0, y0, x1, y1, width float64, c color.Color) {
+	length := math.Hypot(x1-x0, y1-y0)
+	for t := 0.0; t <= length; t += 0.5 {
+		drawDisc(img, x0+(x1-x0)*t/length, y0+(y1-y0)*t/length, width/2, 0, c)
+	}
+}
+
+func rectCentre(r image.Rectangle) (float64, float64) {
+	return float64(r.Min.X+r.Max.X) / 2, float64(r.Min.Y+r.Max.Y) / 2
+}
+
+// newConstraintsTestImage draws every kind of constraint over a blank classic
+// grid, in the colours SudokuPad uses
+func newConstraintsTestImage() image.Image {
+	blank, cells := newShapeTestImage(ClassicShape)
+	img := blank.(*image.RGBA)
+	u := float64(cells[0][0].Dx())
+	centre := func(row, col int) (float64, float64) { return rectCentre(cells[row-1][col-1]) }
+	// the middle of the edge between two cells
+	edge := func(row, col, toRow, toCol int) (float64, float64) {
+		ax, ay := centre(row, col)
+		bx, by := centre(toRow, toCol)
+		return (ax + bx) / 2, (ay + by) / 2
+	}
+	line := func(width float64, c color.Color, path ...[2]int) {
+		for i := 1; i < len(path); i++ {
+			x0, y0 := centre(path[i-1][0], path[i-1][1])
+			x1, y1 := centre(path[i][0], path[i][1])
+			drawLine(img, x0, y0, x1, y1, width, c)
+		}
+	}
+
+	// a diagonal from corner to corner of the grid
+	drawLine(img, float64(cells[0][0].Min.X), float64(cells[0][0].Min.Y), float64(cells[8][8].Max.X), float64(cells[8][8].Max.Y), 2, color.Gray{0x88})
+
+	thermo := color.Gray{0xcc}
+	line(u*0.25, thermo, [2]int{1, 3}, [2]int{1, 4}, [2]int{1, 5}, [2]int{2, 6})
+	x, y := centre(1, 3)
+	drawDisc(img, x, y, u*0.35, 0, thermo)
+
+	arrow := color.Gray{0x99}
+	x, y = centre(4, 7)
+	drawDisc(img, x, y, u*0.38, 2, arrow)
+	line(2, arrow, [2]int{4, 7}, [2]int{5, 7}, [2]int{6, 8})
+	// the line starts at the circle's edge
+	drawDisc(img, x, y, u*0.38-2, 0, color.White)
+
+	x, y = edge(8, 2, 8, 3)
+	drawDisc(img, x, y, u*0.1, 0, color.Black)
+
+	x, y = edge(6, 2, 7, 2)
+	drawDisc(img, x, y, u*0.1, 0, color.White)
+	drawDisc(img, x, y, u*0.1, 2, color.Black)
+
+	// X and V markers, a quarter of a cell tall
+	h := u * 0.3
+	x, y = edge(9, 4, 9, 5)
+	drawLine(img, x-h/2.5, y-h/2, x+h/2.5, y+h/2, 3, color.Black)
+	drawLine(img, x+h/2.5, y-h/2, x-h/2.5, y+h/2, 3, color.Black)
+	x, y = edge(7, 6, 8, 6)
+	drawLine(img, x-h/2.5, y-h/2, x, y+h/2, 3, color.Black)
+	drawLine(img, x+h/2.5, y-h/2, x, y+h/2, 3, color.Black)
+
+	return img
+}
+
+func TestGrid_FindConstraints(t *testing.T) {
+	t.Run("finds every kind of constraint", func(t *testing.T) {
+		g := GridFromImage(newConstraintsTestImage(), "constraints")
+		if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+			return
+		}
+		g.FindConstraints()
+
+		assert.Equal(t, []Constraint{
+			{Type: ConstraintDiagonal, Cells: []string{"R1C1", "R2C2", "R3C3", "R4C4", "R5C5", "R6C6", "R7C7", "R8C8", "R9C9"}},
+			{Type: ConstraintThermo, Cells: []string{"R1C3", "R1C4", "R1C5", "R2C6"}},
+			{Type: ConstraintArrow, Cells: []string{"R4C7", "R5C7", "R6C8"}},
+			{Type: ConstraintKropkiWhite, Cells: []string{"R6C2", "R7C2"}},
+			{Type: ConstraintV, Cells: []string{"R7C6", "R8C6"}},
+			{Type: ConstraintKropkiBlack, Cells: []string{"R8C2", "R8C3"}},
+			{Type: ConstraintX, Cells: []string{"R9C4", "R9C5"}},
+		}, g.Constraints)
+	})
+
+	t.Run("finds nothing on plain grids", func(t *testing.T) {
+		plain, _ := newShapeTestImage(ClassicShape)
+		// thick region borders aren't kropki dots
+		for name, img := range map[string]image.Image{"plain": plain, "jigsaw": newRegionsTestImage(jigsawRegions)} {
+			g := GridFromImage(img, name)
+			if !assert.NoError(t, g.SplitCells(ModeComparison), name) {
+				continue
+			}
+			g.FindConstraints()
+
+			assert.Empty(t, g.Constraints, name)
+		}
+	})
+}
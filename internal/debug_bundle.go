@@ -0,0 +1,131 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"sync"
+)
+
+// DistortionScore is a single comparison made while identifying a cell
+type DistortionScore struct {
+	Cell string `json:"cell"`
+	// "value" or "placeholder"
+	Kind string `json:"kind"`
+	// the placeholder position (1-9) within the cell, 0 for values
+	Position int `json:"position,omitempty"`
+	// the digit of the template compared against, and its name
+	Comparison           int     `json:"comparison"`
+	Template             string  `json:"template"`
+	DistortionPercentage float64 `json:"distortion_percentage"`
+}
+
+type debugFile struct {
+	name string
+	data []byte
+}
+
+// DebugBundle collects everything DebugWrite would have written to disk,
+// along with every distortion score, so a misread can be reproduced without
+// running locally with DEBUG=true. Methods are safe to call on a nil bundle,
+// which records nothing.
+type DebugBundle struct {
+	mu     sync.Mutex
+	files  []debugFile
+	scores []DistortionScore
+}
+
+func (b *DebugBundle) Add(name string, data []byte) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.files = append(b.files, debugFile{name: path.Clean(name), data: data})
+}
+
+func (b *DebugBundle) AddScore(score DistortionScore) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.scores = append(b.scores, score)
+}
+
+// Zip writes every collected file plus scores.json into a zip archive
+func (b *DebugBundle) Zip() ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for _, f := range b.files {
+		w, err := zw.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("creating %s in zip: %v", f.name, err)
+		}
+
+		if _, err := w.Write(f.data); err != nil {
+			return nil, fmt.Errorf("writing %s to zip: %v", f.name, err)
+		}
+	}
+
+	scores, err := json.MarshalIndent(b.scores, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshalling scores: %v", err)
+	}
+
+	w, err := zw.Create("scores.json")
+	if err != nil {
+		return nil, fmt.Errorf("creating scores.json in zip: %v", err)
+	}
+
+	if _, err := w.Write(scores); err != nil {
+		return nil, fmt.Errorf("writing scores.json to zip: %v", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("closing zip: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// WriteDir writes every collected file plus scores.json under dir
+func (b *DebugBundle) WriteDir(dir string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	scores, err := json.MarshalIndent(b.scores, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshalling scores: %v", err)
+	}
+
+	files := append(slices.Clone(b.files), debugFile{name: "scores.json", data: scores})
+	for _, f := range files {
+		filePath := path.Join(dir, f.name)
+		if err := os.MkdirAll(path.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("creating directory: %v", err)
+		}
+
+		if err := os.WriteFile(filePath, f.data, 0644); err != nil {
+			return fmt.Errorf("writing %s: %v", f.name, err)
+		}
+	}
+
+	return nil
+}
+
+func NewDebugBundle() *DebugBundle {
+	return &DebugBundle{}
+}
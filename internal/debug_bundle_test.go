@@ -0,0 +1,107 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugBundle_Nil(t *testing.T) {
+	var b *DebugBundle
+
+	// a grid read without a bundle records nothing
+	assert.NotPanics(t, func() {
+		b.Add("R1C1/1-crop.png", []byte("png"))
+		b.AddScore(DistortionScore{Cell: "R1C1"})
+	})
+}
+
+func newTestDebugBundle() *DebugBundle {
+	b := NewDebugBundle()
+	b.Add("R1C1/1-crop.png", []byte("crop"))
+	b.Add("./R1C1/../overlay.png", []byte("overlay"))
+	b.AddScore(DistortionScore{Cell: "R1C1", Kind: "value", Comparison: 5, Template: "5", DistortionPercentage: 1.5})
+	b.AddScore(DistortionScore{Cell: "R1C2", Kind: "placeholder", Position: 3, Comparison: 3, Template: "3", DistortionPercentage: 12})
+
+	return b
+}
+
+func TestDebugBundle_Zip(t *testing.T) {
+	b, err := newTestDebugBundle().Zip()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	files := map[string]string{}
+	var names []string
+	for _, f := range zr.File {
+		r, err := f.Open()
+		if !assert.NoError(t, err) {
+			return
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		names = append(names, f.Name)
+		files[f.Name] = string(data)
+	}
+
+	// names are cleaned, scores.json comes last
+	assert.Equal(t, []string{"R1C1/1-crop.png", "overlay.png", "scores.json"}, names)
+	assert.Equal(t, "crop", files["R1C1/1-crop.png"])
+	assert.Equal(t, "overlay", files["overlay.png"])
+
+	var scores []DistortionScore
+	if assert.NoError(t, json.Unmarshal([]byte(files["scores.json"]), &scores)) && assert.Len(t, scores, 2) {
+		assert.Equal(t, 3, scores[1].Position)
+		assert.Equal(t, 12.0, scores[1].DistortionPercentage)
+	}
+	assert.NotContains(t, files["scores.json"], `"position": 0`)
+}
+
+func TestDebugBundle_WriteDir(t *testing.T) {
+	dir := t.TempDir()
+	if !assert.NoError(t, newTestDebugBundle().WriteDir(dir)) {
+		return
+	}
+
+	for name, want := range map[string]string{"R1C1/1-crop.png": "crop", "overlay.png": "overlay"} {
+		b, err := os.ReadFile(filepath.Join(dir, name))
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, string(b))
+		}
+	}
+
+	b, err := os.ReadFile(filepath.Join(dir, "scores.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	var scores []DistortionScore
+	if assert.NoError(t, json.Unmarshal(b, &scores)) {
+		assert.Equal(t, []string{"R1C1", "R1C2"}, []string{scores[0].Cell, scores[1].Cell})
+	}
+
+	// an empty bundle still has its scores
+	empty := t.TempDir()
+	if assert.NoError(t, NewDebugBundle().WriteDir(empty)) {
+		b, err := os.ReadFile(filepath.Join(empty, "scores.json"))
+		var scores []DistortionScore
+		if assert.NoError(t, err) && assert.NoError(t, json.Unmarshal(b, &scores)) {
+			assert.Empty(t, scores)
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"slices"
+
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
+	_ "golang.org/x/image/webp"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// DecodeImage decodes a PNG, JPEG, GIF, WebP, BMP, TIFF or HEIC image,
+// telling which it is from its first bytes. Anything else is rejected before
+// ImageMagick sees it, it would otherwise guess the format and read SVG, MVG
+// or text: input that can open files and URLs on the server. A HEIC photo, a
+// TIFF Go can't read (i.e. JPEG compressed or CMYK), or a JPEG whose colours
+// aren't sRGB is converted by ImageMagick. The image is turned the way the
+// camera was held when it has an EXIF orientation.
+func DecodeImage(b []byte) (image.Image, error) {
+	format := imageFormat(b)
+	if format == "" {
+		return nil, errUnsupportedImage
+	}
+
+	if format != "HEIC" {
+		img, _, err := image.Decode(bytes.NewReader(b))
+		if err == nil && !needsColourConversion(b, img) {
+			if orientation := exifOrientation(b); orientation > 1 {
+				Logger.Debug("orienting image from its EXIF", "orientation", orientation)
+				img = orientImage(img, orientation)
+			}
+			return img, nil
+		}
+
+		if err != nil && format != "TIFF" {
+			return nil, fmt.Errorf("decoding image: %v", err)
+		}
+		Logger.Debug("falling back to ImageMagick to decode image", "format", format, "error", err)
+	}
+
+	img, err := decodeWithMagick(b, format)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %v", err)
+	}
+
+	return img, nil
+}
+
+var errUnsupportedImage = errors.New("unsupported image format")
+
+// heifBrands are the ISO BMFF brands of HEIC and HEIF images
+var heifBrands = []string{"heic", "heix", "hevc", "hevx", "heim", "heis", "mif1", "msf1"}
+
+// imageFormat is the format of b by its magic bytes, as ImageMagick names
+// it, "" when it isn't one DecodeImage reads
+func imageFormat(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return "PNG"
+	case bytes.HasPrefix(b, []byte{0xff, 0xd8, 0xff}):
+		return "JPEG"
+	case bytes.HasPrefix(b, []byte("GIF87a")), bytes.HasPrefix(b, []byte("GIF89a")):
+		return "GIF"
+	case len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WEBP":
+		return "WEBP"
+	case bytes.HasPrefix(b, []byte("BM")):
+		return "BMP"
+	case bytes.HasPrefix(b, []byte("II*\x00")), bytes.HasPrefix(b, []byte("MM\x00*")):
+		return "TIFF"
+	case len(b) >= 12 && string(b[4:8]) == "ftyp" && slices.Contains(heifBrands, string(b[8:12])):
+		return "HEIC"
+	}
+
+	return ""
+}
+
+// needsColourConversion is whether img, decoded by Go from b, isn't sRGB:
+// Go reads CMYK JPEGs without a colour profile and ignores any ICC profile
+func needsColourConversion(b []byte, img image.Image) bool {
+	if _, ok := img.(*image.CMYK); ok {
+		return true
+	}
+
+	return iccNeedsConversion(jpegICCProfile(b))
+}
+
+// decodeWithMagick converts the first frame of b, read as format, to an sRGB
+// PNG turned the way the camera says it was held, and decodes that
+func decodeWithMagick(b []byte, format string) (image.Image, error) {
+	wand := imagick.NewMagickWand()
+	defer wand.Destroy()
+
+	if err := wand.SetFormat(format); err != nil {
+		return nil, fmt.Errorf("setting format: %v", err)
+	}
+	if err := wand.ReadImageBlob(b); err != nil {
+		return nil, fmt.Errorf("reading image blob: %v", err)
+	}
+
+	wand.SetFirstIterator()
+	// ImageMagick still sniffs the blob, don't use anything it read as
+	// another format
+	if read := wand.GetImageFormat(); read != format {
+		return nil, fmt.Errorf("read %s image as %s", format, read)
+	}
+
+	if err := wand.AutoOrientImage(); err != nil {
+		return nil, fmt.Errorf("orienting image: %v", err)
+	}
+
+	if len(wand.GetImageProfile("icc")) > 0 {
+		// from the embedded profile to sRGB
+		if err := wand.ProfileImage("icc", srgbProfile); err != nil {
+			return nil, fmt.Errorf("converting to srgb profile: %v", err)
+		}
+	} else if err := wand.TransformImageColorspace(imagick.COLORSPACE_SRGB); err != nil {
+		return nil, fmt.Errorf("transforming colourspace: %v", err)
+	}
+
+	if err := wand.SetImageFormat("PNG"); err != nil {
+		return nil, fmt.Errorf("setting image format: %v", err)
+	}
+
+	blob, err := wand.GetImageBlob()
+	if err != nil {
+		return nil, fmt.Errorf("getting image blob: %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(blob))
+	if err != nil {
+		return nil, fmt.Errorf("decoding converted image: %v", err)
+	}
+
+	return img, nil
+}
+
+// jpegSegments calls each with the marker and data of every segment of a
+// JPEG before its image data, until each returns false
+func jpegSegments(b []byte, each func(marker byte, segment []byte) bool) {
+	for pos := 2; pos+4 <= len(b) && b[pos] == 0xff; {
+		marker := b[pos+1]
+		switch {
+		case marker == 0xff:
+			// fill bytes before a marker
+			pos++
+			continue
+		case marker == 0x01 || (marker >= 0xd0 && marker <= 0xd7):
+			// standalone markers have no length
+			pos += 2
+			continue
+		}
+
+		// the length counts itself
+		length := int(binary.BigEndian.Uint16(b[pos+2:]))
+		if marker == 0xda || length < 2 || pos+2+length > len(b) {
+			return
+		}
+
+		if !each(marker, b[pos+4:pos+2+length]) {
+			return
+		}
+		pos += 2 + length
+	}
+}
+
+// NormaliseImage flattens img onto white as 8-bit RGB with its origin at 0,
+// whatever it was decoded as (paletted, YCbCr, CMYK, 16-bit, transparent).
+// Transparent pixels would otherwise read as black.
+func NormaliseImage(img image.Image) *image.RGBA {
+	bounds := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, bounds.Min, draw.Over)
+
+	return dst
+}
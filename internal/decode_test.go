@@ -0,0 +1,173 @@
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+func TestDecodeImage(t *testing.T) {
+	reference, err := LoadImage("../formats/grid.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+	want := NormaliseImage(reference)
+
+	for _, tc := range []struct {
+		file string
+		// the mean difference from the PNG in each channel, out of 255
+		tolerance float64
+	}{
+		{file: "grid.jpg", tolerance: 2},
+		{file: "grid.gif"},
+		{file: "grid.webp"},
+		{file: "grid.bmp"},
+		{file: "grid.tiff"},
+		// the ink is the alpha over transparent, flattened onto white it's
+		// the same as the PNG
+		{file: "grid-transparent.png", tolerance: 0.5},
+	} {
+		t.Run(tc.file, func(t *testing.T) {
+			img, err := LoadImage("../formats/" + tc.file)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			got := NormaliseImage(img)
+			if !assert.Equal(t, want.Bounds(), got.Bounds()) {
+				return
+			}
+
+			var diff float64
+			for idx := range want.Pix {
+				diff += float64(max(want.Pix[idx], got.Pix[idx]) - min(want.Pix[idx], got.Pix[idx]))
+			}
+			assert.LessOrEqual(t, diff/float64(len(want.Pix)), tc.tolerance)
+
+			g := GridFromImage(got, tc.file)
+			if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+				return
+			}
+			assert.Equal(t, ClassicShape, g.Shape)
+		})
+	}
+
+	_, err = DecodeImage([]byte("not an image"))
+	assert.Error(t, err)
+}
+
+func TestImageFormat(t *testing.T) {
+	for file, want := range map[string]string{
+		"grid.png":       "PNG",
+		"grid.jpg":       "JPEG",
+		"grid.gif":       "GIF",
+		"grid.webp":      "WEBP",
+		"grid.bmp":       "BMP",
+		"grid.tiff":      "TIFF",
+		"grid-cmyk.tiff": "TIFF",
+	} {
+		b, err := os.ReadFile("../formats/" + file)
+		if assert.NoError(t, err) {
+			assert.Equal(t, want, imageFormat(b), file)
+		}
+	}
+
+	heic := append([]byte{0, 0, 0, 0x18}, "ftypheic\x00\x00\x00\x00mif1heic"...)
+	assert.Equal(t, "HEIC", imageFormat(heic))
+	heif := append([]byte{0, 0, 0, 0x18}, "ftypmif1\x00\x00\x00\x00mif1heic"...)
+	assert.Equal(t, "HEIC", imageFormat(heif))
+	// an MP4 is ISO BMFF too
+	assert.Equal(t, "", imageFormat(append([]byte{0, 0, 0, 0x18}, "ftypisom\x00\x00\x02\x00isomiso2"...)))
+}
+
+func TestDecodeImage_Unsupported(t *testing.T) {
+	// everything ImageMagick would guess the format of and read files or URLs
+	// from is rejected before it gets there
+	for _, b := range []string{
+		`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"><image href="file:///etc/passwd"/></svg>`,
+		`<svg width="10" height="10"><image xlink:href="https://169.254.169.254/latest/meta-data/"/></svg>`,
+		"push graphic-context\nviewbox 0 0 640 480\nimage over 0,0 0,0 'https://example.com/x.png'\npop graphic-context",
+		`<?xml version="1.0"?><image><read filename="/etc/passwd"/><write filename="/tmp/x.png"/></image>`,
+		"text:/etc/passwd",
+		"ephemeral:/app/grid.png",
+		"msl:/tmp/x.msl",
+		"",
+	} {
+		_, err := DecodeImage([]byte(b))
+		assert.ErrorIs(t, err, errUnsupportedImage, b)
+	}
+}
+
+func TestDecodeWithMagick(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	reference, err := LoadImage("../formats/grid.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+	want := NormaliseImage(reference)
+
+	jpg, err := os.ReadFile("../formats/grid.jpg")
+	if !assert.NoError(t, err) {
+		return
+	}
+	cmyk, err := os.ReadFile("../formats/grid-cmyk.tiff")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for name, tc := range map[string]struct {
+		b         []byte
+		tolerance float64
+	}{
+		// Go can't read CMYK TIFFs
+		"cmyk tiff": {b: cmyk, tolerance: 1},
+		// greys are the same in Display P3 and sRGB
+		"display p3 jpeg": {b: withJPEGICC(jpg, rgbProfile("Display P3", displayP3Colorants), 60000), tolerance: 2.5},
+	} {
+		t.Run(name, func(t *testing.T) {
+			img, err := DecodeImage(tc.b)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			got := NormaliseImage(img)
+			if !assert.Equal(t, want.Bounds(), got.Bounds()) {
+				return
+			}
+
+			var diff float64
+			for idx := range want.Pix {
+				diff += float64(max(want.Pix[idx], got.Pix[idx]) - min(want.Pix[idx], got.Pix[idx]))
+			}
+			assert.LessOrEqual(t, diff/float64(len(want.Pix)), tc.tolerance)
+		})
+	}
+
+	// a Display P3 red is more saturated than the same values as sRGB
+	patch := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	draw.Draw(patch, patch.Bounds(), image.NewUniform(color.RGBA{200, 100, 100, 255}), image.Point{}, draw.Src)
+	var buf bytes.Buffer
+	if !assert.NoError(t, jpeg.Encode(&buf, patch, &jpeg.Options{Quality: 100})) {
+		return
+	}
+	img, err := DecodeImage(withJPEGICC(buf.Bytes(), rgbProfile("Display P3", displayP3Colorants), 60000))
+	if !assert.NoError(t, err) {
+		return
+	}
+	red := NormaliseImage(img).RGBAAt(8, 8)
+	assert.Greater(t, int(red.R), 208)
+	assert.Less(t, int(red.G), 97)
+
+	// anything ImageMagick reads as another format isn't used
+	_, err = decodeWithMagick(jpg, "TIFF")
+	assert.Error(t, err)
+}
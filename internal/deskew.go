@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+)
+
+const (
+	// the largest rotation corrected, in degrees either way
+	maxDeskew = 5.0
+	// angles are tried this far apart, then again more finely around the
+	// best of them
+	coarseDeskewStep = 0.2
+	fineDeskewStep   = 0.02
+	// smaller rotations are left alone, resampling blurs the glyphs the
+	// templates were cut from
+	minDeskew = 0.1
+	// only every deskewSample-th pixel along each axis is used to find the
+	// angle
+	deskewSample = 2
+)
+
+// skewAngle estimates how far the lines in img are turned from horizontal, in
+// degrees clockwise. Every ink pixel (see Binarise) is projected onto the
+// vertical axis as though the image was turned back by each angle tried, the
+// grid lines pile up into the sharpest peaks at the right one.
+func skewAngle(img image.Image) float64 {
+	bounds := img.Bounds()
+	mask := Binarise(img)
+	points := make([][2]float64, 0)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y += deskewSample {
+		for x := bounds.Min.X; x < bounds.Max.X; x += deskewSample {
+			if mask.Ink(x, y) {
+				points = append(points, [2]float64{float64(x - bounds.Min.X), float64(y - bounds.Min.Y)})
+			}
+		}
+	}
+
+	if len(points) == 0 {
+		return 0
+	}
+
+	// bins as wide as the sampling, narrower ones would be left empty
+	// between the sampled rows at 0 and make it look sharpest
+	diagonal := math.Hypot(float64(bounds.Dx()), float64(bounds.Dy()))
+	profile := make([]int, int(diagonal)*2/deskewSample+1)
+	sharpness := func(degrees float64) float64 {
+		clear(profile)
+		sin, cos := math.Sincos(degrees * math.Pi / 180)
+		for _, p := range points {
+			profile[int((p[1]*cos-p[0]*sin+diagonal)/deskewSample)] += 1
+		}
+
+		var sum float64
+		for _, count := range profile {
+			sum += float64(count) * float64(count)
+		}
+		return sum
+	}
+
+	best := func(from, to, step float64) float64 {
+		angle, score := 0.0, -1.0
+		for degrees := from; degrees <= to+step/2; degrees += step {
+			if s := sharpness(degrees); s > score {
+				angle, score = degrees, s
+			}
+		}
+		return angle
+	}
+
+	coarse := best(-maxDeskew, maxDeskew, coarseDeskewStep)
+	return best(coarse-coarseDeskewStep, coarse+coarseDeskewStep, fineDeskewStep)
+}
+
+// rotate turns img by degrees clockwise about its centre onto white, keeping
+// its size. Pixels are sampled bilinearly.
+func rotate(img image.Image, degrees float64) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	cx, cy := float64(w)/2, float64(h)/2
+	// each pixel of dst is taken from the point it came from, turned back
+	sin, cos := math.Sincos(-degrees * math.Pi / 180)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dx, dy := float64(x)+0.5-cx, float64(y)+0.5-cy
+			sx, sy := dx*cos-dy*sin+cx-0.5, dx*sin+dy*cos+cy-0.5
+
+			x0, y0 := int(math.Floor(sx)), int(math.Floor(sy))
+			if x0 < 0 || y0 < 0 || x0+1 >= w || y0+1 >= h {
+				continue
+			}
+
+			fx, fy := sx-float64(x0), sy-float64(y0)
+			i := dst.PixOffset(x, y)
+			for channel := range 4 {
+				at := func(x, y int) float64 { return float64(src.Pix[src.PixOffset(x, y)+channel]) }
+				top := at(x0, y0)*(1-fx) + at(x0+1, y0)*fx
+				bottom := at(x0, y0+1)*(1-fx) + at(x0+1, y0+1)*fx
+				dst.Pix[i+channel] = uint8(math.Round(top*(1-fy) + bottom*fy))
+			}
+		}
+	}
+
+	return dst
+}
+
+// Deskew straightens a scan or photo that's slightly turned, up to maxDeskew
+// degrees either way. It returns the straightened image and the rotation
+// applied, in degrees clockwise. Images that are already straight are
+// returned as they are with an angle of 0.
+func Deskew(img image.Image) (image.Image, float64) {
+	angle := skewAngle(img)
+	if math.Abs(angle) < minDeskew {
+		return img, 0
+	}
+
+	// round away the float steps, i.e. 1.2000000000000002
+	correction := math.Round(-angle*100) / 100
+	return rotate(img, correction), correction
+}
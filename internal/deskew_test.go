@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeskew(t *testing.T) {
+	for idx, degrees := range []float64{-4, 1.5, 3} {
+		p := fmt.Sprintf("../grids/%d/grid.png", idx+1)
+		t.Run(fmt.Sprintf("%s turned %.1f degrees", p, degrees), func(t *testing.T) {
+			img, err := LoadImage(p)
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			straight, angle := Deskew(img)
+			assert.Equal(t, 0.0, angle)
+			assert.Same(t, img, straight)
+
+			// with a margin like a scanned page, the screenshot's corners
+			// would be turned out of frame
+			padded := image.NewRGBA(img.Bounds().Inset(-120))
+			draw.Draw(padded, padded.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+			draw.Draw(padded, img.Bounds(), img, img.Bounds().Min, draw.Src)
+			turned := rotate(padded, degrees)
+			straight, angle = Deskew(turned)
+			assert.InDelta(t, -degrees, angle, 0.1)
+
+			g := GridFromImage(straight, p)
+			if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+				return
+			}
+
+			assert.Equal(t, ClassicShape, g.Shape)
+			assert.InDelta(t, 116, g.cellWidth, 2)
+			assert.InDelta(t, 116, g.cellHeight, 2)
+		})
+	}
+}
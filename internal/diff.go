@@ -0,0 +1,201 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// how far apart (in any channel, out of 255) a cell's background colours
+// have to be for its highlight to have changed
+const highlightTolerance = 24
+
+// errDifferentPuzzles is returned by CompareGrids when the grids aren't of the
+// same puzzle
+var errDifferentPuzzles = errors.New("not the same puzzle")
+
+// MoveType is what a player did to a cell between two reads of a grid
+type MoveType string
+
+const (
+	MovePlaced      MoveType = "placed"
+	MoveErased      MoveType = "erased"
+	MoveMarkAdded   MoveType = "mark_added"
+	MoveMarkRemoved MoveType = "mark_removed"
+)
+
+// Move is a value or pencil mark written in, or taken out of, a cell
+type Move struct {
+	Type MoveType `json:"type"`
+	// the cell's identifier, i.e. R1C1
+	Cell  string `json:"cell"`
+	Value int    `json:"value"`
+	// "corner" or "centre" for pencil marks, empty in ocr mode where the
+	// two aren't told apart
+	Mark string `json:"mark,omitempty"`
+}
+
+// DiffGrids lists the moves that turn before into after, cell by cell.
+// Changing a value is an erase and a place. The pencil marks of a cell that
+// holds a value on either side aren't compared, a value hides them rather
+// than removing them.
+func DiffGrids(before, after *Grid) ([]Move, error) {
+	if before.Shape.Size != after.Shape.Size || len(before.Cells) != len(after.Cells) {
+		return nil, fmt.Errorf("grid sizes differ, %d and %d", before.Shape.Size, after.Shape.Size)
+	}
+
+	var moves []Move
+	for r, row := range after.Cells {
+		for c, cell := range row {
+			moves = append(moves, diffCell(before.Cells[r][c], cell)...)
+		}
+	}
+
+	return moves, nil
+}
+
+func diffCell(before, after *Cell) []Move {
+	var moves []Move
+	bt, bval, _ := before.Contents()
+	at, aval, _ := after.Contents()
+
+	if bt == CellTypeValue && (at != CellTypeValue || aval != bval) {
+		moves = append(moves, Move{Type: MoveErased, Cell: after.Identifier, Value: bval})
+	}
+	if at == CellTypeValue && (bt != CellTypeValue || aval != bval) {
+		moves = append(moves, Move{Type: MovePlaced, Cell: after.Identifier, Value: aval})
+	}
+	if bt == CellTypeValue || at == CellTypeValue {
+		return moves
+	}
+
+	beforeMarks, afterMarks := cellMarks(before), cellMarks(after)
+	for _, kind := range []string{"corner", "centre", ""} {
+		for _, v := range beforeMarks[kind] {
+			if !slices.Contains(afterMarks[kind], v) {
+				moves = append(moves, Move{Type: MoveMarkRemoved, Cell: after.Identifier, Value: v, Mark: kind})
+			}
+		}
+		for _, v := range afterMarks[kind] {
+			if !slices.Contains(beforeMarks[kind], v) {
+				moves = append(moves, Move{Type: MoveMarkAdded, Cell: after.Identifier, Value: v, Mark: kind})
+			}
+		}
+	}
+
+	return moves
+}
+
+// cellMarks are the cell's pencil marks by the Move.Mark they're written as
+func cellMarks(c *Cell) map[string][]int {
+	if c.mode == ModeOCR {
+		_, _, placeholders := c.Contents()
+		return map[string][]int{"": placeholders}
+	}
+
+	corner, centre := c.Marks()
+	return map[string][]int{"corner": corner, "centre": centre}
+}
+
+// HighlightChange is a cell highlighted, unhighlighted or highlighted in
+// another colour
+type HighlightChange struct {
+	Cell string `json:"cell"`
+	// the cell's background colours, i.e. #ffffff
+	Before string `json:"before"`
+	After  string `json:"after"`
+}
+
+// GridDiff is what changed between two screenshots of a puzzle
+type GridDiff struct {
+	Moves      []Move
+	Highlights []HighlightChange
+	Before     *Grid
+	After      *Grid
+}
+
+func (d *GridDiff) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Moves      []Move            `json:"moves"`
+		Highlights []HighlightChange `json:"highlights"`
+		Before     gridJSON          `json:"before"`
+		After      gridJSON          `json:"after"`
+	}{d.Moves, d.Highlights, d.Before.toJSON(), d.After.toJSON()})
+}
+
+// CompareGrids lists the moves made and the highlights changed between two
+// screenshots of a puzzle, after checking they're of the same one (see
+// samePuzzle)
+func CompareGrids(before, after *Grid) (*GridDiff, error) {
+	if err := samePuzzle(before, after); err != nil {
+		return nil, err
+	}
+
+	moves, err := DiffGrids(before, after)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &GridDiff{Moves: moves, Highlights: []HighlightChange{}, Before: before, After: after}
+	if d.Moves == nil {
+		d.Moves = []Move{}
+	}
+
+	for r, row := range after.Cells {
+		for c, cell := range row {
+			was, is := before.Cells[r][c].Background(), cell.Background()
+			if colourDistance(was, is) > highlightTolerance {
+				d.Highlights = append(d.Highlights, HighlightChange{Cell: cell.Identifier, Before: hexColour(was), After: hexColour(is)})
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// samePuzzle checks that two grids are of the same puzzle. Givens can't be
+// told from entered digits, so the values in both grids are compared instead:
+// they hold the givens, which can't change, and any digit entered in both that
+// the player hasn't overwritten since. A quarter of them can differ. Puzzles
+// with givens have at least as many as the grid is wide. Killer puzzles can
+// have none, their cages have to match instead.
+func samePuzzle(before, after *Grid) error {
+	if before.Shape != after.Shape || len(before.Cells) != len(after.Cells) {
+		return fmt.Errorf("%w: %dx%d and %dx%d grids", errDifferentPuzzles, before.Shape.Size, before.Shape.Size, after.Shape.Size, after.Shape.Size)
+	}
+
+	sameCage := func(a, b Cage) bool {
+		return a.Sum == b.Sum && slices.Equal(a.Cells, b.Cells)
+	}
+	if !slices.EqualFunc(before.Cages, after.Cages, sameCage) {
+		return fmt.Errorf("%w: the killer cages differ", errDifferentPuzzles)
+	}
+
+	var shared int
+	var differ []string
+	for r, row := range after.Cells {
+		for c, cell := range row {
+			bt, bval, _ := before.Cells[r][c].Contents()
+			at, aval, _ := cell.Contents()
+			if bt != CellTypeValue || at != CellTypeValue {
+				continue
+			}
+
+			shared++
+			if aval != bval {
+				differ = append(differ, cell.Identifier)
+			}
+		}
+	}
+
+	if len(before.Cages) == 0 && shared < before.Shape.Size {
+		return fmt.Errorf("%w: only %d cells hold a value in both", errDifferentPuzzles, shared)
+	}
+	if len(differ)*4 > shared {
+		return fmt.Errorf("%w: %s hold different values", errDifferentPuzzles, strings.Join(differ, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newCornerTestGrid is a 4x4 grid holding label in its top left cell
+func newCornerTestGrid(label string, mode Mode) *Grid {
+	rows := make([][]string, 4)
+	for idx := range rows {
+		rows[idx] = make([]string, 4)
+	}
+	rows[0][0] = label
+
+	return newTestGrid(rows, mode)
+}
+
+func TestDiffGrids(t *testing.T) {
+	before := newTestGrid([][]string{
+		{"5", "3", "p12", "", "7", "", "", "", ""},
+		{"6", "", "", "p48", "9", "5", "", "", ""},
+		{"", "9", "8", "", "", "", "", "6", ""},
+		{"8", "", "", "", "6", "", "", "", "3"},
+		{"4", "", "", "8", "", "3", "", "", "1"},
+		{"7", "", "", "", "2", "", "", "", "6"},
+		{"", "6", "", "", "", "", "2", "8", ""},
+		{"", "", "", "4", "1", "9", "", "", "5"},
+		{"", "", "", "", "8", "", "", "7", "9"},
+	}, ModeComparison)
+
+	after := newTestGrid([][]string{
+		// a 4 placed over pencil marks, a 1 put in as a pencil mark
+		{"5", "3", "4", "p1", "7", "", "", "", ""},
+		// an 8 taken out of the pencil marks
+		{"6", "", "", "p4", "9", "5", "", "", ""},
+		// a 1 placed then changed to 2
+		{"2", "9", "8", "", "", "", "", "6", ""},
+		{"8", "", "", "", "6", "", "", "", "3"},
+		{"4", "", "", "8", "", "3", "", "", "1"},
+		{"7", "", "", "", "2", "", "", "", "6"},
+		{"", "6", "", "", "", "", "2", "8", ""},
+		{"", "", "", "4", "1", "9", "", "", "5"},
+		{"", "", "", "", "8", "", "", "7", "9"},
+	}, ModeComparison)
+
+	moves, err := DiffGrids(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, []Move{
+		{Type: MovePlaced, Cell: "R1C3", Value: 4},
+		{Type: MoveMarkAdded, Cell: "R1C4", Value: 1, Mark: "corner"},
+		{Type: MoveMarkRemoved, Cell: "R2C4", Value: 8, Mark: "corner"},
+		{Type: MovePlaced, Cell: "R3C1", Value: 2},
+	}, moves)
+
+	t.Run("changed value", func(t *testing.T) {
+		changed := newCornerTestGrid("1", ModeComparison)
+		was := newCornerTestGrid("2", ModeComparison)
+
+		moves, err := DiffGrids(was, changed)
+		assert.NoError(t, err)
+		assert.Equal(t, []Move{
+			{Type: MoveErased, Cell: "R1C1", Value: 2},
+			{Type: MovePlaced, Cell: "R1C1", Value: 1},
+		}, moves)
+	})
+
+	t.Run("corner mark moved to the centre", func(t *testing.T) {
+		corner := newCornerTestGrid("p3", ModeComparison)
+		centre := newCornerTestGrid("p3", ModeComparison)
+		centre.Cells[0][0].cornerMarks, centre.Cells[0][0].centreMarks = nil, []int{3}
+
+		moves, err := DiffGrids(corner, centre)
+		assert.NoError(t, err)
+		assert.Equal(t, []Move{
+			{Type: MoveMarkRemoved, Cell: "R1C1", Value: 3, Mark: "corner"},
+			{Type: MoveMarkAdded, Cell: "R1C1", Value: 3, Mark: "centre"},
+		}, moves)
+	})
+
+	t.Run("ocr marks", func(t *testing.T) {
+		moves, err := DiffGrids(
+			newCornerTestGrid("p3", ModeOCR),
+			newCornerTestGrid("p34", ModeOCR),
+		)
+		assert.NoError(t, err)
+		assert.Equal(t, []Move{{Type: MoveMarkAdded, Cell: "R1C1", Value: 4}}, moves)
+	})
+
+	t.Run("different sizes", func(t *testing.T) {
+		_, err := DiffGrids(before, newCornerTestGrid("", ModeComparison))
+		assert.Error(t, err)
+	})
+}
+
+func TestCompareGrids(t *testing.T) {
+	before := newFormatTestGrid()
+	after := newFormatTestGrid()
+	// a 4 placed and an entered 7 overwritten with a 9
+	after.Cells[0][3].comparisonValue = 4
+	after.Cells[1][0].comparisonValue = 9
+	// the cell in R1C4 highlighted
+	highlighted := NewGridImage(filledRGBA(image.Rect(0, 0, 20, 20), color.RGBA{255, 218, 0, 255}), "R1C4")
+	after.Cells[0][3].image = highlighted
+
+	diff, err := CompareGrids(before, after)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, []Move{
+		{Type: MovePlaced, Cell: "R1C4", Value: 4},
+		{Type: MoveErased, Cell: "R2C1", Value: 7},
+		{Type: MovePlaced, Cell: "R2C1", Value: 9},
+	}, diff.Moves)
+	assert.Equal(t, []HighlightChange{{Cell: "R1C4", Before: "#ffffff", After: "#ffda00"}}, diff.Highlights)
+
+	t.Run("another puzzle", func(t *testing.T) {
+		other := newFormatTestGrid()
+		for _, id := range []string{"R1C2", "R1C5", "R1C7", "R1C9", "R2C1", "R2C3", "R2C4", "R2C5"} {
+			var r, c int
+			fmt.Sscanf(id, "R%dC%d", &r, &c)
+			other.Cells[r-1][c-1].comparisonValue = other.Cells[r-1][c-1].comparisonValue%9 + 1
+		}
+
+		_, err := CompareGrids(before, other)
+		assert.ErrorIs(t, err, errDifferentPuzzles)
+	})
+
+	t.Run("no values in common", func(t *testing.T) {
+		empty := make([][]string, 9)
+		for idx := range empty {
+			empty[idx] = make([]string, 9)
+		}
+
+		_, err := CompareGrids(before, newTestGrid(empty, ModeComparison))
+		assert.ErrorIs(t, err, errDifferentPuzzles)
+	})
+
+	t.Run("killer cages", func(t *testing.T) {
+		cages := []Cage{{Cells: []string{"R1C1", "R1C2"}, Sum: 9}}
+		a, b := newCornerTestGrid("", ModeComparison), newCornerTestGrid("3", ModeComparison)
+		a.Cages, b.Cages = cages, cages
+
+		diff, err := CompareGrids(a, b)
+		if assert.NoError(t, err) {
+			assert.Equal(t, []Move{{Type: MovePlaced, Cell: "R1C1", Value: 3}}, diff.Moves)
+		}
+
+		b.Cages = []Cage{{Cells: []string{"R1C1", "R1C2"}, Sum: 10}}
+		_, err = CompareGrids(a, b)
+		assert.ErrorIs(t, err, errDifferentPuzzles)
+	})
+}
@@ -0,0 +1,276 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"sort"
+	"time"
+)
+
+type PrecisionRecall struct {
+	TruePositives  int     `json:"true_positives"`
+	FalsePositives int     `json:"false_positives"`
+	FalseNegatives int     `json:"false_negatives"`
+	Precision      float64 `json:"precision"`
+	Recall         float64 `json:"recall"`
+}
+
+type LatencyStats struct {
+	MeanMs float64 `json:"mean_ms"`
+	P50Ms  float64 `json:"p50_ms"`
+	P95Ms  float64 `json:"p95_ms"`
+	MaxMs  float64 `json:"max_ms"`
+}
+
+type GridEvaluation struct {
+	Name         string  `json:"name"`
+	CorrectCells int     `json:"correct_cells"`
+	Cells        int     `json:"cells"`
+	LatencyMs    float64 `json:"latency_ms"`
+	Error        string  `json:"error,omitempty"`
+}
+
+// Evaluation is the aggregate accuracy of a recognizer over a corpus, it's
+// written as JSON so results can be compared across commits
+type Evaluation struct {
+	Recognizer Mode      `json:"recognizer"`
+	Corpus     string    `json:"corpus"`
+	Revision   string    `json:"revision,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+
+	Grids       int `json:"grids"`
+	GridsFailed int `json:"grids_failed"`
+	// fraction of grids where every cell was read correctly
+	GridAccuracy float64 `json:"grid_accuracy"`
+	// fraction of cells read correctly, failed grids count as all wrong
+	CellAccuracy float64 `json:"cell_accuracy"`
+
+	CellTypes map[CellType]*PrecisionRecall `json:"cell_types"`
+	// DigitConfusion[truth][predicted] counts value cells, index 0 is used
+	// when the truth or the prediction wasn't a value. Values over 9 (in
+	// grids larger than 9x9) aren't counted.
+	DigitConfusion [10][10]int `json:"digit_confusion"`
+
+	PlaceholderCells      int     `json:"placeholder_cells"`
+	PlaceholderExactMatch float64 `json:"placeholder_exact_match"`
+
+	Latency LatencyStats     `json:"latency"`
+	PerGrid []GridEvaluation `json:"per_grid"`
+
+	correctCells      int
+	totalCells        int
+	correctGrids      int
+	placeholdersExact int
+	latencies         []time.Duration
+}
+
+func newEvaluation(recognizer Mode, corpus string) *Evaluation {
+	e := &Evaluation{
+		Recognizer: recognizer,
+		Corpus:     corpus,
+		StartedAt:  time.Now().UTC(),
+		CellTypes: map[CellType]*PrecisionRecall{
+			CellTypeValue:        {},
+			CellTypePlaceholders: {},
+			CellTypeEmpty:        {},
+		},
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				e.Revision = s.Value
+			}
+		}
+	}
+
+	return e
+}
+
+func (e *Evaluation) addFailure(name string, cells int, latency time.Duration, err error) {
+	e.Grids += 1
+	e.GridsFailed += 1
+	e.totalCells += cells
+	e.latencies = append(e.latencies, latency)
+	e.PerGrid = append(e.PerGrid, GridEvaluation{
+		Name:      name,
+		Cells:     cells,
+		LatencyMs: float64(latency.Microseconds()) / 1000,
+		Error:     err.Error(),
+	})
+}
+
+func (e *Evaluation) addGrid(name string, truth [][]string, g *Grid, latency time.Duration) error {
+	if len(truth) != len(g.Cells) {
+		return fmt.Errorf("%s: truth table is %dx%d, grid read as %s", name, len(truth), len(truth), g.Shape)
+	}
+
+	var correct int
+
+	for rIdx, row := range g.Cells {
+		for cIdx, cell := range row {
+			truthType, truthVal, truthPlaceholders, err := ParseLabel(truth[rIdx][cIdx])
+			if err != nil {
+				return fmt.Errorf("%s %s: %v", name, cell.Identifier, err)
+			}
+			predType, predVal, predPlaceholders := cell.Contents()
+
+			if predType == truthType {
+				e.CellTypes[truthType].TruePositives += 1
+			} else {
+				e.CellTypes[truthType].FalseNegatives += 1
+				e.CellTypes[predType].FalsePositives += 1
+			}
+
+			if (truthType == CellTypeValue || predType == CellTypeValue) && truthVal <= 9 && predVal <= 9 {
+				e.DigitConfusion[max(0, truthVal)][max(0, predVal)] += 1
+			}
+
+			if truthType == CellTypePlaceholders {
+				e.PlaceholderCells += 1
+				if predType == CellTypePlaceholders && slices.Equal(truthPlaceholders, predPlaceholders) {
+					e.placeholdersExact += 1
+				}
+			}
+
+			if cell.Label() == truth[rIdx][cIdx] {
+				correct += 1
+			}
+		}
+	}
+
+	e.Grids += 1
+	e.correctCells += correct
+	e.totalCells += len(truth) * len(truth)
+	if correct == len(truth)*len(truth) {
+		e.correctGrids += 1
+	}
+	e.latencies = append(e.latencies, latency)
+	e.PerGrid = append(e.PerGrid, GridEvaluation{
+		Name:         name,
+		CorrectCells: correct,
+		Cells:        len(truth) * len(truth),
+		LatencyMs:    float64(latency.Microseconds()) / 1000,
+	})
+
+	return nil
+}
+
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b)
+}
+
+func (e *Evaluation) finish() {
+	e.GridAccuracy = ratio(e.correctGrids, e.Grids)
+	e.CellAccuracy = ratio(e.correctCells, e.totalCells)
+	e.PlaceholderExactMatch = ratio(e.placeholdersExact, e.PlaceholderCells)
+
+	for _, pr := range e.CellTypes {
+		pr.Precision = ratio(pr.TruePositives, pr.TruePositives+pr.FalsePositives)
+		pr.Recall = ratio(pr.TruePositives, pr.TruePositives+pr.FalseNegatives)
+	}
+
+	if len(e.latencies) == 0 {
+		return
+	}
+
+	sorted := slices.Clone(e.latencies)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	ms := func(d time.Duration) float64 { return float64(d.Microseconds()) / 1000 }
+	var total time.Duration
+	for _, l := range sorted {
+		total += l
+	}
+
+	e.Latency = LatencyStats{
+		MeanMs: ms(total / time.Duration(len(sorted))),
+		P50Ms:  ms(sorted[len(sorted)*50/100]),
+		P95Ms:  ms(sorted[min(len(sorted)-1, len(sorted)*95/100)]),
+		MaxMs:  ms(sorted[len(sorted)-1]),
+	}
+}
+
+// LoadTruthTable reads a truth.json, a square array of cell labels (9x9 for
+// a classic grid)
+func LoadTruthTable(p string) ([][]string, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading truth table: %v", err)
+	}
+
+	var truth [][]string
+	if err := json.Unmarshal(b, &truth); err != nil {
+		return nil, fmt.Errorf("decoding truth table: %v", err)
+	}
+
+	if _, err := ShapeForSize(len(truth)); err != nil {
+		return nil, fmt.Errorf("truth table has %d rows: %v", len(truth), err)
+	}
+	for idx, row := range truth {
+		if len(row) != len(truth) {
+			return nil, fmt.Errorf("expected %d columns in truth table row %d, got %d", len(truth), idx+1, len(row))
+		}
+	}
+
+	return truth, nil
+}
+
+// Evaluate reads every grid in corpus with the given recognizer and compares
+// it against its truth table. The corpus holds one directory per grid, each
+// containing a grid.png and truth.json, the same layout as grids/.
+func Evaluate(corpus string, recognizer Mode, worker *GridWorker) (*Evaluation, error) {
+	entries, err := os.ReadDir(corpus)
+	if err != nil {
+		return nil, fmt.Errorf("reading corpus directory: %v", err)
+	}
+
+	e := newEvaluation(recognizer, corpus)
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(corpus, entry.Name())
+		truth, err := LoadTruthTable(filepath.Join(dir, "truth.json"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+
+		img, err := LoadImage(filepath.Join(dir, "grid.png"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+
+		start := time.Now()
+		g, err := ReadGrid(img, entry.Name(), worker, ReadOptions{Mode: recognizer})
+		latency := time.Since(start)
+
+		Logger.Debug("evaluated grid", "grid_id", entry.Name(), "latency", latency, "error", err)
+
+		if err != nil {
+			e.addFailure(entry.Name(), len(truth)*len(truth), latency, err)
+			continue
+		}
+
+		if err := e.addGrid(entry.Name(), truth, g, latency); err != nil {
+			return nil, err
+		}
+	}
+
+	if e.Grids == 0 {
+		return nil, fmt.Errorf("no grids found in %s", corpus)
+	}
+
+	e.finish()
+
+	return e, nil
+}
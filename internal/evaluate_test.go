@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvaluation_AddGrid(t *testing.T) {
+	truth := [][]string{
+		{"p123479", "3", "p12", "", "1", "", "2", "", "6"},
+		{"7", "p1", "5", "2", "6", "9", "", "", ""},
+		{"p89", "p159", "p45", "3", "8", "", "7", "4", ""},
+		{"5", "", "", "", "", "", "", "8", "2"},
+		{"2", "1", "", "4", "", "3", "", "", ""},
+		{"", "6", "7", "5", "", "", "", "", ""},
+		{"", "", "9", "1", "", "", "4", "5", ""},
+		{"", "", "1", "7", "", "4", "9", "", ""},
+		{"", "", "", "", "", "", "", "", ""},
+	}
+
+	predicted := [][]string{
+		// R1C1 lost a placeholder, R1C2 misread 3 as 8
+		{"p12347", "8", "p12", "", "1", "", "2", "", "6"},
+		{"7", "p1", "5", "2", "6", "9", "", "", ""},
+		// R3C3 read as empty
+		{"p89", "p159", "", "3", "8", "", "7", "4", ""},
+		{"5", "", "", "", "", "", "", "8", "2"},
+		{"2", "1", "", "4", "", "3", "", "", ""},
+		{"", "6", "7", "5", "", "", "", "", ""},
+		{"", "", "9", "1", "", "", "4", "5", ""},
+		// R8C9 picked up a value that isn't there
+		{"", "", "1", "7", "", "4", "9", "", "3"},
+		{"", "", "", "", "", "", "", "", ""},
+	}
+
+	e := newEvaluation(ModeComparison, "test")
+	assert.NoError(t, e.addGrid("perfect", truth, newTestGrid(truth, ModeComparison), time.Second))
+	assert.NoError(t, e.addGrid("misread", truth, newTestGrid(predicted, ModeComparison), 3*time.Second))
+	e.finish()
+
+	assert.Equal(t, 2, e.Grids)
+	assert.Equal(t, 0.5, e.GridAccuracy)
+	assert.Equal(t, float64(81*2-4)/float64(81*2), e.CellAccuracy)
+
+	assert.Equal(t, 5, e.DigitConfusion[3][3])
+	assert.Equal(t, 1, e.DigitConfusion[3][8])
+	assert.Equal(t, 1, e.DigitConfusion[0][3])
+
+	value := e.CellTypes[CellTypeValue]
+	assert.Equal(t, 1, value.FalsePositives)
+	assert.Equal(t, 0, value.FalseNegatives)
+
+	placeholders := e.CellTypes[CellTypePlaceholders]
+	assert.Equal(t, 1, placeholders.FalseNegatives)
+	assert.Equal(t, 12, e.PlaceholderCells)
+	assert.Equal(t, float64(10)/float64(12), e.PlaceholderExactMatch)
+
+	assert.Equal(t, 2000.0, e.Latency.MeanMs)
+	assert.Equal(t, 3000.0, e.Latency.MaxMs)
+}
@@ -0,0 +1,120 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// the largest image read from a url or a json body
+	maxImageBytes = 10 << 20
+	// how long fetching an image from a url may take, start to finish
+	imageFetchTimeout = 10 * time.Second
+	maxImageRedirects = 5
+)
+
+var (
+	errURLNotAllowed = errors.New("url not allowed")
+	errImageTooLarge = errors.New("image too large")
+)
+
+// imageFetcher downloads images from the hosts on its allow-list
+type imageFetcher struct {
+	client *http.Client
+	// host names (i.e. cdn.discordapp.com) or host:port pairs images may be
+	// fetched from, nothing can be fetched when it's empty
+	allowedHosts []string
+	maxBytes     int64
+}
+
+// allowedImageHosts are the hosts in the comma separated
+// IMAGE_URL_ALLOWED_HOSTS env var
+func allowedImageHosts() []string {
+	var hosts []string
+	for _, h := range strings.Split(os.Getenv("IMAGE_URL_ALLOWED_HOSTS"), ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, strings.ToLower(h))
+		}
+	}
+
+	return hosts
+}
+
+// newImageFetcher fetches images from allowedHosts, following redirects that
+// stay on them
+func newImageFetcher(allowedHosts []string) *imageFetcher {
+	f := &imageFetcher{allowedHosts: allowedHosts, maxBytes: maxImageBytes}
+	f.client = &http.Client{
+		Timeout: imageFetchTimeout,
+		// each redirect has to stay on the allow-list
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxImageRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxImageRedirects)
+			}
+			return f.check(req.URL)
+		},
+	}
+
+	return f
+}
+
+// check reports whether images may be fetched from u
+func (f *imageFetcher) check(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q, expected http or https", errURLNotAllowed, u.Scheme)
+	}
+
+	host, hostname := strings.ToLower(u.Host), strings.ToLower(u.Hostname())
+	for _, allowed := range f.allowedHosts {
+		if allowed == host || allowed == hostname {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %s isn't an allowed host", errURLNotAllowed, hostname)
+}
+
+// fetch downloads the image at u, up to maxBytes of it
+func (f *imageFetcher) fetch(ctx context.Context, u *url.URL) ([]byte, error) {
+	if err := f.check(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %v", err)
+	}
+
+	res, err := f.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching image: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching image: unexpected status %s", res.Status)
+	}
+
+	if res.ContentLength > f.maxBytes {
+		return nil, fmt.Errorf("%w: %d bytes, expected at most %d", errImageTooLarge, res.ContentLength, f.maxBytes)
+	}
+
+	// a byte past the limit tells a body that's too large from one that fits
+	b, err := io.ReadAll(io.LimitReader(res.Body, f.maxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading image: %v", err)
+	}
+
+	if int64(len(b)) > f.maxBytes {
+		return nil, fmt.Errorf("%w: expected at most %d bytes", errImageTooLarge, f.maxBytes)
+	}
+
+	return b, nil
+}
@@ -0,0 +1,442 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	// our own JSON representation, see gridJSON
+	FormatJSON Format = "json"
+	// a character per cell (81 for a classic grid), left to right, top to
+	// bottom, "." for empty cells
+	FormatLine Format = "line"
+	// SadMan Software .sdk, a line of characters per row
+	FormatSDK Format = "sdk"
+	// HoDoKu/SudokuWiki pencil mark (candidate) grid, classic grids only
+	FormatHoDoKu Format = "hodoku"
+	// Sudoku Exchange puzzle string wrapped in JSON, see sudokuExchangeJSON,
+	// classic grids only
+	FormatSudokuExchange Format = "sudoku-exchange"
+	// human readable grid with box borders
+	FormatPretty Format = "pretty"
+	// f-puzzles JSON, includes killer cages and both kinds of pencil marks,
+	// see fpuzzlesJSON
+	FormatFPuzzles Format = "fpuzzles"
+)
+
+// none of the text formats have a registered media type
+var formatContentTypes = map[Format]string{
+	FormatJSON:           "application/json",
+	FormatLine:           "text/plain",
+	FormatSDK:            "text/plain",
+	FormatHoDoKu:         "text/plain",
+	FormatSudokuExchange: "application/json",
+	FormatPretty:         "text/plain",
+	FormatFPuzzles:       "application/json",
+}
+
+// the formats an Accept header picks, the others share their media type so
+// are only picked by name
+var acceptFormats = []Format{FormatJSON, FormatLine}
+
+// errUnsupportedShape is returned by Encode for a grid the format can't hold
+var errUnsupportedShape = errors.New("unsupported grid shape")
+
+func (f Format) ContentType() string {
+	return formatContentTypes[f] + "; charset=utf-8"
+}
+
+// ParseFormat validates a format name, i.e. the ?format= query parameter
+func ParseFormat(s string) (Format, error) {
+	f := Format(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := formatContentTypes[f]; !ok {
+		return "", fmt.Errorf("unsupported format %q", s)
+	}
+
+	return f, nil
+}
+
+// FormatFromAccept picks the first format listed in an Accept header,
+// falling back to FormatJSON when nothing we know of is listed.
+// Quality values are ignored, clients are expected to list their
+// preference first.
+func FormatFromAccept(accept string) Format {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		for _, f := range acceptFormats {
+			if formatContentTypes[f] == mediaType {
+				return f
+			}
+		}
+	}
+
+	return FormatJSON
+}
+
+// Encode renders the grid in the given format
+func (g *Grid) Encode(f Format) ([]byte, error) {
+	if (f == FormatHoDoKu || f == FormatSudokuExchange) && g.Shape != ClassicShape {
+		return nil, fmt.Errorf("%w: format %q only supports 9x9 grids, this grid is %s", errUnsupportedShape, f, g.Shape)
+	}
+
+	switch f {
+	case FormatJSON:
+		return json.Marshal(g.toJSON())
+	case FormatLine:
+		return []byte(g.String() + "\n"), nil
+	case FormatSDK:
+		return g.encodeSDK(), nil
+	case FormatHoDoKu:
+		return g.encodeHoDoKu(), nil
+	case FormatSudokuExchange:
+		return json.Marshal(g.toSudokuExchange())
+	case FormatPretty:
+		return g.encodePretty(), nil
+	case FormatFPuzzles:
+		return json.Marshal(g.toFPuzzles())
+	}
+
+	return nil, fmt.Errorf("unsupported format %q", f)
+}
+
+type cellJSON struct {
+	Identifier   string   `json:"identifier"`
+	Type         CellType `json:"type"`
+	Val          int      `json:"val"`
+	Placeholders []int    `json:"placeholders"`
+	// the placeholders split by how they were written, NYT style marks at the
+	// position of their digit are corner marks
+	CornerMarks []int `json:"corner_marks"`
+	CentreMarks []int `json:"centre_marks"`
+}
+
+type gridJSON struct {
+	ID                      string       `json:"id"`
+	CharacterRepresentation string       `json:"character_representation"`
+	GridRepresentation      [][]cellJSON `json:"grid_json"`
+	Cages                   []Cage       `json:"cages"`
+	Shape                   Shape        `json:"shape"`
+	// region id of every cell, from 1
+	Regions     Regions      `json:"regions"`
+	Constraints []Constraint `json:"constraints"`
+	// where the grid is in the image read
+	Bounds boundsJSON `json:"bounds"`
+	// degrees clockwise the image was turned to straighten it
+	DeskewAngle float64 `json:"deskew_angle"`
+	// degrees clockwise the orientation search turned the image
+	Orientation int `json:"orientation"`
+}
+
+type boundsJSON struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+func (g *Grid) toJSON() gridJSON {
+	cages := g.Cages
+	if cages == nil {
+		cages = []Cage{}
+	}
+
+	constraints := g.Constraints
+	if constraints == nil {
+		constraints = []Constraint{}
+	}
+
+	gridRep := make([][]cellJSON, len(g.Cells))
+
+	for rIdx, row := range g.Cells {
+		gridRep[rIdx] = make([]cellJSON, len(row))
+		for cIdx, cell := range row {
+			t, val, placeholders := cell.Contents()
+			corner, centre := cell.Marks()
+			gridRep[rIdx][cIdx] = cellJSON{
+				Identifier:   cell.Identifier,
+				Type:         t,
+				Val:          val,
+				Placeholders: placeholders,
+				CornerMarks:  corner,
+				CentreMarks:  centre,
+			}
+		}
+	}
+
+	return gridJSON{
+		ID:                      g.Name,
+		CharacterRepresentation: g.String(),
+		GridRepresentation:      gridRep,
+		Cages:                   cages,
+		Shape:                   g.Shape,
+		Regions:                 g.Regions,
+		Constraints:             constraints,
+		Bounds: boundsJSON{
+			X:      g.Bounds.Min.X,
+			Y:      g.Bounds.Min.Y,
+			Width:  g.Bounds.Dx(),
+			Height: g.Bounds.Dy(),
+		},
+		DeskewAngle: g.DeskewAngle,
+		Orientation: g.Orientation,
+	}
+}
+
+// Sudoku Exchange puzzle strings use 0 for empty cells rather than a period,
+// pencil marks are listed per cell in the same order as the puzzle string.
+type sudokuExchangeJSON struct {
+	ID          string  `json:"id"`
+	Puzzle      string  `json:"puzzle"`
+	PencilMarks [][]int `json:"pencil_marks"`
+}
+
+func (g *Grid) toSudokuExchange() sudokuExchangeJSON {
+	res := sudokuExchangeJSON{
+		ID:          g.Name,
+		PencilMarks: make([][]int, 0, 81),
+	}
+
+	var puzzle strings.Builder
+	for _, row := range g.Cells {
+		for _, cell := range row {
+			t, val, placeholders := cell.Contents()
+			if t == CellTypeValue {
+				puzzle.WriteString(strconv.Itoa(val))
+			} else {
+				puzzle.WriteByte('0')
+			}
+
+			if t == CellTypePlaceholders {
+				res.PencilMarks = append(res.PencilMarks, placeholders)
+			} else {
+				res.PencilMarks = append(res.PencilMarks, []int{})
+			}
+		}
+	}
+	res.Puzzle = puzzle.String()
+
+	return res
+}
+
+// f-puzzles (and SudokuPad, which imports it) describes a puzzle as a grid of
+// cells plus a list per constraint, killer cages are "killercage". Its cell
+// ids are the same as ours. Kropki dots and XV markers are listed the same
+// way as cages, thermometers and arrows as lines of cells.
+type fpuzzlesCell struct {
+	Value             int   `json:"value,omitempty"`
+	Given             bool  `json:"given,omitempty"`
+	CornerPencilMarks []int `json:"cornerPencilMarks,omitempty"`
+	CenterPencilMarks []int `json:"centerPencilMarks,omitempty"`
+	// 0 based, only set when the grid isn't the standard boxes
+	Region *int `json:"region,omitempty"`
+}
+
+type fpuzzlesCage struct {
+	Cells []string `json:"cells"`
+	Value string   `json:"value,omitempty"`
+}
+
+type fpuzzlesLines struct {
+	Cells []string   `json:"cells,omitempty"`
+	Lines [][]string `json:"lines"`
+}
+
+type fpuzzlesJSON struct {
+	Title      string           `json:"title,omitempty"`
+	Size       int              `json:"size"`
+	Grid       [][]fpuzzlesCell `json:"grid"`
+	KillerCage []fpuzzlesCage   `json:"killercage,omitempty"`
+	// top right to bottom left, and top left to bottom right
+	DiagonalPositive bool            `json:"diagonal+,omitempty"`
+	DiagonalNegative bool            `json:"diagonal-,omitempty"`
+	Thermometer      []fpuzzlesLines `json:"thermometer,omitempty"`
+	// Cells is the circle
+	Arrow []fpuzzlesLines `json:"arrow,omitempty"`
+	// white kropki dots are "difference", black ones "ratio"
+	Difference []fpuzzlesCage `json:"difference,omitempty"`
+	Ratio      []fpuzzlesCage `json:"ratio,omitempty"`
+	XV         []fpuzzlesCage `json:"xv,omitempty"`
+}
+
+// we can't tell givens from entered digits, every value is exported as given
+func (g *Grid) toFPuzzles() fpuzzlesJSON {
+	jigsaw := !g.Regions.Equal(StandardRegions(g.Shape))
+	res := fpuzzlesJSON{
+		Title: g.Name,
+		Size:  len(g.Cells),
+		Grid:  make([][]fpuzzlesCell, len(g.Cells)),
+	}
+
+	for rIdx, row := range g.Cells {
+		res.Grid[rIdx] = make([]fpuzzlesCell, len(row))
+		for cIdx, cell := range row {
+			var c fpuzzlesCell
+			if t, val, _ := cell.Contents(); t == CellTypeValue {
+				c = fpuzzlesCell{Value: val, Given: true}
+			} else {
+				corner, centre := cell.Marks()
+				c = fpuzzlesCell{CornerPencilMarks: corner, CenterPencilMarks: centre}
+			}
+
+			if jigsaw {
+				region := g.Regions[rIdx][cIdx] - 1
+				c.Region = &region
+			}
+
+			res.Grid[rIdx][cIdx] = c
+		}
+	}
+
+	for _, cage := range g.Cages {
+		c := fpuzzlesCage{Cells: cage.Cells}
+		if cage.Sum > 0 {
+			c.Value = strconv.Itoa(cage.Sum)
+		}
+		res.KillerCage = append(res.KillerCage, c)
+	}
+
+	for _, constraint := range g.Constraints {
+		switch constraint.Type {
+		case ConstraintDiagonal:
+			if constraint.Cells[0] == g.Cells[0][0].Identifier {
+				res.DiagonalNegative = true
+			} else {
+				res.DiagonalPositive = true
+			}
+		case ConstraintThermo:
+			res.Thermometer = append(res.Thermometer, fpuzzlesLines{Lines: [][]string{constraint.Cells}})
+		case ConstraintArrow:
+			res.Arrow = append(res.Arrow, fpuzzlesLines{Cells: constraint.Cells[:1], Lines: [][]string{constraint.Cells}})
+		case ConstraintKropkiWhite:
+			res.Difference = append(res.Difference, fpuzzlesCage{Cells: constraint.Cells})
+		case ConstraintKropkiBlack:
+			res.Ratio = append(res.Ratio, fpuzzlesCage{Cells: constraint.Cells})
+		case ConstraintX, ConstraintV:
+			res.XV = append(res.XV, fpuzzlesCage{Cells: constraint.Cells, Value: strings.ToUpper(string(constraint.Type))})
+		}
+	}
+
+	return res
+}
+
+func (g *Grid) encodeSDK() []byte {
+	var b strings.Builder
+
+	line, n := g.String(), g.Shape.Size
+	for row := 0; row < n; row++ {
+		b.WriteString(line[row*n : row*n+n])
+		b.WriteString("\n")
+	}
+
+	return []byte(b.String())
+}
+
+func (g *Grid) encodePretty() []byte {
+	var b strings.Builder
+
+	// "+-------+" per box, two characters per cell plus the padding
+	boxes := g.Shape.Size / g.Shape.BoxCols
+	border := strings.Repeat("+"+strings.Repeat("-", g.Shape.BoxCols*2+1), boxes) + "+\n"
+	b.WriteString(border)
+	for rIdx, row := range g.Cells {
+		for cIdx, cell := range row {
+			if cIdx%g.Shape.BoxCols == 0 {
+				b.WriteString("| ")
+			}
+
+			t, val, _ := cell.Contents()
+			if t == CellTypeValue {
+				b.WriteString(Symbol(val))
+			} else {
+				b.WriteString(".")
+			}
+			b.WriteString(" ")
+		}
+		b.WriteString("|\n")
+
+		if rIdx%g.Shape.BoxRows == g.Shape.BoxRows-1 {
+			b.WriteString(border)
+		}
+	}
+
+	return []byte(b.String())
+}
+
+// HoDoKu expects every unsolved cell to list its candidates. A cell without
+// any pencil marks has told us nothing, so it is written with all nine
+// candidates rather than being left blank (which HoDoKu rejects).
+func (g *Grid) encodeHoDoKu() []byte {
+	var cells [9][9]string
+	var widths [9]int
+
+	for rIdx, row := range g.Cells {
+		for cIdx, cell := range row {
+			t, val, placeholders := cell.Contents()
+
+			var s string
+			switch t {
+			case CellTypeValue:
+				s = strconv.Itoa(val)
+			case CellTypePlaceholders:
+				for _, p := range placeholders {
+					s += strconv.Itoa(p)
+				}
+			default:
+				s = "123456789"
+			}
+
+			cells[rIdx][cIdx] = s
+			widths[cIdx] = max(widths[cIdx], len(s))
+		}
+	}
+
+	// each box segment is " a b c " where a, b and c are padded to the column width
+	var segments [3]int
+	for box := 0; box < 3; box++ {
+		segments[box] = 2 + widths[box*3] + widths[box*3+1] + widths[box*3+2] + 2
+	}
+
+	border := func(edge, middle string) string {
+		return edge +
+			strings.Repeat("-", segments[0]) + middle +
+			strings.Repeat("-", segments[1]) + middle +
+			strings.Repeat("-", segments[2]) + edge + "\n"
+	}
+
+	var b strings.Builder
+	b.WriteString(border(".", "."))
+	for rIdx, row := range cells {
+		for cIdx, s := range row {
+			if cIdx%3 == 0 {
+				b.WriteString("|")
+			}
+			b.WriteString(" ")
+			b.WriteString(s)
+			b.WriteString(strings.Repeat(" ", widths[cIdx]-len(s)))
+			if cIdx%3 == 2 {
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("|\n")
+
+		switch rIdx {
+		case 2, 5:
+			b.WriteString(border(":", "+"))
+		case 8:
+			b.WriteString(border("'", "'"))
+		}
+	}
+
+	return []byte(b.String())
+}
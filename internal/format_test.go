@@ -0,0 +1,238 @@
+package internal
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFormatTestGrid() *Grid {
+	g := newTestGrid([][]string{
+		{"p123479", "3", "p12", "", "1", "", "2", "", "6"},
+		{"7", "p1", "5", "2", "6", "9", "", "", ""},
+		{"p89", "p159", "p45", "3", "8", "", "7", "4", ""},
+		{"5", "", "", "", "", "", "", "8", "2"},
+		{"2", "1", "", "4", "", "3", "", "", ""},
+		{"", "6", "7", "5", "", "", "", "", ""},
+		{"", "", "9", "1", "", "", "4", "5", ""},
+		{"", "", "1", "7", "", "4", "9", "", ""},
+		{"", "", "", "", "", "", "", "", ""},
+	}, ModeComparison)
+	g.Name = "format-test"
+	return g
+}
+
+func TestGrid_String(t *testing.T) {
+	g := newFormatTestGrid()
+
+	assert.Equal(
+		t,
+		".3..1.2.67.5269......38.74.5......8221.4.3....675.......91..45...17.49...........",
+		g.String(),
+	)
+}
+
+func TestFormatFromAccept(t *testing.T) {
+	assert.Equal(t, FormatJSON, FormatFromAccept(""))
+	assert.Equal(t, FormatJSON, FormatFromAccept("*/*"))
+	assert.Equal(t, FormatLine, FormatFromAccept("text/plain"))
+	assert.Equal(t, FormatLine, FormatFromAccept("image/png, text/plain;q=0.9, application/json"))
+	assert.Equal(t, FormatJSON, FormatFromAccept("application/json"))
+}
+
+func TestFormat_ContentType(t *testing.T) {
+	assert.Equal(t, "text/plain; charset=utf-8", FormatHoDoKu.ContentType())
+	assert.Equal(t, "text/plain; charset=utf-8", FormatPretty.ContentType())
+	assert.Equal(t, "application/json; charset=utf-8", FormatFPuzzles.ContentType())
+}
+
+func TestParseFormat(t *testing.T) {
+	f, err := ParseFormat("SDK")
+	assert.NoError(t, err)
+	assert.Equal(t, FormatSDK, f)
+
+	_, err = ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestGrid_Encode(t *testing.T) {
+	g := newFormatTestGrid()
+
+	t.Run("json", func(tt *testing.T) {
+		b, err := g.Encode(FormatJSON)
+		assert.NoError(tt, err)
+
+		var res gridJSON
+		assert.NoError(tt, json.Unmarshal(b, &res))
+		assert.Equal(tt, "format-test", res.ID)
+		assert.Equal(tt, g.String(), res.CharacterRepresentation)
+		assert.Equal(tt, CellTypePlaceholders, res.GridRepresentation[0][0].Type)
+		assert.Equal(tt, []int{1, 2, 3, 4, 7, 9}, res.GridRepresentation[0][0].Placeholders)
+		assert.Equal(tt, []int{1, 2, 3, 4, 7, 9}, res.GridRepresentation[0][0].CornerMarks)
+		assert.Empty(tt, res.GridRepresentation[0][0].CentreMarks)
+		assert.Equal(tt, 3, res.GridRepresentation[0][1].Val)
+		assert.NotNil(tt, res.Constraints)
+	})
+
+	t.Run("line", func(tt *testing.T) {
+		b, err := g.Encode(FormatLine)
+		assert.NoError(tt, err)
+		assert.Equal(tt, g.String()+"\n", string(b))
+	})
+
+	t.Run("sdk", func(tt *testing.T) {
+		b, err := g.Encode(FormatSDK)
+		assert.NoError(tt, err)
+
+		lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		assert.Len(tt, lines, 9)
+		assert.Equal(tt, ".3..1.2.6", lines[0])
+		assert.Equal(tt, ".........", lines[8])
+	})
+
+	t.Run("sudoku exchange", func(tt *testing.T) {
+		b, err := g.Encode(FormatSudokuExchange)
+		assert.NoError(tt, err)
+
+		var res sudokuExchangeJSON
+		assert.NoError(tt, json.Unmarshal(b, &res))
+		assert.Equal(tt, strings.ReplaceAll(g.String(), ".", "0"), res.Puzzle)
+		assert.Len(tt, res.PencilMarks, 81)
+		assert.Equal(tt, []int{8, 9}, res.PencilMarks[18])
+		assert.Equal(tt, []int{}, res.PencilMarks[1])
+	})
+
+	t.Run("pretty", func(tt *testing.T) {
+		b, err := g.Encode(FormatPretty)
+		assert.NoError(tt, err)
+
+		lines := strings.Split(string(b), "\n")
+		assert.Equal(tt, "+-------+-------+-------+", lines[0])
+		assert.Equal(tt, "| . 3 . | . 1 . | 2 . 6 |", lines[1])
+		assert.Equal(tt, "+-------+-------+-------+", lines[4])
+	})
+
+	t.Run("hodoku", func(tt *testing.T) {
+		b, err := g.Encode(FormatHoDoKu)
+		assert.NoError(tt, err)
+
+		lines := strings.Split(strings.TrimSuffix(string(b), "\n"), "\n")
+		assert.Len(tt, lines, 13)
+		assert.True(tt, strings.HasPrefix(lines[0], ".---"))
+		assert.True(tt, strings.HasPrefix(lines[4], ":---"))
+		assert.True(tt, strings.HasPrefix(lines[12], "'---"))
+		assert.True(tt, strings.HasPrefix(lines[1], "| 123479    3         12        |"))
+
+		// every line has the same width
+		for _, l := range lines {
+			assert.Equal(tt, len(lines[0]), len(l))
+		}
+	})
+
+	t.Run("fpuzzles", func(tt *testing.T) {
+		g.Cages = []Cage{{Cells: []string{"R1C1", "R1C2"}, Sum: 7}, {Cells: []string{"R9C9"}}}
+		defer func() { g.Cages = nil }()
+
+		b, err := g.Encode(FormatFPuzzles)
+		assert.NoError(tt, err)
+
+		var res fpuzzlesJSON
+		assert.NoError(tt, json.Unmarshal(b, &res))
+		assert.Equal(tt, 9, res.Size)
+		assert.Equal(tt, fpuzzlesCell{CornerPencilMarks: []int{1, 2, 3, 4, 7, 9}}, res.Grid[0][0])
+		assert.Equal(tt, fpuzzlesCell{Value: 3, Given: true}, res.Grid[0][1])
+		assert.Equal(tt, []fpuzzlesCage{
+			{Cells: []string{"R1C1", "R1C2"}, Value: "7"},
+			{Cells: []string{"R9C9"}},
+		}, res.KillerCage)
+
+		g.Regions = jigsawRegions
+		defer func() { g.Regions = StandardRegions(ClassicShape) }()
+
+		b, err = g.Encode(FormatFPuzzles)
+		assert.NoError(tt, err)
+
+		res = fpuzzlesJSON{}
+		assert.NoError(tt, json.Unmarshal(b, &res))
+		assert.Equal(tt, 1, *res.Grid[2][2].Region)
+		assert.Equal(tt, 3, *res.Grid[2][8].Region)
+
+		g.Constraints = []Constraint{
+			{Type: ConstraintDiagonal, Cells: []string{"R1C9", "R2C8", "R3C7", "R4C6", "R5C5", "R6C4", "R7C3", "R8C2", "R9C1"}},
+			{Type: ConstraintThermo, Cells: []string{"R1C3", "R1C4", "R2C5"}},
+			{Type: ConstraintArrow, Cells: []string{"R4C7", "R5C7", "R6C8"}},
+			{Type: ConstraintKropkiWhite, Cells: []string{"R6C2", "R7C2"}},
+			{Type: ConstraintKropkiBlack, Cells: []string{"R8C2", "R8C3"}},
+			{Type: ConstraintV, Cells: []string{"R7C6", "R8C6"}},
+		}
+		defer func() { g.Constraints = nil }()
+
+		b, err = g.Encode(FormatFPuzzles)
+		assert.NoError(tt, err)
+
+		res = fpuzzlesJSON{}
+		assert.NoError(tt, json.Unmarshal(b, &res))
+		assert.True(tt, res.DiagonalPositive)
+		assert.False(tt, res.DiagonalNegative)
+		assert.Equal(tt, []fpuzzlesLines{{Lines: [][]string{{"R1C3", "R1C4", "R2C5"}}}}, res.Thermometer)
+		assert.Equal(tt, []fpuzzlesLines{{Cells: []string{"R4C7"}, Lines: [][]string{{"R4C7", "R5C7", "R6C8"}}}}, res.Arrow)
+		assert.Equal(tt, []fpuzzlesCage{{Cells: []string{"R6C2", "R7C2"}}}, res.Difference)
+		assert.Equal(tt, []fpuzzlesCage{{Cells: []string{"R8C2", "R8C3"}}}, res.Ratio)
+		assert.Equal(tt, []fpuzzlesCage{{Cells: []string{"R7C6", "R8C6"}, Value: "V"}}, res.XV)
+	})
+
+	t.Run("unknown", func(tt *testing.T) {
+		_, err := g.Encode(Format("xml"))
+		assert.Error(tt, err)
+	})
+}
+
+func TestGrid_Encode_Shapes(t *testing.T) {
+	mini := newTestGrid([][]string{
+		{"1", "", "", "4"},
+		{"", "4", "p12", ""},
+		{"", "", "4", ""},
+		{"4", "", "", "3"},
+	}, ModeComparison)
+
+	b, err := mini.Encode(FormatLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "1..4.4....4.4..3\n", string(b))
+
+	b, err = mini.Encode(FormatSDK)
+	assert.NoError(t, err)
+	assert.Equal(t, "1..4\n.4..\n..4.\n4..3\n", string(b))
+
+	b, err = mini.Encode(FormatPretty)
+	assert.NoError(t, err)
+	assert.Equal(t, "+-----+-----+\n| 1 . | . 4 |\n| . 4 | . . |\n+-----+-----+\n| . . | 4 . |\n| 4 . | . 3 |\n+-----+-----+\n", string(b))
+
+	// a client error, see SudokuServer.readGrid
+	_, err = mini.Encode(FormatHoDoKu)
+	assert.ErrorIs(t, err, errUnsupportedShape)
+	_, err = mini.Encode(FormatSudokuExchange)
+	assert.ErrorIs(t, err, errUnsupportedShape)
+
+	// values over 9 are letters in the text formats
+	rows := make([][]string, 16)
+	for r := range rows {
+		rows[r] = make([]string, 16)
+	}
+	rows[0][0], rows[0][1], rows[15][15] = "10", "G", "p1A"
+	giant := newTestGrid(rows, ModeComparison)
+
+	b, err = giant.Encode(FormatLine)
+	assert.NoError(t, err)
+	assert.Equal(t, "AG"+strings.Repeat(".", 254)+"\n", string(b))
+	assert.Equal(t, "p1A", giant.Cells[15][15].Label())
+
+	b, err = giant.Encode(FormatFPuzzles)
+	assert.NoError(t, err)
+
+	var res fpuzzlesJSON
+	assert.NoError(t, json.Unmarshal(b, &res))
+	assert.Equal(t, 16, res.Size)
+	assert.Equal(t, fpuzzlesCell{Value: 16, Given: true}, res.Grid[0][1])
+}
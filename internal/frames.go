@@ -0,0 +1,507 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Frame is one image of a recording of a grid being solved
+type Frame struct {
+	Image image.Image
+	// when the frame is first shown, from the start of the recording
+	Time time.Duration
+}
+
+const (
+	// animations with a larger canvas are rejected
+	maxFramePixels = 4096 * 4096
+	// frames of an animation after this many aren't decoded
+	maxFrames = 1000
+)
+
+// the extensions of the frames read from a directory, anything else in it
+// is skipped
+var frameExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".bmp", ".tif", ".tiff", ".heic"}
+
+// what happens to a frame of an animation once it's been shown, before the
+// next is drawn over it
+type frameDisposal int
+
+const (
+	// left as it is
+	disposeNone frameDisposal = iota
+	// cleared to transparent
+	disposeBackground
+	// put back to how the canvas was before the frame was drawn
+	disposePrevious
+)
+
+// LoadFrames calls each with every image in a directory as a frame, in file
+// name order (frame-2.png before frame-10.png) and each shown for interval,
+// or with every frame of an animated GIF or APNG file, see DecodeFrames
+func LoadFrames(p string, interval time.Duration, each func(Frame)) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return DecodeFrames(b, each)
+	}
+
+	entries, err := os.ReadDir(p)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && slices.Contains(frameExtensions, strings.ToLower(filepath.Ext(entry.Name()))) {
+			names = append(names, entry.Name())
+		}
+	}
+	slices.SortFunc(names, compareNatural)
+
+	for idx, name := range names {
+		b, err := os.ReadFile(filepath.Join(p, name))
+		if err != nil {
+			return err
+		}
+
+		img, err := DecodeImage(b)
+		if err != nil {
+			return fmt.Errorf("%s: %v", name, err)
+		}
+		each(Frame{Image: img, Time: time.Duration(idx) * interval})
+	}
+
+	return nil
+}
+
+// compareNatural orders strings with the numbers in them compared by value
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		if unicode.IsDigit(rune(a[0])) && unicode.IsDigit(rune(b[0])) {
+			an, arest := leadingDigits(a)
+			bn, brest := leadingDigits(b)
+			if c := compareNumbers(an, bn); c != 0 {
+				return c
+			}
+			a, b = arest, brest
+			continue
+		}
+
+		if a[0] != b[0] {
+			return int(a[0]) - int(b[0])
+		}
+		a, b = a[1:], b[1:]
+	}
+
+	return len(a) - len(b)
+}
+
+func leadingDigits(s string) (digits, rest string) {
+	end := strings.IndexFunc(s, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end == -1 {
+		end = len(s)
+	}
+
+	return s[:end], s[end:]
+}
+
+// compareNumbers compares two strings of digits by value, without the
+// overflow of parsing them
+func compareNumbers(a, b string) int {
+	a, b = strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+	if len(a) != len(b) {
+		return len(a) - len(b)
+	}
+
+	return strings.Compare(a, b)
+}
+
+// DecodeFrames calls each with every frame of an animated GIF or APNG as
+// it's shown, with the partial frames drawn over those before them. The
+// frames are drawn on the same image, which is only theirs until each
+// returns. Animations with a canvas over maxFramePixels are rejected, only
+// their first maxFrames frames are decoded. Any other image is a single
+// frame.
+func DecodeFrames(b []byte, each func(Frame)) error {
+	switch {
+	case bytes.HasPrefix(b, []byte("GIF8")):
+		return decodeGIFFrames(b, each)
+	case isAPNG(b):
+		return decodeAPNGFrames(b, each)
+	}
+
+	img, err := DecodeImage(b)
+	if err != nil {
+		return err
+	}
+	each(Frame{Image: img})
+
+	return nil
+}
+
+// newCanvas is the image the frames of a width by height animation are drawn
+// on. The size is whatever the file claims, a few bytes can ask for
+// gigabytes.
+func newCanvas(width, height int) (*image.RGBA, error) {
+	if width <= 0 || height <= 0 || width > maxFramePixels/height {
+		return nil, fmt.Errorf("%dx%d canvas is empty or over %d pixels", width, height, maxFramePixels)
+	}
+
+	return image.NewRGBA(image.Rect(0, 0, width, height)), nil
+}
+
+// decodeGIFFrames splits a GIF into a GIF per frame, holding the frame's
+// graphic control and image with the logical screen and global colour table,
+// and draws each in turn
+func decodeGIFFrames(b []byte, each func(Frame)) error {
+	config, err := gif.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("decoding gif: %v", err)
+	}
+	canvas, err := newCanvas(config.Width, config.Height)
+	if err != nil {
+		return fmt.Errorf("decoding gif: %v", err)
+	}
+
+	// the header and logical screen, then the global colour table
+	pos := 13
+	if b[10]&0x80 != 0 {
+		pos += 3 << (b[10]&0x07 + 1)
+	}
+	header := b[:pos]
+
+	// the graphic control extension of the next image
+	var control []byte
+	var at time.Duration
+	frames := 0
+	for pos < len(b) && b[pos] != 0x3b {
+		if frames == maxFrames {
+			Logger.Debug("skipping gif frames over the limit", "frames", maxFrames)
+			break
+		}
+
+		start := pos
+		switch b[pos] {
+		case 0x21:
+			if pos+2 > len(b) {
+				return errors.New("decoding gif: truncated extension")
+			}
+			if pos, err = gifSubBlocks(b, pos+2); err != nil {
+				return fmt.Errorf("decoding gif: %v", err)
+			}
+			if b[start+1] == 0xf9 {
+				control = b[start:pos]
+			}
+		case 0x2c:
+			if pos+11 > len(b) {
+				return errors.New("decoding gif: truncated image")
+			}
+			// the image descriptor, the local colour table and the lzw code
+			// size before the image data
+			pos += 10
+			if b[start+9]&0x80 != 0 {
+				pos += 3 << (b[start+9]&0x07 + 1)
+			}
+			if pos, err = gifSubBlocks(b, pos+1); err != nil {
+				return fmt.Errorf("decoding gif: %v", err)
+			}
+
+			frame := slices.Concat(header, control, b[start:pos], []byte{0x3b})
+			img, err := gif.Decode(bytes.NewReader(frame))
+			if err != nil {
+				return fmt.Errorf("decoding gif frame %d: %v", frames+1, err)
+			}
+
+			dispose := disposeNone
+			// delays are in hundredths of a second, browsers show frames
+			// without one (or of 0.01s) for 0.1s
+			delay := 10
+			if len(control) >= 8 {
+				switch control[3] >> 2 & 0x07 {
+				case gif.DisposalBackground:
+					dispose = disposeBackground
+				case gif.DisposalPrevious:
+					dispose = disposePrevious
+				}
+				if d := int(binary.LittleEndian.Uint16(control[4:])); d > 1 {
+					delay = d
+				}
+			}
+
+			drawFrame(canvas, img, img.Bounds(), draw.Over, dispose, func() {
+				each(Frame{Image: canvas, Time: at})
+			})
+			frames++
+			control = nil
+			at += time.Duration(delay) * 10 * time.Millisecond
+		default:
+			return fmt.Errorf("decoding gif: unknown block %#x", b[pos])
+		}
+	}
+
+	return nil
+}
+
+// gifSubBlocks is where the sub-blocks of data starting at pos end, after
+// the empty block ending them
+func gifSubBlocks(b []byte, pos int) (int, error) {
+	for pos < len(b) {
+		size := int(b[pos])
+		pos += 1 + size
+		if size == 0 {
+			return pos, nil
+		}
+	}
+
+	return 0, errors.New("truncated data")
+}
+
+// drawFrame draws the partial frame src at rect on canvas, calls show while
+// it's shown, then disposes of it ready for the next frame. Only the area of
+// a frame put back afterwards is copied.
+func drawFrame(canvas *image.RGBA, src image.Image, rect image.Rectangle, op draw.Op, dispose frameDisposal, show func()) {
+	var previous *image.RGBA
+	if dispose == disposePrevious {
+		previous = image.NewRGBA(rect)
+		draw.Draw(previous, rect, canvas, rect.Min, draw.Src)
+	}
+
+	draw.Draw(canvas, rect, src, src.Bounds().Min, op)
+	show()
+
+	switch dispose {
+	case disposeBackground:
+		draw.Draw(canvas, rect, image.Transparent, image.Point{}, draw.Src)
+	case disposePrevious:
+		draw.Draw(canvas, rect, previous, rect.Min, draw.Src)
+	}
+}
+
+// pngChunk is a chunk of a PNG file, its length and crc aren't kept
+type pngChunk struct {
+	typ  string
+	data []byte
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func pngChunks(b []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(b, pngSignature) {
+		return nil, errors.New("not a png")
+	}
+
+	var chunks []pngChunk
+	for pos := len(pngSignature); pos < len(b); {
+		if pos+12 > len(b) {
+			return nil, errors.New("truncated chunk")
+		}
+
+		length := int(binary.BigEndian.Uint32(b[pos:]))
+		if length < 0 || pos+12+length > len(b) {
+			return nil, errors.New("truncated chunk")
+		}
+		chunks = append(chunks, pngChunk{typ: string(b[pos+4 : pos+8]), data: b[pos+8 : pos+8+length]})
+		pos += 12 + length
+	}
+
+	return chunks, nil
+}
+
+func appendPNGChunk(b []byte, typ string, data []byte) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(data)))
+	start := len(b)
+	b = append(b, typ...)
+	b = append(b, data...)
+
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(b[start:]))
+}
+
+// isAPNG reports whether b is a PNG with an animation control chunk before
+// its image data, PNG decoders that don't know APNG only show the first frame
+func isAPNG(b []byte) bool {
+	chunks, err := pngChunks(b)
+	if err != nil {
+		return false
+	}
+
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "acTL":
+			return true
+		case "IDAT":
+			return false
+		}
+	}
+
+	return false
+}
+
+// apngFrame is a frame control chunk and the image data following it
+type apngFrame struct {
+	rect     image.Rectangle
+	delay    time.Duration
+	dispose  frameDisposal
+	blend    draw.Op
+	data     []byte
+	hasImage bool
+}
+
+// decodeAPNGFrames splits an APNG into a PNG per frame, holding the frame's
+// image data with the chunks before the first frame (the palette,
+// transparency and colour space), and draws each in turn
+func decodeAPNGFrames(b []byte, each func(Frame)) error {
+	chunks, err := pngChunks(b)
+	if err != nil {
+		return fmt.Errorf("decoding apng: %v", err)
+	}
+
+	var header []byte
+	var shared []pngChunk
+	var frames []*apngFrame
+	seenImage := false
+parse:
+	for _, chunk := range chunks {
+		switch chunk.typ {
+		case "IHDR":
+			header = chunk.data
+		case "fcTL":
+			if len(frames) == maxFrames {
+				Logger.Debug("skipping apng frames over the limit", "frames", maxFrames)
+				break parse
+			}
+			f, err := parseFrameControl(chunk.data)
+			if err != nil {
+				return fmt.Errorf("decoding apng: %v", err)
+			}
+			frames = append(frames, f)
+		case "IDAT":
+			seenImage = true
+			// the default image is only a frame when a frame control comes
+			// before it
+			if len(frames) == 1 {
+				frames[0].data = append(frames[0].data, chunk.data...)
+				frames[0].hasImage = true
+			}
+		case "fdAT":
+			if len(chunk.data) < 4 || len(frames) == 0 {
+				return errors.New("decoding apng: frame data without a frame control")
+			}
+			f := frames[len(frames)-1]
+			f.data = append(f.data, chunk.data[4:]...)
+			f.hasImage = true
+		case "acTL", "IEND":
+		default:
+			if !seenImage {
+				shared = append(shared, chunk)
+			}
+		}
+	}
+
+	if len(header) != 13 {
+		return errors.New("decoding apng: missing header")
+	}
+
+	canvas, err := newCanvas(int(binary.BigEndian.Uint32(header)), int(binary.BigEndian.Uint32(header[4:])))
+	if err != nil {
+		return fmt.Errorf("decoding apng: %v", err)
+	}
+
+	shown := 0
+	var at time.Duration
+	for idx, f := range frames {
+		if !f.hasImage {
+			continue
+		}
+		if !f.rect.In(canvas.Bounds()) {
+			return fmt.Errorf("decoding apng frame %d: %v is outside the %v canvas", idx+1, f.rect, canvas.Bounds())
+		}
+
+		frameHeader := slices.Clone(header)
+		binary.BigEndian.PutUint32(frameHeader, uint32(f.rect.Dx()))
+		binary.BigEndian.PutUint32(frameHeader[4:], uint32(f.rect.Dy()))
+
+		p := appendPNGChunk(slices.Clone(pngSignature), "IHDR", frameHeader)
+		for _, chunk := range shared {
+			p = appendPNGChunk(p, chunk.typ, chunk.data)
+		}
+		p = appendPNGChunk(p, "IDAT", f.data)
+		p = appendPNGChunk(p, "IEND", nil)
+
+		img, err := png.Decode(bytes.NewReader(p))
+		if err != nil {
+			return fmt.Errorf("decoding apng frame %d: %v", idx+1, err)
+		}
+
+		// the first frame has nothing before it to go back to
+		dispose := f.dispose
+		if shown == 0 && dispose == disposePrevious {
+			dispose = disposeBackground
+		}
+
+		drawFrame(canvas, img, f.rect, f.blend, dispose, func() {
+			each(Frame{Image: canvas, Time: at})
+		})
+		shown++
+		at += f.delay
+	}
+
+	if shown == 0 {
+		return errors.New("decoding apng: no frames")
+	}
+
+	return nil
+}
+
+func parseFrameControl(b []byte) (*apngFrame, error) {
+	if len(b) < 26 {
+		return nil, errors.New("truncated frame control")
+	}
+
+	width, height := int(binary.BigEndian.Uint32(b[4:])), int(binary.BigEndian.Uint32(b[8:]))
+	x, y := int(binary.BigEndian.Uint32(b[12:])), int(binary.BigEndian.Uint32(b[16:]))
+	if width <= 0 || height <= 0 || x < 0 || y < 0 {
+		return nil, fmt.Errorf("invalid frame %dx%d at %d,%d", width, height, x, y)
+	}
+
+	// the delay is a fraction of a second, a denominator of 0 means 100
+	num, den := binary.BigEndian.Uint16(b[20:]), binary.BigEndian.Uint16(b[22:])
+	if den == 0 {
+		den = 100
+	}
+
+	f := &apngFrame{
+		rect:    image.Rect(x, y, x+width, y+height),
+		delay:   time.Duration(num) * time.Second / time.Duration(den),
+		dispose: frameDisposal(b[24]),
+		blend:   draw.Src,
+	}
+	if f.dispose > disposePrevious {
+		return nil, fmt.Errorf("unknown dispose op %d", b[24])
+	}
+	if b[25] == 1 {
+		f.blend = draw.Over
+	}
+
+	return f, nil
+}
@@ -0,0 +1,375 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+type Style string
+
+const (
+	StyleNYT       Style = "nyt"
+	StyleSudokuCom Style = "sudokucom"
+)
+
+// Theme is the palette a synthetic grid is drawn with
+type Theme struct {
+	Name        string
+	Background  string
+	Border      string
+	BoxLine     string
+	CellLine    string
+	Given       string
+	Entered     string
+	PencilMark  string
+	Highlight   string
+	Selected    string
+	FontFamily  string
+	GivenWeight uint
+}
+
+var themes = map[Style][]Theme{
+	StyleNYT: {
+		{
+			Name:        "nyt-light",
+			Background:  "#ffffff",
+			Border:      "#000000",
+			BoxLine:     "#8a8a8a",
+			CellLine:    "#cccccc",
+			Given:       "#000000",
+			Entered:     "#2860d8",
+			PencilMark:  "#555555",
+			Highlight:   "#e6e6e6",
+			Selected:    "#ffd700",
+			FontFamily:  "Helvetica",
+			GivenWeight: 700,
+		},
+	},
+	StyleSudokuCom: {
+		{
+			Name:        "sudokucom-light",
+			Background:  "#ffffff",
+			Border:      "#344861",
+			BoxLine:     "#344861",
+			CellLine:    "#bec6d4",
+			Given:       "#344861",
+			Entered:     "#325aaf",
+			PencilMark:  "#6e7c8c",
+			Highlight:   "#e2ebf3",
+			Selected:    "#bbdefb",
+			FontFamily:  "Helvetica",
+			GivenWeight: 400,
+		},
+		{
+			Name:        "sudokucom-dark",
+			Background:  "#1e2127",
+			Border:      "#9aa5b1",
+			BoxLine:     "#9aa5b1",
+			CellLine:    "#3c424d",
+			Given:       "#e3e6ea",
+			Entered:     "#6fa8ff",
+			PencilMark:  "#a0a8b3",
+			Highlight:   "#2b313a",
+			Selected:    "#344155",
+			FontFamily:  "Helvetica",
+			GivenWeight: 400,
+		},
+	},
+}
+
+type GenerateOptions struct {
+	// StyleNYT or StyleSudokuCom, picked at random when empty
+	Style Style
+	// cell width in pixels is picked between these
+	MinCellWidth int
+	MaxCellWidth int
+	// chance of each empty cell holding pencil marks
+	PencilMarkRate float64
+	// chance of each empty cell holding a digit entered by the player
+	EnteredRate float64
+	// chance of the grid having highlighted cells
+	HighlightRate float64
+	// chance of the image being re-encoded as a JPEG
+	JPEGRate float64
+	// the image is rotated by up to this many degrees either way
+	MaxRotation float64
+}
+
+func DefaultGenerateOptions() GenerateOptions {
+	return GenerateOptions{
+		MinCellWidth:   60,
+		MaxCellWidth:   140,
+		PencilMarkRate: 0.3,
+		EnteredRate:    0.15,
+		HighlightRate:  0.5,
+		JPEGRate:       0.3,
+		MaxRotation:    0,
+	}
+}
+
+// SyntheticGrid is a generated screenshot with the truth table it was drawn
+// from, in the same layout as the grids/ fixtures
+type SyntheticGrid struct {
+	PNG   []byte
+	Truth [][]string
+	Theme string
+}
+
+// GenerateGrid draws a screenshot of a random puzzle in the style of one of
+// the apps we read. The geometry matches what SplitCells expects: a border
+// and box separators of the same thickness with cell lines half as thick.
+func GenerateGrid(rng *rand.Rand, opts GenerateOptions) (*SyntheticGrid, error) {
+	style := opts.Style
+	if style == "" {
+		style = []Style{StyleNYT, StyleSudokuCom}[rng.Intn(2)]
+	}
+
+	styleThemes, ok := themes[style]
+	if !ok {
+		return nil, fmt.Errorf("unknown style %q", style)
+	}
+	theme := styleThemes[rng.Intn(len(styleThemes))]
+
+	cellWidth := opts.MinCellWidth + rng.Intn(max(1, opts.MaxCellWidth-opts.MinCellWidth+1))
+	thickness := max(2, cellWidth/20+rng.Intn(3))
+	thin := thickness / 2
+
+	gridWidth := 4*thickness + 6*thin + 9*cellWidth
+	margin := cellWidth/2 + rng.Intn(cellWidth)
+	width := gridWidth + margin*2
+	height := gridWidth + margin*2 + rng.Intn(cellWidth*3)
+
+	// cell origins, following the separator layout SplitCells expects
+	var origins [9]int
+	pos := margin + thickness
+	for i := 0; i < 9; i++ {
+		origins[i] = pos
+		pos += cellWidth
+		if i == 2 || i == 5 {
+			pos += thickness
+		} else {
+			pos += thin
+		}
+	}
+
+	puzzle, solution := RandomPuzzle(rng, 24+rng.Intn(12))
+
+	truth := make([][]string, 9)
+	var entered [9][9]bool
+	var pencilMarks [9][9][]int
+	for row := 0; row < 9; row++ {
+		truth[row] = make([]string, 9)
+		for col := 0; col < 9; col++ {
+			if puzzle[row][col] != 0 {
+				truth[row][col] = strconv.Itoa(puzzle[row][col])
+				continue
+			}
+
+			switch r := rng.Float64(); {
+			case r < opts.EnteredRate:
+				entered[row][col] = true
+				truth[row][col] = strconv.Itoa(solution[row][col])
+			case r < opts.EnteredRate+opts.PencilMarkRate:
+				label := "p"
+				for val := 1; val <= 9; val++ {
+					if val == solution[row][col] || rng.Float64() < 0.3 {
+						pencilMarks[row][col] = append(pencilMarks[row][col], val)
+						label += strconv.Itoa(val)
+					}
+				}
+				truth[row][col] = label
+			}
+		}
+	}
+
+	wand := imagick.NewMagickWand()
+	defer wand.Destroy()
+
+	palette := colours{}
+	defer palette.Destroy()
+
+	if err := wand.NewImage(uint(width), uint(height), palette.get(theme.Background)); err != nil {
+		return nil, fmt.Errorf("creating image: %v", err)
+	}
+
+	dw := imagick.NewDrawingWand()
+	defer dw.Destroy()
+
+	// the grid is drawn as nested blocks, the border colour first, then the
+	// box separators, then the cell lines, with each cell painted on top
+	fill := func(c string, x0, y0, x1, y1 int) {
+		dw.SetFillColor(palette.get(c))
+		dw.Rectangle(float64(x0), float64(y0), float64(x1-1), float64(y1-1))
+	}
+
+	fill(theme.Border, margin, margin, margin+gridWidth, margin+gridWidth)
+	fill(
+		theme.BoxLine,
+		origins[0], origins[0],
+		origins[8]+cellWidth, origins[8]+cellWidth,
+	)
+	for boxRow := 0; boxRow < 3; boxRow++ {
+		for boxCol := 0; boxCol < 3; boxCol++ {
+			fill(
+				theme.CellLine,
+				origins[boxCol*3], origins[boxRow*3],
+				origins[boxCol*3+2]+cellWidth, origins[boxRow*3+2]+cellWidth,
+			)
+		}
+	}
+
+	var highlighted [9][9]string
+	if rng.Float64() < opts.HighlightRate {
+		selRow, selCol := rng.Intn(9), rng.Intn(9)
+		for i := 0; i < 9; i++ {
+			highlighted[selRow][i] = theme.Highlight
+			highlighted[i][selCol] = theme.Highlight
+			highlighted[selRow/3*3+i/3][selCol/3*3+i%3] = theme.Highlight
+		}
+		highlighted[selRow][selCol] = theme.Selected
+	}
+
+	for row := 0; row < 9; row++ {
+		for col := 0; col < 9; col++ {
+			background := theme.Background
+			if highlighted[row][col] != "" {
+				background = highlighted[row][col]
+			}
+			fill(
+				background,
+				origins[col], origins[row],
+				origins[col]+cellWidth, origins[row]+cellWidth,
+			)
+		}
+	}
+
+	if err := wand.DrawImage(dw); err != nil {
+		return nil, fmt.Errorf("drawing grid: %v", err)
+	}
+
+	text := imagick.NewDrawingWand()
+	defer text.Destroy()
+
+	if err := text.SetFontFamily(theme.FontFamily); err != nil {
+		return nil, fmt.Errorf("setting font: %v", err)
+	}
+	text.SetTextAlignment(imagick.ALIGN_CENTER)
+
+	for row := 0; row < 9; row++ {
+		for col := 0; col < 9; col++ {
+			x := float64(origins[col])
+			y := float64(origins[row])
+
+			if val := puzzle[row][col]; val != 0 || entered[row][col] {
+				c := theme.Given
+				if entered[row][col] {
+					c = theme.Entered
+					val = solution[row][col]
+				}
+
+				size := float64(cellWidth) * 0.6
+				text.SetFillColor(palette.get(c))
+				text.SetFontWeight(theme.GivenWeight)
+				text.SetFontSize(size)
+				text.Annotation(x+float64(cellWidth)/2, y+float64(cellWidth)/2+size*0.36, strconv.Itoa(val))
+				continue
+			}
+
+			size := float64(cellWidth) * 0.2
+			text.SetFillColor(palette.get(theme.PencilMark))
+			text.SetFontWeight(400)
+			text.SetFontSize(size)
+			for _, val := range pencilMarks[row][col] {
+				slotRow := float64((val - 1) / 3)
+				slotCol := float64((val - 1) % 3)
+				text.Annotation(
+					x+(slotCol+0.5)*float64(cellWidth)/3,
+					y+(slotRow+0.5)*float64(cellWidth)/3+size*0.36,
+					strconv.Itoa(val),
+				)
+			}
+		}
+	}
+
+	if err := wand.DrawImage(text); err != nil {
+		return nil, fmt.Errorf("drawing digits: %v", err)
+	}
+
+	if opts.MaxRotation > 0 {
+		degrees := (rng.Float64()*2 - 1) * opts.MaxRotation
+		if err := wand.RotateImage(palette.get(theme.Background), degrees); err != nil {
+			return nil, fmt.Errorf("rotating image: %v", err)
+		}
+	}
+
+	if rng.Float64() < opts.JPEGRate {
+		if err := wand.SetImageFormat("jpeg"); err != nil {
+			return nil, fmt.Errorf("setting jpeg format: %v", err)
+		}
+		if err := wand.SetImageCompressionQuality(uint(60 + rng.Intn(36))); err != nil {
+			return nil, fmt.Errorf("setting jpeg quality: %v", err)
+		}
+
+		b, err := wand.GetImageBlob()
+		if err != nil {
+			return nil, fmt.Errorf("encoding jpeg: %v", err)
+		}
+
+		wand.Clear()
+		if err := wand.ReadImageBlob(b); err != nil {
+			return nil, fmt.Errorf("decoding jpeg: %v", err)
+		}
+	}
+
+	if err := wand.SetImageFormat("png"); err != nil {
+		return nil, fmt.Errorf("setting png format: %v", err)
+	}
+
+	b, err := wand.GetImageBlob()
+	if err != nil {
+		return nil, fmt.Errorf("encoding png: %v", err)
+	}
+
+	return &SyntheticGrid{PNG: b, Truth: truth, Theme: theme.Name}, nil
+}
+
+// WriteSyntheticCorpus generates n grids into dir, one numbered directory per
+// grid holding a grid.png and truth.json
+func WriteSyntheticCorpus(dir string, n int, seed int64, opts GenerateOptions) error {
+	rng := rand.New(rand.NewSource(seed))
+
+	for i := 1; i <= n; i++ {
+		g, err := GenerateGrid(rng, opts)
+		if err != nil {
+			return fmt.Errorf("generating grid %d: %v", i, err)
+		}
+
+		gridDir := filepath.Join(dir, strconv.Itoa(i))
+		if err := os.MkdirAll(gridDir, 0755); err != nil {
+			return fmt.Errorf("creating directory: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(gridDir, "grid.png"), g.PNG, 0644); err != nil {
+			return fmt.Errorf("writing grid: %v", err)
+		}
+
+		truth, err := json.Marshal(g.Truth)
+		if err != nil {
+			return fmt.Errorf("marshalling truth table: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(gridDir, "truth.json"), truth, 0644); err != nil {
+			return fmt.Errorf("writing truth table: %v", err)
+		}
+
+		Logger.Debug("generated grid", "dir", gridDir, "theme", g.Theme)
+	}
+
+	return nil
+}
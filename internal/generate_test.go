@@ -0,0 +1,73 @@
+package internal
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+func TestGenerateGrid(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	// only the givens are drawn, so every value in the truth table is one
+	opts := DefaultGenerateOptions()
+	opts.Style = StyleNYT
+	opts.PencilMarkRate, opts.EnteredRate, opts.HighlightRate, opts.JPEGRate = 0, 0, 0, 0
+
+	generated, err := GenerateGrid(rand.New(rand.NewSource(7)), opts)
+	if !assert.NoError(t, err) || !assert.Len(t, generated.Truth, 9) {
+		return
+	}
+
+	puzzle := NewBoard(9)
+	for row, labels := range generated.Truth {
+		for col, label := range labels {
+			if label == "" {
+				continue
+			}
+
+			val, err := strconv.Atoi(label)
+			if !assert.NoError(t, err, "R%dC%d", row+1, col+1) {
+				return
+			}
+			puzzle[row][col] = val
+		}
+	}
+
+	regions := StandardRegions(ClassicShape)
+	assert.True(t, puzzle.Valid(regions))
+	assert.True(t, puzzle.Unique(regions))
+
+	img, err := DecodeImage(generated.PNG)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	g := GridFromImage(img, "generated")
+	if !assert.NoError(t, g.SplitCells(ModeComparison)) || !assert.Equal(t, ClassicShape, g.Shape) {
+		return
+	}
+
+	// a given is drawn in the middle of its cell, the others are left empty
+	ink := Binarise(img)
+	for row, cells := range g.Cells {
+		for col, cell := range cells {
+			middle := cell.image.Image.Bounds().Inset(cell.image.Image.Bounds().Dx() / 4)
+
+			var inked int
+			for y := middle.Min.Y; y < middle.Max.Y; y++ {
+				for x := middle.Min.X; x < middle.Max.X; x++ {
+					if ink.Ink(x, y) {
+						inked++
+					}
+				}
+			}
+
+			assert.Equal(t, puzzle[row][col] != 0, inked > 0, "R%dC%d", row+1, col+1)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"sync"
+)
+
+// zeroSamples stand in for 0, which never appears as a pencil mark so isn't
+// in the classifier, where it can be read: the digits of cage sums and of two
+// digit values. They're rings drawn at the proportions of the other digits.
+var zeroSamples = sync.OnceValue(func() []ClassifierSample {
+	samples := make([]ClassifierSample, 0)
+	for _, w := range []int{11, 13, 15} {
+		for _, stroke := range []float64{1.5, 2, 3} {
+			h := 19
+			img := image.NewNRGBA(image.Rect(0, 0, w, h))
+			cx, cy := float64(w)/2, float64(h)/2
+			for y := 0; y < h; y++ {
+				for x := 0; x < w; x++ {
+					// distance from the ellipse, in pixels along the x axis
+					dx, dy := (float64(x)+0.5-cx)/cx, (float64(y)+0.5-cy)/cy
+					d := (1 - (dx*dx + dy*dy)) * cx / 2
+					if d >= 0 && d <= stroke {
+						img.Set(x, y, color.Black)
+					}
+				}
+			}
+
+			samples = append(samples, ClassifierSample{Digit: 0, Features: glyphFeatures(img)})
+		}
+	}
+
+	return samples
+})
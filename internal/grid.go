@@ -3,13 +3,13 @@ package internal
 import (
 	"fmt"
 	"image"
-	"image/color"
-	_ "image/png"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"runtime"
+	"slices"
+	"strings"
 )
 
 type Grid struct {
@@ -17,127 +17,94 @@ type Grid struct {
 	boundaries             image.Rectangle
 	separatorThickness     int
 	cellWidth              int
-	placeholderComparisons []*GridImage
-	digitComparisons       []*GridImage
-
-	Name  string
-	Cells [9][9]*Cell
+	cellHeight             int
+	placeholderComparisons []*Template
+	digitComparisons       []*Template
+
+	Name string
+	// where the grid's border is in the image it was read from, set by
+	// SplitCells. The image is the turned and straightened one when it was
+	// oriented or deskewed.
+	Bounds image.Rectangle
+	// how far the image was turned to straighten it, in degrees clockwise
+	DeskewAngle float64
+	// how far the orientation search turned the image, in degrees clockwise,
+	// see ReadOptions.AutoOrient
+	Orientation int
+	// the size of the grid and its boxes, detected by SplitCells
+	Shape Shape
+	// Shape.Size rows of Shape.Size cells
+	Cells [][]*Cell
+	// killer cages, empty for classic grids
+	Cages []Cage
+	// the region each cell belongs to, the boxes of Shape unless the grid is
+	// a jigsaw
+	Regions Regions
+	// variant constraints drawn over the grid, see FindConstraints
+	Constraints []Constraint
 }
 
-func pixelMeetsThreshold(c color.Color) bool {
-	threshold := uint32(100)
-	r, g, b, _ := c.RGBA()
-
-	return r < threshold && g < threshold && b < threshold
-}
+// the narrowest cell a digit can be read in, any size of grid is read as long
+// as its cells are at least this wide
+const minCellLength = 16
 
-// identifies the grid boundaries, cell length and separator thickness
+// identifies the grid lines, and from them the boundaries, shape, separator
+// thickness and every cell. The lines are found in projection profiles of the
+// ink of the whole image, each cell sits between the lines either side of it.
 func (g *Grid) SplitCells(cellMode Mode) error {
-	midX := g.img.Bounds().Dx() / 2
-
-	for y := 0; y < g.img.Bounds().Dy(); y += 1 {
-		if !pixelMeetsThreshold(g.img.At(midX, y)) {
-			continue
-		}
-
-		// process: confirming it's a straight horizontal line and is likely the grid
-		//		from the centre, go left and right, until the line ends
-		//		if range(leftx, rightx) < 500 (random number) then is not a good top line (go to next candidate)
-		//		find the topLeft and topRight coordinates
-		//		calculate the width of the top bar
-		//		navigate vertically from these coordinates until a value that doesn't pass the threshold is met
-		//		this is the bottom of the grid
-		//		set bottomLeft and bottomRight coordinates
-		//		validate that all points share a euclidean distance
-
-		var topLeft, topRight, bottomRight image.Point
-		var separatorThickness int
-
-		leftX := midX - 1
-		rightX := midX + 1
-		for x := leftX; x >= 0; x -= 1 {
-			if !pixelMeetsThreshold(g.img.At(x, y)) {
-				topLeft = image.Point{x + 1, y}
-				break
-			}
-		}
-
-		for x := rightX; x <= g.img.Bounds().Dx(); x += 1 {
-			if !pixelMeetsThreshold(g.img.At(x, y)) {
-				topRight = image.Point{x - 1, y}
-				break
-			}
-		}
+	rows, cols := projectionProfiles(g.img.Mask())
+	bounds := g.img.Bounds()
+	horizontal := regularLines(profileLines(rows, bounds.Min.Y))
+	vertical := regularLines(profileLines(cols, bounds.Min.X))
+	if horizontal == nil || vertical == nil {
+		return fmt.Errorf("failed to find grid boundaries")
+	}
 
-		if topRight.Sub(topLeft).X < 500 {
-			Logger.Debug(
-				"not a good top line candidate, expected over 500px",
-				"length", topRight.Sub(topLeft).X,
-				"y-level", y,
-			)
-			continue
-		}
+	shape, err := g.shapeFromLines(horizontal, vertical)
+	if err != nil {
+		return fmt.Errorf("detecting grid shape: %v", err)
+	}
 
-		for yDown := y + 1; yDown < g.img.Bounds().Dy(); yDown += 1 {
-			leftPixelMetThreshold := pixelMeetsThreshold(g.img.At(topLeft.X, yDown))
-			rightPixelMetThreshold := pixelMeetsThreshold(g.img.At(topRight.X, yDown))
+	g.boundaries = image.Rect(vertical[0].start, horizontal[0].start, vertical[len(vertical)-1].end, horizontal[len(horizontal)-1].end)
+	g.Bounds = g.boundaries
+	if cell := g.boundaries.Dx() / shape.Size; cell < minCellLength {
+		return fmt.Errorf("found %dpx wide cells, expected at least %dpx", cell, minCellLength)
+	}
 
-			if !leftPixelMetThreshold && !rightPixelMetThreshold {
-				bottomRight = image.Point{topRight.X, yDown}
-				break
-			}
+	g.separatorThickness = horizontal[0].width()
+	if g.separatorThickness > 50 {
+		return fmt.Errorf("found a large separator thickness, expected less than 50px")
+	}
 
-			if leftPixelMetThreshold != rightPixelMetThreshold {
-				return fmt.Errorf("grid top points appear unaligned, expected both verticals to end at the same y coord")
-			}
-		}
+	g.img.DebugWrite("grid.png")
 
-		for thick := 1; thick < 100; thick += 1 {
-			if !pixelMeetsThreshold(g.img.At(midX, y+thick)) {
-				separatorThickness = thick
-				break
-			}
-		}
+	g.Shape = shape
+	Logger.Debug("detected grid shape", "grid_id", g.Name, "shape", g.Shape.String())
 
-		if separatorThickness > 50 {
-			return fmt.Errorf("found a large separator thickness, expected less than 50px")
+	// the typical cell, used to scale what's looked for in them
+	cellLength := func(lines []gridLine) int {
+		lengths := make([]int, 0, len(lines)-1)
+		for idx := 1; idx < len(lines); idx++ {
+			lengths = append(lengths, lines[idx].start-lines[idx-1].end)
 		}
-
-		g.cellWidth =
-			(topRight.X -
-				topLeft.X -
-				// *4 cause theres the two sides + the two middle dividers.
-				(separatorThickness * 4) -
-				// *6 here to cater for the the thin divers between cells
-				// 9 cause there are nine columns. likely float is being cast to int, its ok
-				((separatorThickness / 2) * 6)) / 9
-
-		g.separatorThickness = separatorThickness
-		g.boundaries = image.Rect(topLeft.X, topLeft.Y, bottomRight.X, bottomRight.Y)
-		break
+		slices.Sort(lengths)
+		return lengths[len(lengths)/2]
 	}
+	g.cellWidth = cellLength(vertical)
+	g.cellHeight = cellLength(horizontal)
 
-	if i := g.boundaries.Size(); i.X == 0 || i.Y == 0 {
-		return fmt.Errorf("failed to find grid boundaries")
-	}
+	g.Cells = make([][]*Cell, g.Shape.Size)
+	for row := 0; row < g.Shape.Size; row += 1 {
+		rowCells := make([]*Cell, g.Shape.Size)
 
-	g.img.DebugWrite("grid.png")
-
-	yPos := g.boundaries.Min.Y + g.separatorThickness
-	for row := 0; row < 9; row += 1 {
-		var rowCells [9]*Cell
-
-		xPos := g.boundaries.Min.X + g.separatorThickness
-		for col := 0; col < 9; col += 1 {
+		for col := 0; col < g.Shape.Size; col += 1 {
+			// 2px of buffer from the lines as pixels might be changing colour
 			bounds := image.Rect(
-				// + 2 to give some buffer from the borders as pixels might be changing colour
-				xPos+2,
-				yPos+2,
-
-				// - 2 to compensate for operation above
-				xPos+g.cellWidth-2,
-				yPos+g.cellWidth-2,
-			)
+				vertical[col].end,
+				horizontal[row].end,
+				vertical[col+1].start,
+				horizontal[row+1].start,
+			).Inset(2)
 
 			rowCells[col] = NewCellFromGridImage(
 				bounds,
@@ -145,42 +112,34 @@ func (g *Grid) SplitCells(cellMode Mode) error {
 				fmt.Sprintf("R%dC%d", row+1, col+1),
 				cellMode,
 			)
-
-			xPos += g.cellWidth
-			// set offset
-			switch col {
-			// on the 3th and 6th increase by the entire separator thickness
-			case 2:
-				xPos += g.separatorThickness
-			case 5:
-				xPos += g.separatorThickness
-			default:
-				// increase xPos by cellLength and grid.separatorThickness/2 each time
-				xPos += g.separatorThickness / 2
-			}
+			rowCells[col].maxValue = g.Shape.Size
 		}
 
 		g.Cells[row] = rowCells
+	}
 
-		yPos += g.cellWidth
-		// set row offset
-		switch row {
-		// on the 3th and 6th increase by the entire separator thickness
-		case 2:
-			yPos += g.separatorThickness
-		case 5:
-			yPos += g.separatorThickness
-		default:
-			// increase yPos by cellLength and grid.separatorThickness/2 each time
-			yPos += g.separatorThickness / 2
-		}
+	g.Regions = StandardRegions(g.Shape)
+
+	return nil
+}
+
+// AttachDebugBundle collects the original image, every pre-processing stage
+// and distortion score into b, it must be called before SplitCells
+func (g *Grid) AttachDebugBundle(b *DebugBundle) error {
+	original, err := g.img.Bytes()
+	if err != nil {
+		return fmt.Errorf("getting original image bytes: %v", err)
 	}
 
+	b.Add("original.png", original)
+	g.img.debug = b
+
 	return nil
 }
 
 func (g *Grid) Process(jobs chan<- *WorkerJob) error {
-	results := make(chan *Result, 81)
+	cells := g.Shape.Size * g.Shape.Size
+	results := make(chan *Result, cells)
 
 	for _, columns := range g.Cells {
 		for _, c := range columns {
@@ -188,7 +147,7 @@ func (g *Grid) Process(jobs chan<- *WorkerJob) error {
 		}
 	}
 
-	for range 81 {
+	for range cells {
 		msg := <-results
 		if !msg.Ok {
 			return msg.Error
@@ -198,17 +157,17 @@ func (g *Grid) Process(jobs chan<- *WorkerJob) error {
 	return nil
 }
 
-// TODO: TEST
 // Returns a continuous string containing the contents of each
 // cell, left to right, top to bottom. Empty cells are represented
-// by a period (.). Placeholders are omitted.
+// by a period (.), values over 9 by a letter (see Symbol).
+// Placeholders are omitted.
 func (g *Grid) String() string {
 	var str string
 
 	for _, row := range g.Cells {
 		for _, cell := range row {
 			if cell.Type() == CellTypeValue {
-				str += fmt.Sprintf("%d", cell.comparisonValue)
+				str += Symbol(cell.comparisonValue)
 			} else {
 				str += "."
 			}
@@ -218,8 +177,12 @@ func (g *Grid) String() string {
 	return str
 }
 
-func loadPlaceholderComparisons() []*GridImage {
-	placeholderComparisons := make([]*GridImage, 0)
+// templatesDir is where t-values and t-placeholders are read from, the
+// TEMPLATES_DIR env var points it at a set made by `grid-reader train`
+func templatesDir() string {
+	if dir := os.Getenv("TEMPLATES_DIR"); dir != "" {
+		return dir
+	}
 
 	// this gets back the path of the current file, I tried with os.Getwd() but that
 	// returns the location that the binary was called from
@@ -228,64 +191,112 @@ func loadPlaceholderComparisons() []*GridImage {
 		log.Fatal("could not determine the current file path")
 	}
 
-	baseDir := filepath.Dir(currentFile)
-	path := path.Join(baseDir, "../t-placeholders")
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		log.Fatal(fmt.Errorf("reading placeholders directory: %w", err))
+	return path.Join(filepath.Dir(currentFile), "..")
+}
+
+func loadPlaceholderComparisons() []*Template {
+	return mustLoadTemplates("t-placeholders", "placeholder")
+}
+
+func loadDigitComparisons() []*Template {
+	return mustLoadTemplates("t-values", "digit")
+}
+
+// checkTemplates makes sure comparison mode has a template for every value
+// of the grid, a 12x12 or 16x16 grid would otherwise have its letters read as
+// whichever digit they look most like
+func (g *Grid) checkTemplates(mode Mode) error {
+	if mode != ModeComparison {
+		return nil
 	}
 
-	for idx, e := range entries {
-		file, err := os.Open(fmt.Sprintf("%s/%s", path, e.Name()))
-		if err != nil {
-			log.Fatal(fmt.Errorf("opening image file: %v", err))
+	for _, set := range []struct {
+		name      string
+		templates []*Template
+	}{{"value", g.digitComparisons}, {"placeholder", g.placeholderComparisons}} {
+		missing := missingTemplates(set.templates, g.Shape.Size)
+		if len(missing) == 0 {
+			continue
 		}
-		defer file.Close()
 
-		img, _, err := image.Decode(file)
-		if err != nil {
-			log.Fatal(fmt.Errorf("decoding image: %v", err))
+		symbols := make([]string, len(missing))
+		for idx, val := range missing {
+			symbols[idx] = Symbol(val)
 		}
-
-		placeholderComparisons = append(placeholderComparisons, NewGridImage(img, fmt.Sprintf("placeholder-%d", idx)))
+		return fmt.Errorf("no %s templates for %s in a %dx%d grid, train them or read it in classifier mode", set.name, strings.Join(symbols, ", "), g.Shape.Size, g.Shape.Size)
 	}
 
-	return placeholderComparisons
+	return nil
 }
 
-func loadDigitComparisons() []*GridImage {
-	digitComparisons := make([]*GridImage, 0)
+type ReadOptions struct {
+	// defaults to ModeComparison
+	Mode Mode
+	// when set, collects every pre-processing stage and distortion score
+	Debug *DebugBundle
+	// when set, the grid is also read turned 90, 180 and 270 degrees unless
+	// it's recognised confidently as it is, for photos without an EXIF
+	// orientation. It's up to four times slower.
+	AutoOrient bool
+}
 
-	// this gets back the path of the current file, I tried with os.Getwd() but that
-	// returns the location that the binary was called from
-	_, currentFile, _, ok := runtime.Caller(0)
-	if !ok {
-		log.Fatal("could not determine the current file path")
+// ReadGrid runs the whole pipeline over img, normalising, orienting (when
+// opts.AutoOrient is set) and straightening it, finding the grid, splitting
+// it into cells, mapping its regions, tracing any killer cages, finding any
+// variant constraints and processing each of the cells through the worker
+func ReadGrid(img image.Image, name string, worker *GridWorker, opts ReadOptions) (*Grid, error) {
+	if opts.Mode == "" {
+		opts.Mode = ModeComparison
 	}
 
-	baseDir := filepath.Dir(currentFile)
-	path := path.Join(baseDir, "../t-values")
-	entries, err := os.ReadDir(path)
-	if err != nil {
-		log.Fatal(fmt.Errorf("reading values directory: %w", err))
+	img = NormaliseImage(img)
+	if opts.AutoOrient {
+		return readTurned(img, name, worker, opts)
 	}
 
-	for idx, e := range entries {
-		file, err := os.Open(fmt.Sprintf("%s/%s", path, e.Name()))
-		if err != nil {
-			log.Fatal(fmt.Errorf("opening image file: %v", err))
-		}
-		defer file.Close()
+	return readGrid(img, name, worker, opts)
+}
+
+// readGrid is ReadGrid after the image is normalised and oriented
+func readGrid(img image.Image, name string, worker *GridWorker, opts ReadOptions) (*Grid, error) {
+	img, angle := Deskew(img)
+	if angle != 0 {
+		Logger.Debug("deskewed image", "grid_id", name, "angle", angle)
+	}
 
-		img, _, err := image.Decode(file)
-		if err != nil {
-			log.Fatal(fmt.Errorf("decoding image: %v", err))
+	grid := GridFromImage(img, name)
+	grid.DeskewAngle = angle
+	if opts.Debug != nil {
+		if err := grid.AttachDebugBundle(opts.Debug); err != nil {
+			return nil, fmt.Errorf("attaching debug bundle: %v", err)
 		}
+	}
+
+	if err := grid.SplitCells(opts.Mode); err != nil {
+		return nil, fmt.Errorf("splitting cells: %v", err)
+	}
+
+	grid.FindRegions()
+
+	if err := grid.FindCages(); err != nil {
+		return nil, fmt.Errorf("finding cages: %v", err)
+	}
+
+	grid.FindConstraints()
+
+	if err := grid.checkTemplates(opts.Mode); err != nil {
+		return nil, err
+	}
+
+	if err := grid.Process(worker.jobs); err != nil {
+		return nil, fmt.Errorf("processing cells: %v", err)
+	}
 
-		digitComparisons = append(digitComparisons, NewGridImage(img, fmt.Sprintf("digit-%d", idx)))
+	if !grid.Valid() {
+		Logger.Debug("values repeat in a row, column or region", "grid_id", grid.Name)
 	}
 
-	return digitComparisons
+	return grid, nil
 }
 
 func GridFromImage(img image.Image, name string) *Grid {
@@ -296,5 +307,7 @@ func GridFromImage(img image.Image, name string) *Grid {
 		placeholderComparisons: placeholderComparisons,
 		digitComparisons:       digitComparisons,
 		Name:                   name,
+		Shape:                  ClassicShape,
+		Regions:                StandardRegions(ClassicShape),
 	}
 }
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"image/color"
 	"image/png"
 	"log"
 	"os"
@@ -11,6 +12,7 @@ import (
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 
 	"gopkg.in/gographics/imagick.v3/imagick"
 )
@@ -19,6 +21,11 @@ type GridImage struct {
 	image.Image
 	identifier string
 	wand       *imagick.MagickWand
+	// when set, everything passed to DebugWrite is also collected here
+	debug *DebugBundle
+	// the ink in the image, made on first use. Cells share their grid's.
+	mask     *InkMask
+	maskOnce sync.Once
 }
 
 func (g *GridImage) Bytes() ([]byte, error) {
@@ -118,6 +125,16 @@ func (g *GridImage) RunPreProcessing() error {
 	return nil
 }
 
+// DistortionPercentage compares the (pre-processed) image against a
+// representation, returning the number of differing pixels as a percentage of
+// the representation's resolution
+func (g *GridImage) DistortionPercentage(representation *GridImage) float64 {
+	_, distortion := g.wand.CompareImages(representation.wand, imagick.METRIC_ABSOLUTE_ERROR)
+	resolution := representation.wand.GetImageWidth() * representation.wand.GetImageHeight()
+
+	return distortion / float64(resolution) * 100
+}
+
 func (g *GridImage) tesseract(psm int) (string, error) {
 	// "-" is stdin
 	cmd := exec.Command("tesseract", "stdin", "stdout", "--psm", strconv.Itoa(psm), "quiet")
@@ -196,7 +213,8 @@ func (g *GridImage) IdentifyBlockOCR() (ps []int, e error) {
 }
 
 func (g *GridImage) DebugWrite(p string) {
-	if os.Getenv("DEBUG") != "true" {
+	writeToDisk := os.Getenv("DEBUG") == "true"
+	if !writeToDisk && g.debug == nil {
 		return
 	}
 
@@ -205,6 +223,17 @@ func (g *GridImage) DebugWrite(p string) {
 		return
 	}
 
+	b, err := g.Bytes()
+	if err != nil {
+		log.Fatal(fmt.Errorf("getting bytes: %w", err))
+	}
+
+	g.debug.Add(p, b)
+
+	if !writeToDisk {
+		return
+	}
+
 	currentDir, err := os.Getwd()
 	if err != nil {
 		log.Fatal(fmt.Errorf("getting current directory: %w", err))
@@ -222,22 +251,57 @@ func (g *GridImage) DebugWrite(p string) {
 	}
 	defer f.Close()
 
-	b, err := g.Bytes()
-	if err != nil {
-		log.Fatal(fmt.Errorf("getting bytes: %w", err))
-	}
-
 	if _, err = f.Write(b); err != nil {
 		log.Fatal(fmt.Errorf("failed to write debug image: %w", err))
 	}
 }
 
+func (g *GridImage) DominantColour() color.Color {
+	counts := make(map[color.RGBA64]int)
+
+	var dominant color.RGBA64
+	bounds := g.Image.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			c := color.RGBA64Model.Convert(g.Image.At(x, y)).(color.RGBA64)
+			counts[c] += 1
+			if counts[c] > counts[dominant] {
+				dominant = c
+			}
+		}
+	}
+
+	return dominant
+}
+
+// Mask is the ink in the image (see Binarise), a cell's is the mask of the
+// whole grid
+func (g *GridImage) Mask() *InkMask {
+	g.maskOnce.Do(func() {
+		if g.mask == nil {
+			g.mask = Binarise(g.Image)
+		}
+	})
+
+	return g.mask
+}
+
 func (g *GridImage) CropImage(rect image.Rectangle) image.Image {
 	return g.Image.(interface {
 		SubImage(r image.Rectangle) image.Image
 	}).SubImage(rect)
 }
 
+// LoadImage reads and decodes the image file at p, see DecodeImage
+func LoadImage(p string) (image.Image, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("reading image file: %v", err)
+	}
+
+	return DecodeImage(b)
+}
+
 func NewGridImage(img image.Image, identifier string) *GridImage {
 	var buf bytes.Buffer
 	if err := png.Encode(&buf, img); err != nil {
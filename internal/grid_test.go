@@ -7,7 +7,6 @@ import (
 	"io"
 	"os"
 	"path"
-	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,12 +14,19 @@ import (
 )
 
 func newTestGrid(rows [][]string, mode Mode) *Grid {
+	shape, err := ShapeForSize(len(rows))
+	if err != nil {
+		panic(err)
+	}
+
 	g := &Grid{
-		Cells: [9][9]*Cell{},
+		Shape:   shape,
+		Cells:   make([][]*Cell, len(rows)),
+		Regions: StandardRegions(shape),
 	}
 
 	for i, row := range rows {
-		g.Cells[i] = [9]*Cell{}
+		g.Cells[i] = make([]*Cell, len(row))
 		for j, val := range row {
 			c := &Cell{
 				Identifier:             fmt.Sprintf("R%dC%d", i+1, j+1),
@@ -28,7 +34,9 @@ func newTestGrid(rows [][]string, mode Mode) *Grid {
 				comparisonPlaceholders: []int{},
 				ocrValue:               -1,
 				ocrPlaceholders:        []int{},
+				comparisonDistortion:   -1,
 				mode:                   mode,
+				maxValue:               shape.Size,
 			}
 			if val == "" {
 				g.Cells[i][j] = c
@@ -37,17 +45,18 @@ func newTestGrid(rows [][]string, mode Mode) *Grid {
 
 			if val[0] == 'p' {
 				for _, v := range val[1:] {
-					i, err := strconv.Atoi(string(v))
+					i, err := ParseSymbol(string(v))
 					if err != nil {
 						panic(err)
 					}
 					c.ocrPlaceholders = append(c.ocrPlaceholders, i)
 					c.comparisonPlaceholders = append(c.comparisonPlaceholders, i)
+					c.cornerMarks = append(c.cornerMarks, i)
 				}
 			}
 
-			if len(val) == 1 {
-				i, err := strconv.Atoi(val)
+			if val[0] != 'p' {
+				i, err := ParseSymbol(val)
 				if err != nil {
 					panic(err)
 				}
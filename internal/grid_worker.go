@@ -36,7 +36,7 @@ func (s *GridWorker) work(jobs <-chan *WorkerJob) {
 			)
 			if err := j.cell.IdentifyOCR(); err != nil {
 				j.res <- &Result{Ok: false, Error: fmt.Errorf("identifying ocr: %v", err)}
-				return
+				continue
 			}
 			Logger.Debug(
 				"grid worker: finished ocr processing",
@@ -53,7 +53,7 @@ func (s *GridWorker) work(jobs <-chan *WorkerJob) {
 			)
 			if err := j.cell.ProcessValues(j.grid.digitComparisons); err != nil {
 				j.res <- &Result{Ok: false, Error: fmt.Errorf("processing comparison values: %v", err)}
-				return
+				continue
 			}
 			Logger.Debug(
 				"grid worker: finished value comparison",
@@ -68,7 +68,7 @@ func (s *GridWorker) work(jobs <-chan *WorkerJob) {
 			)
 			if err := j.cell.ProcessPlaceholders(j.grid.placeholderComparisons); err != nil {
 				j.res <- &Result{Ok: false, Error: fmt.Errorf("processing placeholder values: %v", err)}
-				return
+				continue
 			}
 			Logger.Debug(
 				"grid worker: finished placeholder comparison",
@@ -77,6 +77,29 @@ func (s *GridWorker) work(jobs <-chan *WorkerJob) {
 			)
 		}
 
+		if j.cell.mode == ModeClassifier {
+			classifier, err := defaultClassifier()
+			if err != nil {
+				j.res <- &Result{Ok: false, Error: fmt.Errorf("loading classifier: %v", err)}
+				continue
+			}
+
+			if err := j.cell.ClassifyValues(classifier); err != nil {
+				j.res <- &Result{Ok: false, Error: fmt.Errorf("classifying values: %v", err)}
+				continue
+			}
+
+			if err := j.cell.ClassifyPlaceholders(classifier); err != nil {
+				j.res <- &Result{Ok: false, Error: fmt.Errorf("classifying placeholders: %v", err)}
+				continue
+			}
+			Logger.Debug(
+				"grid worker: finished classification",
+				"grid_id", j.grid.Name,
+				"cell_id", j.cell.Identifier,
+			)
+		}
+
 		j.res <- &Result{Ok: true}
 	}
 }
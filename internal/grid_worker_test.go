@@ -0,0 +1,40 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGridWorker_KeepsWorkingAfterErrors(t *testing.T) {
+	loaded := defaultClassifier
+	defer func() { defaultClassifier = loaded }()
+	defaultClassifier = func() (*Classifier, error) {
+		return nil, errors.New("bad model")
+	}
+
+	worker := NewGridWorker()
+	worker.Start()
+
+	// more failing cells than there are workers, each still gets a result
+	res := make(chan *Result)
+	grid := &Grid{Name: "worker"}
+	for idx := range 20 {
+		go func() {
+			worker.jobs <- &WorkerJob{cell: &Cell{Identifier: fmt.Sprintf("R1C%d", idx+1), mode: ModeClassifier}, grid: grid, res: res}
+		}()
+	}
+
+	for range 20 {
+		select {
+		case r := <-res:
+			assert.False(t, r.Ok)
+			assert.ErrorContains(t, r.Error, "bad model")
+		case <-time.After(5 * time.Second):
+			t.Fatal("no workers left to process the cell")
+		}
+	}
+}
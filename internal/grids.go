@@ -0,0 +1,153 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+)
+
+const (
+	// the shortest top line taken for a grid's border on a large page, on a
+	// smaller image it's a quarter of its width so mini grids are found too,
+	// but never shorter than a 4x4 grid of minCellLength cells
+	minGridLength = 500
+	// grids are square, a border whose height is further than this fraction
+	// of its width from it is something else (i.e. a rule across the page)
+	maxGridSkew = 0.1
+	// white space kept around each grid when it's cropped from the page
+	gridMargin = 8
+)
+
+// FindGrids finds the border of every grid in img, scanning its ink (see
+// Binarise) for long top lines and following both ends down. They're
+// returned in the order their top lines are met, top to bottom then left to
+// right.
+func FindGrids(img image.Image) []image.Rectangle {
+	bounds := img.Bounds()
+	dark := Binarise(img).Ink
+	minLength := max(4*minCellLength, min(minGridLength, bounds.Dx()/4))
+
+	grids := make([]image.Rectangle, 0)
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if found := gridAt(grids, x, y); found != nil {
+				x = found.Max.X - 1
+				continue
+			}
+
+			if !dark(x, y) {
+				continue
+			}
+
+			right := x
+			for right+1 < bounds.Max.X && dark(right+1, y) {
+				right += 1
+			}
+
+			width := right - x + 1
+			if width < minLength {
+				x = right
+				continue
+			}
+
+			// both ends of the top line run down to the bottom of the grid
+			bottom := y
+			for bottom+1 < bounds.Max.Y && dark(x, bottom+1) && dark(right, bottom+1) {
+				bottom += 1
+			}
+
+			if height := bottom - y + 1; float64(max(height-width, width-height)) > float64(width)*maxGridSkew {
+				Logger.Debug("not a grid, expected a square border", "x", x, "y", y, "width", width, "height", height)
+				x = right
+				continue
+			}
+
+			grids = append(grids, image.Rect(x, y, right+1, bottom+1))
+			x = right
+		}
+	}
+
+	return grids
+}
+
+// gridAt is the grid holding x, y, nil when there isn't one
+func gridAt(grids []image.Rectangle, x, y int) *image.Rectangle {
+	for idx := range grids {
+		if (image.Point{x, y}).In(grids[idx]) {
+			return &grids[idx]
+		}
+	}
+
+	return nil
+}
+
+// cropGrid copies the grid at rect out of img onto a white image with a
+// margin around it, so it can be read on its own. offset is where the copy's
+// origin sits in img.
+func cropGrid(img image.Image, rect image.Rectangle) (crop image.Image, offset image.Point) {
+	padded := rect.Inset(-gridMargin)
+
+	dst := image.NewRGBA(image.Rect(0, 0, padded.Dx(), padded.Dy()))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, rect.Sub(padded.Min), img, rect.Min, draw.Src)
+
+	return dst, padded.Min
+}
+
+// ReadGrids reads every grid in img (i.e. a newspaper page or a page of a
+// puzzle book), the page is normalised and straightened then each grid is
+// cropped out and read through the worker alongside the others. They're named
+// after name and their position, see FindGrids. opts.Debug is ignored, a
+// debug bundle holds a single grid.
+func ReadGrids(img image.Image, name string, worker *GridWorker, opts ReadOptions) ([]*Grid, error) {
+	img, angle := Deskew(NormaliseImage(img))
+	if angle != 0 {
+		Logger.Debug("deskewed page", "grid_id", name, "angle", angle)
+	}
+
+	rects := FindGrids(img)
+	if len(rects) == 0 {
+		return nil, fmt.Errorf("failed to find any grids")
+	}
+
+	Logger.Debug("found grids", "grid_id", name, "grids", len(rects))
+
+	opts.Debug = nil
+	grids := make([]*Grid, len(rects))
+	errs := make([]error, len(rects))
+
+	var wg sync.WaitGroup
+	for idx, rect := range rects {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			crop, offset := cropGrid(img, rect)
+			grid, err := ReadGrid(crop, fmt.Sprintf("%s-%d", name, idx+1), worker, opts)
+			if err != nil {
+				errs[idx] = fmt.Errorf("reading grid %d at %v: %v", idx+1, rect, err)
+				return
+			}
+
+			// the crop was read turned when it was oriented
+			size := crop.Bounds().Size()
+			if grid.Orientation%180 != 0 {
+				size = image.Pt(size.Y, size.X)
+			}
+			grid.Bounds = unturnRect(grid.Bounds, size, grid.Orientation).Add(offset)
+			grid.DeskewAngle += angle
+			grids[idx] = grid
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return grids, nil
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindGrids(t *testing.T) {
+	shapes := []Shape{ClassicShape, {Size: 6, BoxRows: 2, BoxCols: 3}}
+
+	// the grids side by side with a rule across the page below them, as in a
+	// newspaper
+	page := image.NewRGBA(image.Rect(0, 0, 1800, 1000))
+	draw.Draw(page, page.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(page, image.Rect(20, 950, 1780, 954), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	want := make([]image.Rectangle, 0)
+	x := 0
+	for _, shape := range shapes {
+		img, _ := newShapeTestImage(shape)
+		draw.Draw(page, img.Bounds().Add(image.Point{x, 60}), img, image.Point{}, draw.Src)
+
+		// newShapeTestImage leaves a 40px margin around the grid
+		want = append(want, img.Bounds().Inset(40).Add(image.Point{x, 60}))
+		x += img.Bounds().Dx()
+	}
+
+	grids := FindGrids(page)
+	assert.Equal(t, want, grids)
+
+	for idx, rect := range grids {
+		crop, offset := cropGrid(page, rect)
+
+		g := GridFromImage(crop, shapes[idx].String())
+		if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+			continue
+		}
+
+		assert.Equal(t, shapes[idx], g.Shape)
+		assert.Equal(t, rect, g.Bounds.Add(offset))
+	}
+
+	assert.Empty(t, FindGrids(image.NewRGBA(image.Rect(0, 0, 100, 100))))
+}
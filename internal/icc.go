@@ -0,0 +1,195 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+)
+
+// colorants are the XYZ (adapted to D50) of an RGB colour space's red, green
+// and blue primaries, which is all that tells sRGB and i.e. Display P3 apart
+type colorants [3][3]float64
+
+var (
+	srgbColorants = colorants{
+		{0.4360, 0.2225, 0.0139},
+		{0.3851, 0.7169, 0.0971},
+		{0.1431, 0.0606, 0.7141},
+	}
+	// the colorants of a profile are rounded to 16 bits, and some generators
+	// adapt to D50 a little differently
+	colorantTolerance = 0.003
+
+	// srgbProfile is what ImageMagick converts an image with an embedded
+	// profile to
+	srgbProfile = rgbProfile("sRGB", srgbColorants)
+)
+
+// jpegICCProfile is the ICC profile embedded in a JPEG, nil when there isn't
+// one or a part of it is missing. It's split across APP2 segments, each
+// numbered and counting how many there are.
+func jpegICCProfile(b []byte) []byte {
+	if !bytes.HasPrefix(b, []byte{0xff, 0xd8}) {
+		return nil
+	}
+
+	var chunks [][]byte
+	jpegSegments(b, func(marker byte, segment []byte) bool {
+		if marker != 0xe2 || !bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")) || len(segment) < 14 {
+			return true
+		}
+
+		seq, count := int(segment[12]), int(segment[13])
+		if chunks == nil {
+			chunks = make([][]byte, count)
+		}
+		if seq >= 1 && seq <= len(chunks) {
+			chunks[seq-1] = segment[14:]
+		}
+		return true
+	})
+
+	var profile []byte
+	for _, chunk := range chunks {
+		if chunk == nil {
+			return nil
+		}
+		profile = append(profile, chunk...)
+	}
+
+	return profile
+}
+
+// iccNeedsConversion is whether an image with profile p has to be converted
+// to look right as sRGB, i.e. it's a CMYK or wide gamut RGB profile. Grey
+// profiles are left alone, the grid is read from the brightness.
+func iccNeedsConversion(p []byte) bool {
+	if len(p) < 132 {
+		return false
+	}
+
+	switch string(p[16:20]) {
+	case "GRAY":
+		return false
+	case "RGB ":
+		return !hasColorants(p, srgbColorants)
+	}
+
+	return true
+}
+
+// hasColorants is whether the rXYZ, gXYZ and bXYZ tags of profile p are c
+func hasColorants(p []byte, c colorants) bool {
+	tags := int(binary.BigEndian.Uint32(p[128:]))
+	for idx, sig := range []string{"rXYZ", "gXYZ", "bXYZ"} {
+		found := false
+		for tag := range tags {
+			entry := 132 + tag*12
+			if entry+12 > len(p) {
+				return false
+			}
+			if string(p[entry:entry+4]) != sig {
+				continue
+			}
+
+			offset := int(binary.BigEndian.Uint32(p[entry+4:]))
+			if offset+20 > len(p) || string(p[offset:offset+4]) != "XYZ " {
+				return false
+			}
+			for axis := range 3 {
+				v := float64(int32(binary.BigEndian.Uint32(p[offset+8+axis*4:]))) / 65536
+				if math.Abs(v-c[idx][axis]) > colorantTolerance {
+					return false
+				}
+			}
+			found = true
+			break
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// rgbProfile builds a version 2 ICC display profile for the RGB colour space
+// with primaries c and the sRGB tone curve
+func rgbProfile(description string, c colorants) []byte {
+	s15Fixed16 := func(v float64) []byte {
+		return binary.BigEndian.AppendUint32(nil, uint32(int32(math.Round(v*65536))))
+	}
+	xyz := func(v [3]float64) []byte {
+		b := []byte("XYZ \x00\x00\x00\x00")
+		for _, axis := range v {
+			b = append(b, s15Fixed16(axis)...)
+		}
+		return b
+	}
+
+	desc := []byte("desc\x00\x00\x00\x00")
+	desc = binary.BigEndian.AppendUint32(desc, uint32(len(description)+1))
+	desc = append(desc, description...)
+	// the terminator, then empty unicode and scriptcode descriptions
+	desc = append(desc, make([]byte, 1+4+4+2+1+67)...)
+
+	const entries = 1024
+	curve := []byte("curv\x00\x00\x00\x00")
+	curve = binary.BigEndian.AppendUint32(curve, entries)
+	for idx := range entries {
+		v := float64(idx) / (entries - 1)
+		if v <= 0.04045 {
+			v /= 12.92
+		} else {
+			v = math.Pow((v+0.055)/1.055, 2.4)
+		}
+		curve = binary.BigEndian.AppendUint16(curve, uint16(math.Round(v*65535)))
+	}
+
+	tags := []struct {
+		sig  string
+		data []byte
+	}{
+		{"desc", desc},
+		{"cprt", []byte("text\x00\x00\x00\x00No copyright, use freely\x00")},
+		{"wtpt", xyz([3]float64{0.9642, 1.0, 0.8249})},
+		{"rXYZ", xyz(c[0])},
+		{"gXYZ", xyz(c[1])},
+		{"bXYZ", xyz(c[2])},
+		{"rTRC", curve},
+		{"gTRC", curve},
+		{"bTRC", curve},
+	}
+
+	header := make([]byte, 128)
+	binary.BigEndian.PutUint32(header[8:], 0x02100000)
+	copy(header[12:], "mntrRGB XYZ ")
+	copy(header[36:], "acsp")
+	// the D50 illuminant of the profile connection space
+	copy(header[68:], xyz([3]float64{0.9642, 1.0, 0.8249})[8:])
+
+	table := binary.BigEndian.AppendUint32(nil, uint32(len(tags)))
+	var data []byte
+	// the tone curves are the same, so they share their data
+	offsets := map[*byte]int{}
+	start := len(header) + 4 + len(tags)*12
+	for _, tag := range tags {
+		offset, ok := offsets[&tag.data[0]]
+		if !ok {
+			offset = start + len(data)
+			offsets[&tag.data[0]] = offset
+			data = append(data, tag.data...)
+			// tag data starts on a 4 byte boundary
+			data = append(data, make([]byte, (4-len(data)%4)%4)...)
+		}
+
+		table = append(table, tag.sig...)
+		table = binary.BigEndian.AppendUint32(table, uint32(offset))
+		table = binary.BigEndian.AppendUint32(table, uint32(len(tag.data)))
+	}
+
+	profile := append(append(header, table...), data...)
+	binary.BigEndian.PutUint32(profile, uint32(len(profile)))
+
+	return profile
+}
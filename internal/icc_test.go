@@ -0,0 +1,92 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var displayP3Colorants = colorants{
+	{0.5151, 0.2412, -0.0011},
+	{0.2920, 0.6922, 0.0419},
+	{0.1571, 0.0666, 0.7841},
+}
+
+// withJPEGICC puts profile in APP2 segments of up to size bytes straight
+// after the start of image
+func withJPEGICC(b, profile []byte, size int) []byte {
+	count := (len(profile) + size - 1) / size
+	out := []byte{0xff, 0xd8}
+	for seq := range count {
+		chunk := profile[seq*size : min((seq+1)*size, len(profile))]
+		segment := append([]byte("ICC_PROFILE\x00"), byte(seq+1), byte(count))
+		segment = append(segment, chunk...)
+
+		out = append(out, 0xff, 0xe2)
+		out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+		out = append(out, segment...)
+	}
+
+	return append(out, b[2:]...)
+}
+
+func TestJPEGICCProfile(t *testing.T) {
+	b, err := os.ReadFile("../formats/grid.jpg")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Nil(t, jpegICCProfile(b))
+
+	// put back together in order
+	tagged := withJPEGICC(b, srgbProfile, 1000)
+	assert.Equal(t, srgbProfile, jpegICCProfile(tagged))
+
+	// without its second part
+	start := 2 + 4 + 14 + 1000
+	missing := append(append([]byte{}, tagged[:start]...), tagged[start+4+14+1000:]...)
+	assert.Nil(t, jpegICCProfile(missing))
+}
+
+func TestICCNeedsConversion(t *testing.T) {
+	assert.False(t, iccNeedsConversion(nil))
+	assert.False(t, iccNeedsConversion(srgbProfile))
+	assert.True(t, iccNeedsConversion(rgbProfile("Display P3", displayP3Colorants)))
+
+	// the colour space is in the header
+	cmyk := append([]byte{}, srgbProfile...)
+	copy(cmyk[16:], "CMYK")
+	assert.True(t, iccNeedsConversion(cmyk))
+	grey := append([]byte{}, srgbProfile...)
+	copy(grey[16:], "GRAY")
+	assert.False(t, iccNeedsConversion(grey))
+
+	// an RGB profile without colorants is converted
+	truncated := append([]byte{}, srgbProfile[:132]...)
+	assert.True(t, iccNeedsConversion(truncated))
+}
+
+func TestNeedsColourConversion(t *testing.T) {
+	b, err := os.ReadFile("../formats/grid.jpg")
+	if !assert.NoError(t, err) {
+		return
+	}
+	img, err := jpeg.Decode(bytes.NewReader(b))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	assert.False(t, needsColourConversion(b, img))
+	assert.False(t, needsColourConversion(withJPEGICC(b, srgbProfile, 60000), img))
+	assert.True(t, needsColourConversion(withJPEGICC(b, rgbProfile("Display P3", displayP3Colorants), 60000), img))
+
+	cmyk := image.NewCMYK(image.Rect(0, 0, 4, 4))
+	draw.Draw(cmyk, cmyk.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	assert.True(t, needsColourConversion(nil, cmyk))
+}
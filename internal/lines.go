@@ -0,0 +1,163 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+const (
+	// a row (or column) is part of a line when it holds at least this share
+	// of the ink of the fullest one, the outer border
+	minLineShare = 0.75
+	// lines after the first two may be this far (as a fraction of the
+	// spacing) from where they're expected, box lines are thicker so their
+	// centres shift a little
+	lineSpacingTolerance = 0.1
+	// closer lines can't be either side of a cell
+	minLineSpacing = 10
+)
+
+// gridLine is a run of rows (or columns) of ink, end is the
+// first row past it
+type gridLine struct {
+	start int
+	end   int
+}
+
+func (l gridLine) width() int {
+	return l.end - l.start
+}
+
+func (l gridLine) centre() float64 {
+	return float64(l.start+l.end) / 2
+}
+
+// projectionProfiles counts the ink (see InkMask) along every row and column
+// of the mask, indexed from its bounds
+func projectionProfiles(mask *InkMask) (rows, cols []int) {
+	bounds := mask.Bounds()
+	rows, cols = make([]int, bounds.Dy()), make([]int, bounds.Dx())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if mask.Ink(x, y) {
+				rows[y-bounds.Min.Y] += 1
+				cols[x-bounds.Min.X] += 1
+			}
+		}
+	}
+
+	return rows, cols
+}
+
+// profileLines finds the runs in a profile where nearly as many pixels are
+// ink as along the fullest row, a grid line runs the whole way
+// across the grid where a glyph only covers part of a cell. from is where
+// the profile starts.
+func profileLines(profile []int, from int) []gridLine {
+	threshold := float64(slices.Max(profile)) * minLineShare
+	if threshold == 0 {
+		return nil
+	}
+
+	lines := make([]gridLine, 0)
+	start := -1
+	for idx, count := range append(profile, 0) {
+		if float64(count) >= threshold {
+			if start < 0 {
+				start = idx
+			}
+			continue
+		}
+
+		if start >= 0 {
+			lines = append(lines, gridLine{start: from + start, end: from + idx})
+		}
+		start = -1
+	}
+
+	return lines
+}
+
+// regularLines picks the most evenly spaced lines that make a grid of a size
+// we know of, any others (a rule across the page, the dashes of a cage
+// outline) are left out. Each step is taken to the line closest to where
+// it's expected. nil when no lines make a grid.
+func regularLines(lines []gridLine) []gridLine {
+	var best []gridLine
+	var bestWidth int
+	for i := range lines {
+		for j := i + 1; j < len(lines); j++ {
+			spacing := lines[j].centre() - lines[i].centre()
+			if spacing < minLineSpacing {
+				continue
+			}
+
+			picked := []gridLine{lines[i], lines[j]}
+			for {
+				expected := picked[len(picked)-1].centre() + spacing
+				next, closest := -1, spacing*lineSpacingTolerance
+				for k := j + 1; k < len(lines); k++ {
+					if d := math.Abs(lines[k].centre() - expected); d <= closest {
+						next, closest = k, d
+					}
+				}
+				if next < 0 {
+					break
+				}
+				picked = append(picked, lines[next])
+			}
+
+			if _, err := ShapeForSize(len(picked) - 1); err != nil {
+				continue
+			}
+
+			// the longest run of lines wins, then the thickest
+			var width int
+			for _, l := range picked {
+				width += l.width()
+			}
+			if len(picked) > len(best) || (len(picked) == len(best) && width > bestWidth) {
+				best, bestWidth = picked, width
+			}
+		}
+	}
+
+	return best
+}
+
+// shapeFromLines takes the size from the number of lines and the boxes from
+// the thick ones among those inside the border. Grids without thick lines
+// have the usual boxes for their size.
+func (g *Grid) shapeFromLines(horizontal, vertical []gridLine) (Shape, error) {
+	if len(horizontal) != len(vertical) {
+		return Shape{}, fmt.Errorf("found %d horizontal and %d vertical lines, expected as many of each", len(horizontal), len(vertical))
+	}
+
+	widths := func(lines []gridLine) []int {
+		w := make([]int, 0, len(lines))
+		for _, l := range lines[1 : len(lines)-1] {
+			w = append(w, l.width())
+		}
+		return w
+	}
+
+	size := len(vertical) - 1
+	usual, err := ShapeForSize(size)
+	if err != nil {
+		return Shape{}, err
+	}
+
+	shape := Shape{Size: size, BoxRows: boxLength(widths(horizontal)), BoxCols: boxLength(widths(vertical))}
+	if shape.BoxRows == 0 || shape.BoxCols == 0 {
+		// no box separators to go by
+		return usual, nil
+	}
+
+	if !shape.Valid() {
+		Logger.Debug("unsupported box shape, assuming the usual boxes", "grid_id", g.Name, "shape", shape.String())
+		return usual, nil
+	}
+
+	return shape, nil
+}
@@ -5,7 +5,9 @@ import (
 	"os"
 )
 
-var Logger *slog.Logger
+// Logger defaults to info level until LoadLogger reads the environment, so
+// packages and tests using internal without the cli can log
+var Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
 
 func LoadLogger() {
 	opts := slog.HandlerOptions{}
@@ -14,6 +16,7 @@ func LoadLogger() {
 		opts.Level = slog.LevelDebug
 	}
 
-	Logger = slog.New(slog.NewTextHandler(os.Stdout, &opts))
-	// Logger = slog.New(slog.NewJSONHandler(os.Stdout, &opts))
+	// stderr so logs don't end up mixed in with the cli output
+	Logger = slog.New(slog.NewTextHandler(os.Stderr, &opts))
+	// Logger = slog.New(slog.NewJSONHandler(os.Stderr, &opts))
 }
@@ -0,0 +1,245 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+const (
+	// an upright grid whose values are recognised with at least this mean
+	// confidence isn't turned to look for a better orientation
+	minUprightConfidence = 90.0
+	exifOrientationTag   = 0x0112
+)
+
+// turns is how far each orientation search candidate is turned, in degrees
+// clockwise, and the EXIF orientation that turns it
+var turns = []struct {
+	degrees     int
+	orientation int
+}{
+	{0, 1},
+	{90, 6},
+	{180, 3},
+	{270, 8},
+}
+
+// exifOrientation is the orientation tag (1 to 8) in the EXIF of a JPEG,
+// PNG, WebP or TIFF image, 0 when there isn't one. HEIC images are oriented
+// by ImageMagick when they're decoded.
+func exifOrientation(b []byte) int {
+	switch {
+	case bytes.HasPrefix(b, []byte{0xff, 0xd8}):
+		// EXIF is in APP1
+		orientation := 0
+		jpegSegments(b, func(marker byte, segment []byte) bool {
+			if marker == 0xe1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+				orientation = tiffOrientation(segment[6:])
+				return false
+			}
+			return true
+		})
+		return orientation
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		for pos := 8; pos+8 <= len(b); {
+			length := int(binary.BigEndian.Uint32(b[pos:]))
+			if pos+12+length > len(b) {
+				break
+			}
+
+			if string(b[pos+4:pos+8]) == "eXIf" {
+				return tiffOrientation(b[pos+8 : pos+8+length])
+			}
+			pos += 12 + length
+		}
+	case len(b) >= 12 && string(b[:4]) == "RIFF" && string(b[8:12]) == "WEBP":
+		for pos := 12; pos+8 <= len(b); {
+			length := int(binary.LittleEndian.Uint32(b[pos+4:]))
+			if pos+8+length > len(b) {
+				break
+			}
+
+			if string(b[pos:pos+4]) == "EXIF" {
+				return tiffOrientation(bytes.TrimPrefix(b[pos+8:pos+8+length], []byte("Exif\x00\x00")))
+			}
+			pos += 8 + length + length%2
+		}
+	case bytes.HasPrefix(b, []byte("II*\x00")), bytes.HasPrefix(b, []byte("MM\x00*")):
+		return tiffOrientation(b)
+	}
+
+	return 0
+}
+
+// tiffOrientation reads the orientation tag from the first IFD of a TIFF
+// structure, which EXIF is
+func tiffOrientation(b []byte) int {
+	if len(b) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(b[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(b[4:]))
+	if ifd+2 > len(b) {
+		return 0
+	}
+
+	entries := int(order.Uint16(b[ifd:]))
+	for idx := range entries {
+		entry := ifd + 2 + idx*12
+		if entry+12 > len(b) {
+			return 0
+		}
+
+		if order.Uint16(b[entry:]) == exifOrientationTag {
+			if o := int(order.Uint16(b[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+
+	return 0
+}
+
+// orientImage applies an EXIF orientation to img, turning and flipping it the
+// way the camera was held. 5 to 8 swap its width and height.
+func orientImage(img image.Image, orientation int) *image.RGBA {
+	bounds := img.Bounds()
+	src := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+
+	w, h := bounds.Dx(), bounds.Dy()
+	if orientation <= 1 || orientation > 8 {
+		return src
+	}
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[dst.PixOffset(x, y):dst.PixOffset(x, y)+4], src.Pix[src.PixOffset(sx, sy):])
+		}
+	}
+
+	return dst
+}
+
+// unturnRect is where r, in an image of size turned degrees clockwise, was
+// before it was turned
+func unturnRect(r image.Rectangle, size image.Point, degrees int) image.Rectangle {
+	switch degrees {
+	case 90:
+		return image.Rect(r.Min.Y, size.X-r.Max.X, r.Max.Y, size.X-r.Min.X)
+	case 180:
+		return image.Rect(size.X-r.Max.X, size.Y-r.Max.Y, size.X-r.Min.X, size.Y-r.Min.Y)
+	case 270:
+		return image.Rect(size.Y-r.Max.Y, r.Min.X, size.Y-r.Min.Y, r.Max.X)
+	}
+
+	return r
+}
+
+// recognitionScore sums the confidence of every value in the grid, values
+// read by ocr (which has no confidence) count fully
+func (g *Grid) recognitionScore() (score float64, values int) {
+	for _, row := range g.Cells {
+		for _, c := range row {
+			if c.Type() != CellTypeValue {
+				continue
+			}
+
+			values += 1
+			if confidence, ok := c.Confidence(); ok {
+				score += confidence
+			} else {
+				score += 100
+			}
+		}
+	}
+
+	return score, values
+}
+
+// readTurned reads the grid upright, then turned a quarter at a time,
+// keeping the turn its values are recognised best at. An upright grid that's
+// valid and recognised confidently, as one oriented from its EXIF will be,
+// isn't turned at all. The debug bundle is only filled for the turn kept.
+func readTurned(img image.Image, name string, worker *GridWorker, opts ReadOptions) (*Grid, error) {
+	debug := opts.Debug
+	opts.Debug = nil
+
+	var best *Grid
+	var bestScore float64
+	var bestImg image.Image
+	var lastErr error
+	for _, turn := range turns {
+		turned := orientImage(img, turn.orientation)
+		grid, err := readGrid(turned, name, worker, opts)
+		if err != nil {
+			Logger.Debug("failed to read turned grid", "grid_id", name, "degrees", turn.degrees, "error", err)
+			lastErr = err
+			continue
+		}
+
+		grid.Orientation = turn.degrees
+		score, values := grid.recognitionScore()
+		Logger.Debug("read turned grid", "grid_id", name, "degrees", turn.degrees, "values", values, "score", score)
+		if best == nil || score > bestScore {
+			best, bestScore, bestImg = grid, score, turned
+		}
+
+		if turn.degrees == 0 && values > 0 && score/float64(values) >= minUprightConfidence && grid.Valid() {
+			break
+		}
+	}
+
+	if best == nil {
+		return nil, lastErr
+	}
+
+	if debug == nil {
+		return best, nil
+	}
+
+	opts.Debug = debug
+	grid, err := readGrid(bestImg, name, worker, opts)
+	if err != nil {
+		return nil, err
+	}
+	grid.Orientation = best.Orientation
+
+	return grid, nil
+}
@@ -0,0 +1,172 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// exifTIFF is EXIF holding only an orientation tag
+func exifTIFF(order binary.ByteOrder, orientation int) []byte {
+	b := make([]byte, 8+2+12+4)
+	copy(b, "MM")
+	if order == binary.LittleEndian {
+		copy(b, "II")
+	}
+	order.PutUint16(b[2:], 42)
+	order.PutUint32(b[4:], 8)
+	order.PutUint16(b[8:], 1)
+	order.PutUint16(b[10:], exifOrientationTag)
+	order.PutUint16(b[12:], 3) // SHORT
+	order.PutUint32(b[14:], 1)
+	order.PutUint16(b[18:], uint16(orientation))
+
+	return b
+}
+
+// withJPEGExif puts exif in an APP1 segment straight after the start of image
+func withJPEGExif(b, exif []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), exif...)
+	out := []byte{0xff, 0xd8, 0xff, 0xe1}
+	out = binary.BigEndian.AppendUint16(out, uint16(len(segment)+2))
+	out = append(out, segment...)
+
+	return append(out, b[2:]...)
+}
+
+// withPNGExif puts exif in an eXIf chunk after IHDR
+func withPNGExif(b, exif []byte) []byte {
+	const afterHeader = 8 + 8 + 13 + 4
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(exif)))
+	chunk = append(chunk, "eXIf"...)
+	chunk = append(chunk, exif...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+
+	out := append([]byte{}, b[:afterHeader]...)
+	out = append(out, chunk...)
+
+	return append(out, b[afterHeader:]...)
+}
+
+func TestDecodeImage_ExifOrientation(t *testing.T) {
+	upright, err := LoadImage("../formats/grid.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+	want := NormaliseImage(upright)
+
+	// the orientation that undoes each, what the camera would have stored
+	stored := map[int]int{1: 1, 2: 2, 3: 3, 4: 4, 5: 5, 6: 8, 7: 7, 8: 6}
+	for orientation := 1; orientation <= 8; orientation++ {
+		t.Run(fmt.Sprintf("png orientation %d", orientation), func(t *testing.T) {
+			var buf bytes.Buffer
+			if !assert.NoError(t, png.Encode(&buf, orientImage(upright, stored[orientation]))) {
+				return
+			}
+
+			b := withPNGExif(buf.Bytes(), exifTIFF(binary.LittleEndian, orientation))
+			assert.Equal(t, orientation, exifOrientation(b))
+
+			img, err := DecodeImage(b)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, want, NormaliseImage(img))
+		})
+	}
+
+	t.Run("jpeg orientation 6", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, jpeg.Encode(&buf, orientImage(upright, 8), &jpeg.Options{Quality: 95})) {
+			return
+		}
+
+		b := withJPEGExif(buf.Bytes(), exifTIFF(binary.BigEndian, 6))
+		assert.Equal(t, 6, exifOrientation(b))
+
+		img, err := DecodeImage(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		g := GridFromImage(img, "jpeg")
+		if assert.NoError(t, g.SplitCells(ModeComparison)) {
+			assert.Equal(t, ClassicShape, g.Shape)
+		}
+	})
+
+	t.Run("no exif", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, png.Encode(&buf, upright)) {
+			return
+		}
+		assert.Equal(t, 0, exifOrientation(buf.Bytes()))
+	})
+}
+
+func TestExifOrientation_Markers(t *testing.T) {
+	upright, err := LoadImage("../formats/grid.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if !assert.NoError(t, jpeg.Encode(&buf, upright, nil)) {
+		return
+	}
+	jpg := buf.Bytes()
+
+	// a zero length after SOI, which Go's decoder skips over
+	zeroLength := append([]byte{0xff, 0xd8, 0xff, 0x00, 0x00, 0x00}, jpg[2:]...)
+	assert.NotPanics(t, func() {
+		assert.Equal(t, 0, exifOrientation(zeroLength))
+		_, _ = DecodeImage(zeroLength)
+	})
+
+	for _, b := range [][]byte{
+		{0xff, 0xd8, 0xff, 0xe1, 0x00, 0x01},
+		{0xff, 0xd8, 0xff, 0xe1, 0xff, 0xff},
+		{0xff, 0xd8, 0xff, 0xff, 0xff},
+	} {
+		assert.NotPanics(t, func() {
+			assert.Equal(t, 0, exifOrientation(b))
+		})
+	}
+
+	// fill bytes and standalone markers are stepped over
+	withExif := withJPEGExif(jpg, exifTIFF(binary.BigEndian, 6))
+	padded := append([]byte{0xff, 0xd8, 0xff, 0xff, 0xff, 0x01, 0xff, 0xd3}, withExif[2:]...)
+	assert.Equal(t, 6, exifOrientation(padded))
+}
+
+func TestUnturnRect(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	mark := image.Rect(5, 3, 12, 20)
+	draw.Draw(img, mark, image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	for _, turn := range turns {
+		t.Run(fmt.Sprintf("%d degrees", turn.degrees), func(t *testing.T) {
+			turned := orientImage(img, turn.orientation)
+
+			var found image.Rectangle
+			for y := turned.Bounds().Min.Y; y < turned.Bounds().Max.Y; y++ {
+				for x := turned.Bounds().Min.X; x < turned.Bounds().Max.X; x++ {
+					if turned.RGBAAt(x, y).A != 0 {
+						found = found.Union(image.Rect(x, y, x+1, y+1))
+					}
+				}
+			}
+
+			assert.Equal(t, mark, unturnRect(found, turned.Bounds().Size(), turn.degrees))
+		})
+	}
+}
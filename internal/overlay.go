@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// colours hands out a pixel wand per colour, each made once and destroyed
+// with the rest once drawing is done. Drawing wands copy the colours they're
+// given so they can go as soon as they're set.
+type colours map[string]*imagick.PixelWand
+
+func (cs colours) get(c string) *imagick.PixelWand {
+	if pw, ok := cs[c]; ok {
+		return pw
+	}
+
+	pw := imagick.NewPixelWand()
+	pw.SetColor(c)
+	cs[c] = pw
+
+	return pw
+}
+
+func (cs colours) Destroy() {
+	for c, pw := range cs {
+		pw.Destroy()
+		delete(cs, c)
+	}
+}
+
+func drawRect(dw *imagick.DrawingWand, r image.Rectangle, stroke *imagick.PixelWand, width float64) {
+	dw.SetStrokeColor(stroke)
+	dw.SetStrokeWidth(width)
+	dw.Rectangle(float64(r.Min.X), float64(r.Min.Y), float64(r.Max.X-1), float64(r.Max.Y-1))
+}
+
+// cellOutlineColour colours a cell's rectangle in the overlay by how sure we
+// are of its value, like the render (see confidenceColour), blue when there's
+// no confidence to go by
+func cellOutlineColour(c *Cell) string {
+	if confidence, ok := c.Confidence(); ok {
+		return confidenceColour(confidence)
+	}
+
+	return "blue"
+}
+
+// DebugOverlay draws the detected geometry over the input image: the grid
+// boundaries and separator thickness, every cell rectangle from SplitCells
+// (coloured by confidence), the placeholder rectangles from
+// ProcessPlaceholders and the label recognised for each cell. Returns PNG
+// bytes.
+func (g *Grid) DebugOverlay() ([]byte, error) {
+	wand := g.img.wand.Clone()
+	defer wand.Destroy()
+
+	dw := imagick.NewDrawingWand()
+	defer dw.Destroy()
+
+	palette := colours{}
+	defer palette.Destroy()
+
+	// outlines only, the fill is reset before drawing any text. Outlines
+	// aren't anti-aliased so their colours are kept.
+	dw.SetFillColor(palette.get("none"))
+	dw.SetStrokeAntialias(false)
+
+	drawRect(dw, g.boundaries, palette.get("red"), 3)
+
+	for _, row := range g.Cells {
+		for _, cell := range row {
+			if cell == nil {
+				continue
+			}
+
+			drawRect(dw, cell.image.Image.Bounds(), palette.get(cellOutlineColour(cell)), 1)
+
+			for _, r := range cell.placeholderRects {
+				drawRect(dw, r, palette.get("orange"), 1)
+			}
+		}
+	}
+
+	dw.SetStrokeColor(palette.get("none"))
+	dw.SetFillColor(palette.get("magenta"))
+	dw.SetFontSize(float64(max(12, g.cellWidth/5)))
+
+	for _, row := range g.Cells {
+		for _, cell := range row {
+			if cell == nil {
+				continue
+			}
+
+			bounds := cell.image.Image.Bounds()
+			label := cell.Label()
+			if label == "" {
+				label = "-"
+			}
+
+			dw.Annotation(
+				float64(bounds.Min.X+2),
+				float64(bounds.Max.Y-4),
+				fmt.Sprintf("%s %s", cell.Identifier, label),
+			)
+		}
+	}
+
+	dw.SetFillColor(palette.get("red"))
+	dw.SetFontSize(float64(max(14, g.separatorThickness*2)))
+	dw.Annotation(
+		float64(g.boundaries.Min.X),
+		float64(max(g.boundaries.Min.Y-6, 14)),
+		fmt.Sprintf(
+			"boundaries %v, separator %dpx, cell %dpx",
+			g.boundaries, g.separatorThickness, g.cellWidth,
+		),
+	)
+
+	if err := wand.DrawImage(dw); err != nil {
+		return nil, fmt.Errorf("drawing overlay: %v", err)
+	}
+
+	if err := wand.SetImageFormat("png"); err != nil {
+		return nil, fmt.Errorf("setting png format: %v", err)
+	}
+
+	b, err := wand.GetImageBlob()
+	if err != nil {
+		return nil, fmt.Errorf("getting overlay bytes: %v", err)
+	}
+
+	return b, nil
+}
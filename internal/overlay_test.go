@@ -0,0 +1,65 @@
+package internal
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+func TestCellOutlineColour(t *testing.T) {
+	g := newTestGrid([][]string{{"1", "", "", ""}, {"", "", "", ""}, {"", "", "", ""}, {"", "", "", ""}}, ModeComparison)
+	assert.Equal(t, "blue", cellOutlineColour(g.Cells[0][0]))
+
+	g.Cells[0][0].comparisonDistortion = 0
+	assert.Equal(t, confidenceColour(100), cellOutlineColour(g.Cells[0][0]))
+
+	g.Cells[0][0].comparisonDistortion = 5
+	assert.Equal(t, confidenceColour(renderMinConfidence), cellOutlineColour(g.Cells[0][0]))
+}
+
+func TestGrid_DebugOverlay(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	img, err := LoadImage("../formats/grid.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	g := GridFromImage(img, "overlay")
+	if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+		return
+	}
+	known := g.Cells[4][4]
+	known.comparisonValue, known.comparisonDistortion = 7, 0
+
+	b, err := g.DebugOverlay()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	overlay, err := png.Decode(bytes.NewReader(b))
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, img.Bounds().Size(), overlay.Bounds().Size())
+
+	// the colours around the middle of the left side of a cell's rectangle
+	outline := func(c *Cell) []string {
+		bounds := c.image.Image.Bounds()
+		mid := bounds.Min.Y + bounds.Dy()/2
+
+		var colours []string
+		for x := bounds.Min.X - 1; x <= bounds.Min.X+1; x++ {
+			colours = append(colours, hexColour(overlay.At(x, mid)))
+		}
+		return colours
+	}
+
+	assert.Contains(t, outline(known), confidenceColour(100))
+	// a cell that wasn't processed has no confidence
+	assert.Contains(t, outline(g.Cells[0][0]), "#0000ff")
+}
@@ -0,0 +1,231 @@
+package internal
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"slices"
+)
+
+const (
+	// a pencil mark is between these heights relative to the cell, values are
+	// around half the cell height
+	minPlaceholderHeight = 0.08
+	maxPlaceholderHeight = 0.33
+	// glyphs whose centroids are closer than this many glyph heights apart
+	// are written next to each other, like a centre mark
+	centreMarkSpacing = 1.5
+	// apps that have both draw centre marks larger than corner marks, a glyph
+	// in the middle this much taller than the others is a centre mark
+	centreMarkHeight = 1.15
+)
+
+// placeholderGlyph is a single pencil mark found in a cell
+type placeholderGlyph struct {
+	// bounds of the glyph in grid image coordinates
+	rect    image.Rectangle
+	centreX float64
+	centreY float64
+	// the position of the centroid in the cell's 3x3 layout, 1 to 9
+	slot int
+	// pre-processed crop of just this glyph
+	image *GridImage
+
+	// -1 until recognised
+	digit int
+	// written across the middle of the cell rather than in a corner or at the
+	// position of its digit
+	centre bool
+}
+
+func colourDistance(a, b color.Color) int {
+	ca := color.NRGBAModel.Convert(a).(color.NRGBA)
+	cb := color.NRGBAModel.Convert(b).(color.NRGBA)
+
+	diff := func(x, y uint8) int {
+		return max(int(x)-int(y), int(y)-int(x))
+	}
+
+	return max(diff(ca.R, cb.R), diff(ca.G, cb.G), diff(ca.B, cb.B))
+}
+
+// glyphsIn segments region of the cell into connected components, keeping
+// those between minHeight and maxHeight (relative to the cell height) that
+// keep allows. Each glyph is cropped on its own, with any other glyph
+// overlapping its bounds painted out, and pre-processed.
+func (c *Cell) glyphsIn(region image.Rectangle, minHeight, maxHeight float64, keep func(b image.Rectangle) bool) ([]*placeholderGlyph, error) {
+	cellBounds := c.image.Image.Bounds()
+	region = region.Intersect(cellBounds)
+	background := c.Background()
+	mask := c.image.Mask()
+
+	components, labels := labelComponents(region, mask.Ink)
+
+	glyphs := make([]*placeholderGlyph, 0)
+	for idx, component := range components {
+		height := float64(component.bounds.Dy())
+		if height < float64(cellBounds.Dy())*minHeight || height > float64(cellBounds.Dy())*maxHeight {
+			continue
+		}
+
+		b := component.bounds
+		if !keep(b) {
+			continue
+		}
+
+		// a pixel of padding so pre-processing finds the background colour
+		rect := b.Inset(-1).Intersect(region)
+		masked := image.NewNRGBA(rect)
+		draw.Draw(masked, rect, c.image.Image, rect.Min, draw.Src)
+		for y := rect.Min.Y; y < rect.Max.Y; y++ {
+			for x := rect.Min.X; x < rect.Max.X; x++ {
+				label := labels[(y-region.Min.Y)*region.Dx()+(x-region.Min.X)]
+				if label != 0 && label != idx+1 {
+					masked.Set(x, y, background)
+				}
+			}
+		}
+
+		centreX, centreY := component.centroid()
+		col := min(2, max(0, int((centreX-float64(cellBounds.Min.X))*3/float64(cellBounds.Dx()))))
+		row := min(2, max(0, int((centreY-float64(cellBounds.Min.Y))*3/float64(cellBounds.Dy()))))
+
+		glyph := &placeholderGlyph{
+			rect:    b,
+			centreX: centreX,
+			centreY: centreY,
+			slot:    row*3 + col + 1,
+			digit:   -1,
+		}
+
+		glyph.image = NewGridImage(masked, fmt.Sprintf("%s/p%d-%d/", c.Identifier, glyph.slot, len(glyphs)+1))
+		glyph.image.debug = c.image.debug
+
+		if err := glyph.image.RunPreProcessing(); err != nil {
+			return nil, fmt.Errorf("running pre-processing on glyph: %v", err)
+		}
+
+		if glyph.image.wand.GetImageHeight() == 1 || glyph.image.wand.GetImageWidth() == 1 {
+			continue
+		}
+
+		glyphs = append(glyphs, glyph)
+	}
+
+	return glyphs, nil
+}
+
+// placeholderGlyphs finds the glyphs the size of a pencil mark, ignoring
+// those touching the cell edge (what's left of a grid line) and, in killer
+// grids, the cage outline and sum
+func (c *Cell) placeholderGlyphs() ([]*placeholderGlyph, error) {
+	cellBounds := c.image.Image.Bounds()
+	cageBand := cellBounds.Inset(c.cageInset + 2)
+
+	glyphs, err := c.glyphsIn(cellBounds, minPlaceholderHeight, maxPlaceholderHeight, func(b image.Rectangle) bool {
+		if b.Min.X == cellBounds.Min.X || b.Min.Y == cellBounds.Min.Y || b.Max.X == cellBounds.Max.X || b.Max.Y == cellBounds.Max.Y {
+			return false
+		}
+
+		if c.cageInset > 0 && !b.Overlaps(cageBand) {
+			return false
+		}
+
+		return !b.Overlaps(c.cageSumRect)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	c.placeholderRects = c.placeholderRects[:0]
+	for _, g := range glyphs {
+		c.placeholderRects = append(c.placeholderRects, g.rect)
+	}
+
+	return glyphs, nil
+}
+
+// markCentreGlyphs flags the recognised glyphs written across the middle of
+// the cell. Apps that put a pencil mark at the position of its digit (NYT)
+// only have corner style marks, Sudoku.com, Logic Masters and SudokuPad also
+// write centre marks through the middle of the cell. A glyph in the middle
+// third is a centre mark when:
+//
+//   - it sits in a tight row with another glyph, corner marks are spread out
+//   - it's noticeably taller than the glyphs outside the middle third
+//   - it's alone in the centre but isn't a 5, so it can't be at its own position
+func markCentreGlyphs(glyphs []*placeholderGlyph, cellBounds image.Rectangle) {
+	third := float64(cellBounds.Dy()) / 3
+	inMiddle := func(g *placeholderGlyph) bool {
+		y := g.centreY - float64(cellBounds.Min.Y)
+		return y >= third && y < third*2
+	}
+
+	cornerHeights := make([]int, 0, len(glyphs))
+	for _, g := range glyphs {
+		if !inMiddle(g) {
+			cornerHeights = append(cornerHeights, g.rect.Dy())
+		}
+	}
+	slices.Sort(cornerHeights)
+
+	for _, g := range glyphs {
+		if !inMiddle(g) {
+			continue
+		}
+
+		if len(cornerHeights) > 0 {
+			median := cornerHeights[len(cornerHeights)/2]
+			if float64(g.rect.Dy()) >= float64(median)*centreMarkHeight {
+				g.centre = true
+				continue
+			}
+		}
+
+		if g.slot == 5 && g.digit != 5 {
+			g.centre = true
+			continue
+		}
+
+		for _, other := range glyphs {
+			if other == g || !inMiddle(other) {
+				continue
+			}
+
+			spacing := max(g.centreX-other.centreX, other.centreX-g.centreX)
+			if spacing < float64(g.rect.Dy())*centreMarkSpacing {
+				g.centre = true
+				break
+			}
+		}
+	}
+}
+
+// setMarks records the recognised glyphs, placeholders holds every digit
+// whether it's a corner or a centre mark
+func (c *Cell) setMarks(glyphs []*placeholderGlyph) {
+	markCentreGlyphs(glyphs, c.image.Image.Bounds())
+
+	for _, g := range glyphs {
+		if g.digit == -1 {
+			continue
+		}
+
+		if !slices.Contains(c.comparisonPlaceholders, g.digit) {
+			c.comparisonPlaceholders = append(c.comparisonPlaceholders, g.digit)
+		}
+
+		marks := &c.cornerMarks
+		if g.centre {
+			marks = &c.centreMarks
+		}
+		if !slices.Contains(*marks, g.digit) {
+			*marks = append(*marks, g.digit)
+		}
+	}
+
+	slices.Sort(c.comparisonPlaceholders)
+	slices.Sort(c.cornerMarks)
+	slices.Sort(c.centreMarks)
+}
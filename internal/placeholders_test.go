@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+type testMark struct {
+	digit int
+	// centre of the glyph as a fraction of the cell
+	x, y float64
+}
+
+// newMarksTestCell draws the placeholder templates onto a blank cell of the
+// given size, scaled by scale
+func newMarksTestCell(t *testing.T, size int, scale float64, marks []testMark) *Cell {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	for _, m := range marks {
+		glyph, err := LoadImage(fmt.Sprintf("../t-placeholders/%d.png", m.digit))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+
+		gb := glyph.Bounds()
+		w, h := int(float64(gb.Dx())*scale), int(float64(gb.Dy())*scale)
+		x0, y0 := int(m.x*float64(size))-w/2, int(m.y*float64(size))-h/2
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				c := glyph.At(gb.Min.X+int(float64(x)/scale), gb.Min.Y+int(float64(y)/scale))
+				if _, _, _, a := c.RGBA(); a > 0x8000 {
+					img.Set(x0+x, y0+y, color.Black)
+				}
+			}
+		}
+	}
+
+	return NewCell(img.Bounds(), img, "R1C1", ModeComparison)
+}
+
+func TestCell_PlaceholderGlyphs(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	tests := []struct {
+		name   string
+		size   int
+		scale  float64
+		marks  []testMark
+		slots  []int
+		centre []bool
+	}{
+		{
+			name:   "nyt positions",
+			size:   118,
+			scale:  1,
+			marks:  []testMark{{1, 1.0 / 6, 1.0 / 6}, {5, 0.5, 0.5}, {9, 5.0 / 6, 5.0 / 6}},
+			slots:  []int{1, 5, 9},
+			centre: []bool{false, false, false},
+		},
+		{
+			name:   "smaller cell",
+			size:   70,
+			scale:  0.6,
+			marks:  []testMark{{2, 0.5, 1.0 / 6}, {4, 1.0 / 6, 0.5}, {6, 5.0 / 6, 0.5}},
+			slots:  []int{2, 4, 6},
+			centre: []bool{false, false, false},
+		},
+		{
+			name:   "centre marks",
+			size:   118,
+			scale:  1,
+			marks:  []testMark{{1, 0.36, 0.5}, {3, 0.5, 0.5}, {8, 0.64, 0.5}},
+			slots:  []int{5, 5, 5},
+			centre: []bool{true, true, true},
+		},
+		{
+			name:   "corner and centre marks",
+			size:   118,
+			scale:  1,
+			marks:  []testMark{{7, 0.15, 0.15}, {2, 0.5, 0.5}},
+			slots:  []int{1, 5},
+			centre: []bool{false, true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newMarksTestCell(t, tt.size, tt.scale, tt.marks)
+
+			glyphs, err := c.placeholderGlyphs()
+			if !assert.NoError(t, err) || !assert.Len(t, glyphs, len(tt.marks)) {
+				return
+			}
+
+			// glyphs come back in scan order, match each to the closest mark
+			marks := make([]int, len(glyphs))
+			for idx, g := range glyphs {
+				closest := math.Inf(1)
+				for m, mark := range tt.marks {
+					d := math.Hypot(g.centreX-mark.x*float64(tt.size), g.centreY-mark.y*float64(tt.size))
+					if d < closest {
+						closest = d
+						marks[idx] = m
+					}
+				}
+
+				g.digit = tt.marks[marks[idx]].digit
+				assert.Equal(t, tt.slots[marks[idx]], g.slot, "digit %d", g.digit)
+			}
+
+			markCentreGlyphs(glyphs, c.image.Image.Bounds())
+			for idx, g := range glyphs {
+				assert.Equal(t, tt.centre[marks[idx]], g.centre, "digit %d", g.digit)
+			}
+		})
+	}
+}
+
+// marks/ holds cells drawn in the styles of the apps we read, truth.json lists
+// the corner and centre marks of each
+func TestCell_Marks(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	b, err := os.ReadFile("../marks/truth.json")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var truth map[string]struct {
+		Corner []int `json:"corner"`
+		Centre []int `json:"centre"`
+	}
+	if !assert.NoError(t, json.Unmarshal(b, &truth)) {
+		return
+	}
+
+	classifier, err := defaultClassifier()
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for name, expected := range truth {
+		t.Run(name, func(t *testing.T) {
+			img, err := LoadImage(fmt.Sprintf("../marks/%s.png", name))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			c := NewCell(img.Bounds(), img, "R1C1", ModeClassifier)
+			if !assert.NoError(t, c.ClassifyPlaceholders(classifier)) {
+				return
+			}
+
+			corner, centre := c.Marks()
+			assert.ElementsMatch(t, expected.Corner, corner, "corner marks")
+			assert.ElementsMatch(t, expected.Centre, centre, "centre marks")
+		})
+	}
+}
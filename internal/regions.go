@@ -0,0 +1,292 @@
+package internal
+
+import (
+	"image"
+	"slices"
+)
+
+const (
+	// how far into each cell a separator is followed, as a fraction of the
+	// cell width, region borders are often drawn over the cell edges
+	separatorReach = 0.15
+)
+
+// Regions maps every cell to the region it belongs to, numbered from 1 in
+// the order their first cell is met reading left to right, top to bottom.
+// Classic grids have the 3x3 boxes, jigsaw grids irregular shapes.
+type Regions [][]int
+
+// StandardRegions are the boxes of a grid of the given shape
+func StandardRegions(shape Shape) Regions {
+	boxesAcross := shape.Size / shape.BoxCols
+
+	r := make(Regions, shape.Size)
+	for row := range r {
+		r[row] = make([]int, shape.Size)
+		for col := range r[row] {
+			r[row][col] = row/shape.BoxRows*boxesAcross + col/shape.BoxCols + 1
+		}
+	}
+
+	return r
+}
+
+// Equal reports whether both map every cell to the same region
+func (r Regions) Equal(other Regions) bool {
+	return slices.EqualFunc(r, other, slices.Equal)
+}
+
+// Valid reports whether there are as many regions as rows, each of as many
+// cells and connected
+func (r Regions) Valid() bool {
+	n := len(r)
+	sizes := make([]int, n+1)
+	for _, row := range r {
+		if len(row) != n {
+			return false
+		}
+
+		for _, id := range row {
+			if id < 1 || id > n {
+				return false
+			}
+			sizes[id] += 1
+		}
+	}
+
+	for id := 1; id <= n; id++ {
+		if sizes[id] != n {
+			return false
+		}
+	}
+
+	// flood filling each region from any of its cells must reach all of them
+	seen := newSeen(n)
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			if seen[row][col] {
+				continue
+			}
+
+			id := r[row][col]
+			if len(floodFill(row, col, seen, func(fromRow, fromCol, toRow, toCol int) bool {
+				return r[toRow][toCol] == id
+			})) != n {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// members lists the cells of each region, indexed by region id
+func (r Regions) members() [][][2]int {
+	m := make([][][2]int, len(r)+1)
+	for row := range r {
+		for col, id := range r[row] {
+			m[id] = append(m[id], [2]int{row, col})
+		}
+	}
+
+	return m
+}
+
+func newSeen(n int) [][]bool {
+	seen := make([][]bool, n)
+	for row := range seen {
+		seen[row] = make([]bool, n)
+	}
+
+	return seen
+}
+
+// floodFill visits every cell reachable from row, col where connected allows
+// the step between neighbours, marking them in seen
+func floodFill(row, col int, seen [][]bool, connected func(fromRow, fromCol, toRow, toCol int) bool) [][2]int {
+	n := len(seen)
+	seen[row][col] = true
+	visited := [][2]int{{row, col}}
+
+	for i := 0; i < len(visited); i++ {
+		r, c := visited[i][0], visited[i][1]
+		for _, next := range [4][2]int{{r - 1, c}, {r, c + 1}, {r + 1, c}, {r, c - 1}} {
+			if next[0] < 0 || next[0] >= n || next[1] < 0 || next[1] >= n || seen[next[0]][next[1]] || !connected(r, c, next[0], next[1]) {
+				continue
+			}
+
+			seen[next[0]][next[1]] = true
+			visited = append(visited, next)
+		}
+	}
+
+	return visited
+}
+
+// measureSeparator measures the line between two neighbouring cells, the
+// longest run of separator pixels crossing the gap between them, at a few
+// points along it. The median ignores a glyph that strays near the edge.
+func (g *Grid) measureSeparator(a, b *Cell) int {
+	ab, bb := a.image.Image.Bounds(), b.image.Image.Bounds()
+	horizontal := ab.Min.Y == bb.Min.Y
+	// highlights aren't ink, so neither cell's background is
+	mask := g.img.Mask()
+	reach := int(float64(g.cellWidth) * separatorReach)
+
+	samples := make([]int, 0, 5)
+	for _, offset := range []float64{0.2, 0.35, 0.5, 0.65, 0.8} {
+		// walk across the gap from inside a to inside b
+		var from, to, across int
+		if horizontal {
+			from, to = ab.Max.X-reach, bb.Min.X+reach
+			across = ab.Min.Y + int(float64(ab.Dy())*offset)
+		} else {
+			from, to = ab.Max.Y-reach, bb.Min.Y+reach
+			across = ab.Min.X + int(float64(ab.Dx())*offset)
+		}
+		gapStart, gapEnd := from+reach, to-reach
+
+		var longest, run int
+		for pos := from; pos < to; pos++ {
+			p := image.Point{pos, across}
+			if !horizontal {
+				p = image.Point{across, pos}
+			}
+
+			if !mask.Ink(p.X, p.Y) {
+				run = 0
+				continue
+			}
+
+			run += 1
+			// only runs that reach into the gap are the separator
+			if pos >= gapStart && pos-run+1 < max(gapEnd, gapStart+1) {
+				longest = max(longest, run)
+			}
+		}
+
+		samples = append(samples, longest)
+	}
+
+	slices.Sort(samples)
+	return samples[len(samples)/2]
+}
+
+// splitThickness picks the threshold between thin separators and region
+// borders that best separates the two (the largest between class variance),
+// ok is false when all the separators are alike
+func splitThickness(thicknesses []int) (threshold int, ok bool) {
+	sorted := slices.Clone(thicknesses)
+	slices.Sort(sorted)
+	if len(sorted) == 0 || sorted[len(sorted)-1]-sorted[0] < 2 {
+		return 0, false
+	}
+
+	var total int
+	for _, t := range sorted {
+		total += t
+	}
+
+	var best float64
+	var belowSum int
+	for idx := 0; idx < len(sorted)-1; idx++ {
+		belowSum += sorted[idx]
+		if sorted[idx] == sorted[idx+1] {
+			continue
+		}
+
+		below, above := float64(idx+1), float64(len(sorted)-idx-1)
+		belowMean := float64(belowSum) / below
+		aboveMean := float64(total-belowSum) / above
+		variance := below * above * (aboveMean - belowMean) * (aboveMean - belowMean)
+
+		if variance > best {
+			best = variance
+			threshold = sorted[idx+1]
+		}
+	}
+
+	return threshold, true
+}
+
+// FindRegions rebuilds the region map from the thickness of the separators
+// between every pair of neighbouring cells, cells not split by a thick
+// separator share a region. Grids where that doesn't give a region per row
+// of as many cells (a classic grid read badly, or no thick separators at all)
+// get the standard boxes. It must be called after SplitCells.
+func (g *Grid) FindRegions() {
+	n := g.Shape.Size
+	g.Regions = StandardRegions(g.Shape)
+
+	// [row][col][0] is the separator right of the cell, [1] below it
+	thickness := make([][][2]int, n)
+	all := make([]int, 0, 2*n*(n-1))
+	for row := 0; row < n; row++ {
+		thickness[row] = make([][2]int, n)
+		for col := 0; col < n; col++ {
+			if col < n-1 {
+				thickness[row][col][0] = g.measureSeparator(g.Cells[row][col], g.Cells[row][col+1])
+				all = append(all, thickness[row][col][0])
+			}
+			if row < n-1 {
+				thickness[row][col][1] = g.measureSeparator(g.Cells[row][col], g.Cells[row+1][col])
+				all = append(all, thickness[row][col][1])
+			}
+		}
+	}
+
+	threshold, ok := splitThickness(all)
+	if !ok {
+		Logger.Debug("separators are all alike, using standard regions", "grid_id", g.Name)
+		return
+	}
+
+	regions := StandardRegions(g.Shape)
+	seen := newSeen(n)
+	id := 0
+	for row := 0; row < n; row++ {
+		for col := 0; col < n; col++ {
+			if seen[row][col] {
+				continue
+			}
+
+			id += 1
+			for _, cell := range floodFill(row, col, seen, func(fromRow, fromCol, toRow, toCol int) bool {
+				r, c, direction := min(fromRow, toRow), min(fromCol, toCol), 0
+				if fromRow != toRow {
+					direction = 1
+				}
+				return thickness[r][c][direction] < threshold
+			}) {
+				regions[cell[0]][cell[1]] = min(id, n)
+			}
+		}
+	}
+
+	if id != n || !regions.Valid() {
+		Logger.Debug("separators don't make a region per row, using standard regions", "grid_id", g.Name, "regions", id)
+		return
+	}
+
+	g.Regions = regions
+}
+
+// Board holds the values read from the grid, cells without one are 0
+func (g *Grid) Board() Board {
+	b := NewBoard(g.Shape.Size)
+	for row := range b {
+		for col := range b[row] {
+			if t, val, _ := g.Cells[row][col].Contents(); t == CellTypeValue {
+				b[row][col] = val
+			}
+		}
+	}
+
+	return b
+}
+
+// Valid reports whether no value read from the grid repeats in a row, column
+// or one of the grid's regions
+func (g *Grid) Valid() bool {
+	return g.Board().Valid(g.Regions)
+}
@@ -0,0 +1,125 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// jigsawRegions is the standard boxes with a corner cell of each outer box
+// handed on to the next box around the grid, renumbered in reading order
+var jigsawRegions = Regions{
+	{1, 1, 1, 2, 2, 2, 3, 3, 3},
+	{1, 1, 1, 2, 2, 2, 3, 3, 3},
+	{1, 1, 2, 2, 2, 3, 3, 3, 4},
+	{1, 5, 5, 6, 6, 6, 4, 4, 4},
+	{5, 5, 5, 6, 6, 6, 4, 4, 4},
+	{5, 5, 5, 6, 6, 6, 4, 4, 7},
+	{5, 8, 8, 9, 9, 9, 7, 7, 7},
+	{8, 8, 8, 9, 9, 9, 7, 7, 7},
+	{8, 8, 8, 8, 9, 9, 9, 7, 7},
+}
+
+// newRegionsTestImage draws a blank grid in the geometry SplitCells expects,
+// every separator inside it a thin light grey line with the region borders
+// drawn over in black, spilling into the cells either side like the thick
+// lines of most jigsaw apps
+func newRegionsTestImage(regions Regions) image.Image {
+	const cell, thick, thin, margin, spill = 80, 6, 3, 40, 3
+	gridWidth := 4*thick + 6*thin + 9*cell + 1
+	inner := image.Rect(margin+thick, margin+thick, margin+gridWidth-thick, margin+gridWidth-thick)
+
+	img := image.NewRGBA(image.Rect(0, 0, gridWidth+margin*2, gridWidth+margin*2))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(margin, margin, margin+gridWidth, margin+gridWidth), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	draw.Draw(img, inner, image.NewUniform(color.White), image.Point{}, draw.Src)
+
+	var origins [9]int
+	pos := margin + thick
+	for i := range origins {
+		origins[i] = pos
+		pos += cell + thin
+		if i == 2 || i == 5 {
+			pos += thick - thin
+		}
+	}
+
+	// the same thin line in the middle of every gap, the gaps either side
+	// of the standard boxes are wider
+	grey := image.NewUniform(color.Gray{0xaa})
+	for i := 0; i < 8; i++ {
+		start := origins[i] + cell + (origins[i+1]-origins[i]-cell-thin)/2
+		draw.Draw(img, image.Rect(start, inner.Min.Y, start+thin, inner.Max.Y), grey, image.Point{}, draw.Src)
+		draw.Draw(img, image.Rect(inner.Min.X, start, inner.Max.X, start+thin), grey, image.Point{}, draw.Src)
+	}
+
+	for r := 0; r < 9; r++ {
+		for c := 0; c < 9; c++ {
+			x, y := origins[c], origins[r]
+			if c < 8 && regions[r][c] != regions[r][c+1] {
+				draw.Draw(img, image.Rect(x+cell-spill, y, origins[c+1]+spill, y+cell), image.NewUniform(color.Black), image.Point{}, draw.Src)
+			}
+			if r < 8 && regions[r][c] != regions[r+1][c] {
+				draw.Draw(img, image.Rect(x, y+cell-spill, x+cell, origins[r+1]+spill), image.NewUniform(color.Black), image.Point{}, draw.Src)
+			}
+		}
+	}
+
+	return img
+}
+
+func TestGrid_FindRegions(t *testing.T) {
+	for name, regions := range map[string]Regions{
+		"classic": StandardRegions(ClassicShape),
+		"jigsaw":  jigsawRegions,
+	} {
+		t.Run(name, func(t *testing.T) {
+			g := GridFromImage(newRegionsTestImage(regions), name)
+			if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+				return
+			}
+
+			g.FindRegions()
+			assert.Equal(t, ClassicShape, g.Shape)
+			assert.Equal(t, regions, g.Regions)
+		})
+	}
+}
+
+func TestRegions_Valid(t *testing.T) {
+	assert.True(t, StandardRegions(ClassicShape).Valid())
+	assert.True(t, StandardRegions(Shape{Size: 6, BoxRows: 2, BoxCols: 3}).Valid())
+	assert.True(t, jigsawRegions.Valid())
+
+	// ten cells in one region, eight in another
+	uneven := StandardRegions(ClassicShape)
+	uneven[0][3] = 1
+	assert.False(t, uneven.Valid())
+
+	// two cells swapped across the grid, both regions are split in two
+	split := StandardRegions(ClassicShape)
+	split[0][0], split[8][8] = 9, 1
+	assert.False(t, split.Valid())
+}
+
+func TestBoard_Jigsaw(t *testing.T) {
+	b := NewBoard(9)
+	// R3C3 was handed to the top middle region
+	b[2][2] = 4
+	b[0][3] = 4
+	assert.True(t, b.Valid(nil))
+	assert.False(t, b.Valid(jigsawRegions))
+	assert.False(t, b.Solve(jigsawRegions))
+
+	b = NewBoard(9)
+	assert.True(t, b.Solve(jigsawRegions))
+	assert.True(t, b.Valid(jigsawRegions))
+	for row := 0; row < 9; row++ {
+		for col := 0; col < 9; col++ {
+			assert.Contains(t, b.Candidates(jigsawRegions, row, col), b[row][col])
+		}
+	}
+}
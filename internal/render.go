@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"strings"
+
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// the svg is drawn in a coordinate space of 100 units per cell (900x900 for
+// a classic grid), and scaled to whatever size is requested
+const renderCellSize = 100
+
+// confidence at or below this is drawn fully red, comparison mode won't
+// accept a value under 95% anyway
+const renderMinConfidence = 95.0
+
+func hexColour(c color.Color) string {
+	r, g, b, _ := c.RGBA()
+	return fmt.Sprintf("#%02x%02x%02x", r>>8, g>>8, b>>8)
+}
+
+// interpolates from red (low confidence) to green (certain)
+func confidenceColour(confidence float64) string {
+	t := (confidence - renderMinConfidence) / (100 - renderMinConfidence)
+	t = min(1, max(0, t))
+
+	return hexColour(color.RGBA{
+		R: uint8(211 + (46-211)*t),
+		G: uint8(47 + (125-47)*t),
+		B: uint8(47 + (50-47)*t),
+		A: 255,
+	})
+}
+
+// RenderSVG draws what the reader thought it saw: values coloured by their
+// confidence, placeholders in slots laid out like a box (3x3 in a classic
+// grid) and cell highlights.
+func (g *Grid) RenderSVG(width, height int) []byte {
+	var b strings.Builder
+
+	size := renderCellSize * g.Shape.Size
+	// placeholders are laid out a box row of slots at a time
+	slotsAcross := g.Shape.BoxCols
+	slotSize := (renderCellSize - 4) / slotsAcross
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(
+		&b,
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" preserveAspectRatio="none">`+"\n",
+		width, height, size, size,
+	)
+	fmt.Fprintf(&b, `<rect x="0" y="0" width="%d" height="%d" fill="#ffffff"/>`+"\n", size, size)
+
+	for rIdx, row := range g.Cells {
+		for cIdx, cell := range row {
+			x := cIdx * renderCellSize
+			y := rIdx * renderCellSize
+
+			confidence, known := cell.Confidence()
+			title := cell.Identifier
+			if known {
+				title = fmt.Sprintf("%s (%.1f%%)", cell.Identifier, confidence)
+			}
+
+			fmt.Fprintf(&b, `<g><title>%s</title>`, title)
+			fmt.Fprintf(
+				&b,
+				`<rect x="%d" y="%d" width="%d" height="%d" fill="%s"/>`,
+				x, y, renderCellSize, renderCellSize, hexColour(cell.Background()),
+			)
+
+			t, val, placeholders := cell.Contents()
+			switch t {
+			case CellTypeValue:
+				fill := "#000000"
+				if known {
+					fill = confidenceColour(confidence)
+				}
+				fmt.Fprintf(
+					&b,
+					`<text x="%d" y="%d" font-family="Helvetica, Arial, sans-serif" font-size="64" font-weight="bold" text-anchor="middle" fill="%s">%s</text>`,
+					x+renderCellSize/2, y+renderCellSize/2+22, fill, Symbol(val),
+				)
+			case CellTypePlaceholders:
+				for _, p := range placeholders {
+					slotRow := (p - 1) / slotsAcross
+					slotCol := (p - 1) % slotsAcross
+					fmt.Fprintf(
+						&b,
+						`<text x="%d" y="%d" font-family="Helvetica, Arial, sans-serif" font-size="%d" text-anchor="middle" fill="#555555">%s</text>`,
+						x+2+slotSize/2+slotCol*slotSize, y+10+slotSize/2+slotRow*slotSize, slotSize*22/32, Symbol(p),
+					)
+				}
+			}
+			b.WriteString("</g>\n")
+		}
+	}
+
+	// thin lines first so the box separators are drawn over the top of them
+	for i := 0; i <= g.Shape.Size; i++ {
+		vertical, horizontal := 1, 1
+		if i%g.Shape.BoxCols == 0 {
+			vertical = 4
+		}
+		if i%g.Shape.BoxRows == 0 {
+			horizontal = 4
+		}
+
+		pos := i * renderCellSize
+		fmt.Fprintf(&b, `<line x1="%d" y1="0" x2="%d" y2="%d" stroke="#000000" stroke-width="%d"/>`+"\n", pos, pos, size, vertical)
+		fmt.Fprintf(&b, `<line x1="0" y1="%d" x2="%d" y2="%d" stroke="#000000" stroke-width="%d"/>`+"\n", pos, size, pos, horizontal)
+	}
+
+	b.WriteString("</svg>\n")
+
+	return []byte(b.String())
+}
+
+func rasterizeSVG(svg []byte) ([]byte, error) {
+	wand := imagick.NewMagickWand()
+	defer wand.Destroy()
+
+	if err := wand.SetFormat("svg"); err != nil {
+		return nil, fmt.Errorf("setting svg format: %v", err)
+	}
+
+	if err := wand.ReadImageBlob(svg); err != nil {
+		return nil, fmt.Errorf("reading svg blob: %v", err)
+	}
+
+	if err := wand.SetImageFormat("png"); err != nil {
+		return nil, fmt.Errorf("setting png format: %v", err)
+	}
+
+	b, err := wand.GetImageBlob()
+	if err != nil {
+		return nil, fmt.Errorf("getting png bytes: %v", err)
+	}
+
+	return b, nil
+}
+
+func (g *Grid) RenderPNG(width, height int) ([]byte, error) {
+	return rasterizeSVG(g.RenderSVG(width, height))
+}
+
+// RenderComposite places the original crop of the grid next to the rendered
+// grid so misreads can be spotted at a glance
+func (g *Grid) RenderComposite() ([]byte, error) {
+	original := g.img.CropImage(g.boundaries)
+	originalBounds := original.Bounds()
+
+	b, err := g.RenderPNG(originalBounds.Dx(), originalBounds.Dy())
+	if err != nil {
+		return nil, fmt.Errorf("rendering grid: %v", err)
+	}
+
+	rendered, err := png.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("decoding rendered grid: %v", err)
+	}
+	renderedBounds := rendered.Bounds()
+
+	gap := 20
+	composite := image.NewRGBA(image.Rect(
+		0,
+		0,
+		originalBounds.Dx()+gap+renderedBounds.Dx(),
+		max(originalBounds.Dy(), renderedBounds.Dy()),
+	))
+	draw.Draw(composite, composite.Bounds(), image.White, image.Point{}, draw.Src)
+	draw.Draw(
+		composite,
+		image.Rect(0, 0, originalBounds.Dx(), originalBounds.Dy()),
+		original,
+		originalBounds.Min,
+		draw.Src,
+	)
+	draw.Draw(
+		composite,
+		image.Rect(originalBounds.Dx()+gap, 0, composite.Bounds().Dx(), renderedBounds.Dy()),
+		rendered,
+		renderedBounds.Min,
+		draw.Src,
+	)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, composite); err != nil {
+		return nil, fmt.Errorf("encoding composite: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,47 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfidenceColour(t *testing.T) {
+	assert.Equal(t, "#2e7d32", confidenceColour(100))
+	assert.Equal(t, "#d32f2f", confidenceColour(renderMinConfidence))
+	assert.Equal(t, "#d32f2f", confidenceColour(40))
+	assert.Equal(t, "#805630", confidenceColour(97.5))
+}
+
+func TestGrid_RenderSVG(t *testing.T) {
+	g := newTestGrid([][]string{
+		{"5", "p34", "C", ""},
+		{"", "", "", ""},
+		{"", "", "", ""},
+		{"", "", "", "1"},
+	}, ModeComparison)
+	g.Cells[0][0].comparisonDistortion = 2.5
+	g.Cells[3][3].comparisonDistortion = 0
+
+	svg := string(g.RenderSVG(200, 100))
+
+	assert.Contains(t, svg, `width="200" height="100" viewBox="0 0 400 400"`)
+
+	// values in the middle of their cell, coloured by how sure the reader was
+	assert.Contains(t, svg, `<title>R1C1 (97.5%)</title>`)
+	assert.Contains(t, svg, `x="50" y="72" font-family="Helvetica, Arial, sans-serif" font-size="64" font-weight="bold" text-anchor="middle" fill="#805630">5</text>`)
+	assert.Contains(t, svg, `x="350" y="372" font-family="Helvetica, Arial, sans-serif" font-size="64" font-weight="bold" text-anchor="middle" fill="#2e7d32">1</text>`)
+	// without a distortion there's no confidence to colour by
+	assert.Contains(t, svg, `<title>R1C3</title>`)
+	assert.Contains(t, svg, `fill="#000000">C</text>`)
+
+	// a 4x4 grid's boxes are 2x2, so are the placeholder slots
+	assert.Contains(t, svg, `x="126" y="82" font-family="Helvetica, Arial, sans-serif" font-size="33" text-anchor="middle" fill="#555555">3</text>`)
+	assert.Contains(t, svg, `x="174" y="82" font-family="Helvetica, Arial, sans-serif" font-size="33" text-anchor="middle" fill="#555555">4</text>`)
+
+	assert.Equal(t, 16, strings.Count(svg, "<g><title>"))
+	assert.Equal(t, 10, strings.Count(svg, "<line "))
+	// the border and the line between the boxes, both ways
+	assert.Equal(t, 6, strings.Count(svg, `stroke-width="4"`))
+}
@@ -0,0 +1,124 @@
+package internal
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Shape is the size of a grid and the boxes it's split into, a 6x6 grid has
+// six boxes of two rows by three columns
+type Shape struct {
+	Size    int `json:"size"`
+	BoxRows int `json:"box_rows"`
+	BoxCols int `json:"box_cols"`
+}
+
+// the grids we know of, a detected shape must be one of these or the same
+// with its boxes turned on their side
+var shapes = []Shape{
+	{Size: 4, BoxRows: 2, BoxCols: 2},
+	{Size: 6, BoxRows: 2, BoxCols: 3},
+	{Size: 9, BoxRows: 3, BoxCols: 3},
+	{Size: 12, BoxRows: 3, BoxCols: 4},
+	{Size: 16, BoxRows: 4, BoxCols: 4},
+}
+
+// maxSymbol is the largest value of the largest grid, written as G
+const maxSymbol = 16
+
+// ClassicShape is the 9x9 grid with 3x3 boxes
+var ClassicShape = Shape{Size: 9, BoxRows: 3, BoxCols: 3}
+
+// ShapeForSize is the usual shape of an n by n grid
+func ShapeForSize(n int) (Shape, error) {
+	for _, s := range shapes {
+		if s.Size == n {
+			return s, nil
+		}
+	}
+
+	return Shape{}, fmt.Errorf("unsupported grid size %d", n)
+}
+
+// Valid reports whether s is one of the shapes we know of, in either
+// orientation
+func (s Shape) Valid() bool {
+	for _, known := range shapes {
+		if known.Size != s.Size {
+			continue
+		}
+
+		if (known.BoxRows == s.BoxRows && known.BoxCols == s.BoxCols) || (known.BoxRows == s.BoxCols && known.BoxCols == s.BoxRows) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (s Shape) String() string {
+	return fmt.Sprintf("%dx%d (%dx%d boxes)", s.Size, s.Size, s.BoxRows, s.BoxCols)
+}
+
+// Symbol is how a value is written in text formats, digits up to 9 and
+// letters from A (10) to G (16) so every value is a single character
+func Symbol(val int) string {
+	if val >= 10 && val <= maxSymbol {
+		return string(rune('A' + val - 10))
+	}
+
+	return strconv.Itoa(val)
+}
+
+// ParseSymbol is the inverse of Symbol, it also accepts 10 to 16 written out
+func ParseSymbol(s string) (int, error) {
+	if len(s) == 1 && strings.ToUpper(s)[0] >= 'A' && strings.ToUpper(s)[0] <= 'G' {
+		return int(strings.ToUpper(s)[0]-'A') + 10, nil
+	}
+
+	val, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+
+	if val < 1 || val > maxSymbol {
+		return 0, fmt.Errorf("value %d out of range", val)
+	}
+
+	return val, nil
+}
+
+// boxLength is how many cells there are between the thick separators in a
+// row of lines, 0 when there are no thick separators or they aren't evenly
+// spaced
+func boxLength(widths []int) int {
+	threshold, ok := splitThickness(widths)
+	if !ok {
+		return 0
+	}
+
+	var length int
+	for idx, w := range widths {
+		if w < threshold {
+			continue
+		}
+
+		if length == 0 {
+			length = idx + 1
+		}
+
+		if (idx+1)%length != 0 {
+			return 0
+		}
+	}
+
+	// every multiple must be thick too
+	for idx := length - 1; idx < len(widths); idx += length {
+		if widths[idx] < threshold {
+			return 0
+		}
+	}
+
+	return length
+}
@@ -0,0 +1,142 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newShapeTestImage draws a blank grid of the given shape in the geometry
+// SplitCells expects, black box separators and grey lines between cells. The
+// grid is around 750px wide, or wider for 16x16.
+func newShapeTestImage(shape Shape) (image.Image, [][]image.Rectangle) {
+	return newSizedShapeTestImage(shape, max(40, 720/shape.Size))
+}
+
+// newSizedShapeTestImage is newShapeTestImage with cells of the given width
+func newSizedShapeTestImage(shape Shape, cell int) (image.Image, [][]image.Rectangle) {
+	const thick, thin, margin = 6, 3, 40
+
+	origins := func(boxLength int) ([]int, int) {
+		pos := margin + thick
+		o := make([]int, shape.Size)
+		for i := range o {
+			o[i] = pos
+			pos += cell
+			if (i+1)%boxLength == 0 {
+				pos += thick
+			} else {
+				pos += thin
+			}
+		}
+		return o, pos - margin + 1
+	}
+	xs, width := origins(shape.BoxCols)
+	ys, height := origins(shape.BoxRows)
+
+	img := image.NewRGBA(image.Rect(0, 0, width+margin*2, height+margin*2))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(margin, margin, margin+width, margin+height), image.NewUniform(color.Black), image.Point{}, draw.Src)
+
+	grey := image.NewUniform(color.Gray{0x99})
+	for i := 1; i < shape.Size; i++ {
+		if i%shape.BoxCols != 0 {
+			draw.Draw(img, image.Rect(xs[i]-thin, margin+thick, xs[i], margin+height-thick), grey, image.Point{}, draw.Src)
+		}
+		if i%shape.BoxRows != 0 {
+			draw.Draw(img, image.Rect(margin+thick, ys[i]-thin, margin+width-thick, ys[i]), grey, image.Point{}, draw.Src)
+		}
+	}
+
+	cells := make([][]image.Rectangle, shape.Size)
+	for r := range cells {
+		cells[r] = make([]image.Rectangle, shape.Size)
+		for c := range cells[r] {
+			cells[r][c] = image.Rect(xs[c], ys[r], xs[c]+cell, ys[r]+cell)
+			draw.Draw(img, cells[r][c], image.NewUniform(color.White), image.Point{}, draw.Src)
+		}
+	}
+
+	return img, cells
+}
+
+func TestGrid_SplitCells_Shapes(t *testing.T) {
+	for _, shape := range []Shape{
+		{Size: 4, BoxRows: 2, BoxCols: 2},
+		{Size: 6, BoxRows: 2, BoxCols: 3},
+		{Size: 6, BoxRows: 3, BoxCols: 2},
+		ClassicShape,
+		{Size: 12, BoxRows: 3, BoxCols: 4},
+		{Size: 16, BoxRows: 4, BoxCols: 4},
+	} {
+		t.Run(shape.String(), func(t *testing.T) {
+			img, cells := newShapeTestImage(shape)
+
+			g := GridFromImage(img, shape.String())
+			if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+				return
+			}
+
+			assert.Equal(t, shape, g.Shape)
+			assert.Equal(t, StandardRegions(shape), g.Regions)
+			if !assert.Len(t, g.Cells, shape.Size) {
+				return
+			}
+
+			for r, row := range g.Cells {
+				assert.Len(t, row, shape.Size)
+				for c, cell := range row {
+					assert.Equal(t, cells[r][c].Inset(2), cell.image.Image.Bounds(), cell.Identifier)
+					assert.Equal(t, shape.Size, cell.maxValue)
+				}
+			}
+		})
+	}
+}
+
+func TestGrid_SplitCells_Small(t *testing.T) {
+	// a mini grid in a screenshot, well under 500px wide
+	for _, shape := range []Shape{{Size: 4, BoxRows: 2, BoxCols: 2}, {Size: 6, BoxRows: 2, BoxCols: 3}} {
+		t.Run(shape.String(), func(t *testing.T) {
+			img, cells := newSizedShapeTestImage(shape, 30)
+
+			g := GridFromImage(img, shape.String())
+			if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+				return
+			}
+
+			assert.Equal(t, shape, g.Shape)
+			assert.Less(t, g.Bounds.Dx(), 250)
+			assert.Equal(t, cells[1][2].Inset(2), g.Cells[1][2].image.Image.Bounds())
+		})
+	}
+
+	t.Run("cells too small to read", func(t *testing.T) {
+		img, _ := newSizedShapeTestImage(ClassicShape, 8)
+		assert.Error(t, GridFromImage(img, "tiny").SplitCells(ModeComparison))
+	})
+}
+
+func TestSymbol(t *testing.T) {
+	for val := 1; val <= 16; val++ {
+		parsed, err := ParseSymbol(Symbol(val))
+		assert.NoError(t, err)
+		assert.Equal(t, val, parsed)
+	}
+
+	assert.Equal(t, "9", Symbol(9))
+	assert.Equal(t, "A", Symbol(10))
+	assert.Equal(t, "G", Symbol(16))
+
+	val, err := ParseSymbol("12")
+	assert.NoError(t, err)
+	assert.Equal(t, 12, val)
+
+	for _, s := range []string{"0", "17", "H", ""} {
+		_, err := ParseSymbol(s)
+		assert.Error(t, err, s)
+	}
+}
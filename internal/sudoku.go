@@ -0,0 +1,219 @@
+package internal
+
+import (
+	"math/rand"
+)
+
+// Board holds the digits of a puzzle, rows of as many cells as there are
+// rows, 0 is an empty cell
+type Board [][]int
+
+// NewBoard is an empty n by n board
+func NewBoard(n int) Board {
+	b := make(Board, n)
+	for row := range b {
+		b[row] = make([]int, n)
+	}
+
+	return b
+}
+
+// Clone copies the board so the copy can be filled in without changing b
+func (b Board) Clone() Board {
+	c := make(Board, len(b))
+	for row := range b {
+		c[row] = append([]int(nil), b[row]...)
+	}
+
+	return c
+}
+
+// houses holds the regions a board is checked against
+type houses struct {
+	regions Regions
+	members [][][2]int
+}
+
+// newHouses checks a board of size n against regions, nil regions are the
+// usual boxes for the size. Sizes without usual boxes are only checked by
+// row and column.
+func newHouses(n int, regions Regions) *houses {
+	if regions == nil {
+		if shape, err := ShapeForSize(n); err == nil {
+			regions = StandardRegions(shape)
+		} else {
+			regions = make(Regions, n)
+			for row := range regions {
+				regions[row] = make([]int, n)
+				for col := range regions[row] {
+					regions[row][col] = row + 1
+				}
+			}
+		}
+	}
+
+	return &houses{regions: regions, members: regions.members()}
+}
+
+// canPlace reports whether val can go in row, col without repeating in the
+// row, column or region
+func (b Board) canPlace(h *houses, row, col, val int) bool {
+	for i := range b {
+		if i != col && b[row][i] == val {
+			return false
+		}
+		if i != row && b[i][col] == val {
+			return false
+		}
+	}
+
+	for _, cell := range h.members[h.regions[row][col]] {
+		if (cell[0] != row || cell[1] != col) && b[cell[0]][cell[1]] == val {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Valid reports whether no digit repeats in any row, column or region, empty
+// cells are allowed. nil regions are the usual boxes for the board's size.
+func (b Board) Valid(regions Regions) bool {
+	return b.valid(newHouses(len(b), regions))
+}
+
+func (b Board) valid(h *houses) bool {
+	for row := range b {
+		for col := range b[row] {
+			if b[row][col] != 0 && !b.canPlace(h, row, col, b[row][col]) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// Candidates lists the digits that could go in an empty cell
+func (b Board) Candidates(regions Regions, row, col int) []int {
+	h := newHouses(len(b), regions)
+	candidates := make([]int, 0, len(b))
+	for val := 1; val <= len(b); val++ {
+		if b.canPlace(h, row, col, val) {
+			candidates = append(candidates, val)
+		}
+	}
+
+	return candidates
+}
+
+// solve fills the board by backtracking, trying digits in the order given by
+// order (which lets the generator randomise solutions). It stops once limit
+// solutions are found and returns how many it found, leaving the board
+// holding the last one.
+func (b Board) solve(h *houses, order func() []int, limit int) int {
+	for row := range b {
+		for col := range b[row] {
+			if b[row][col] != 0 {
+				continue
+			}
+
+			found := 0
+			for _, val := range order() {
+				if !b.canPlace(h, row, col, val) {
+					continue
+				}
+
+				b[row][col] = val
+				found += b.solve(h, order, limit-found)
+				if found >= limit {
+					return found
+				}
+			}
+			b[row][col] = 0
+
+			return found
+		}
+	}
+
+	return 1
+}
+
+// inOrder is the digits of a board of size n
+func inOrder(n int) func() []int {
+	return func() []int {
+		order := make([]int, n)
+		for idx := range order {
+			order[idx] = idx + 1
+		}
+		return order
+	}
+}
+
+// Solve fills in the board, returning false when it has no solution. nil
+// regions are the usual boxes for the board's size.
+func (b Board) Solve(regions Regions) bool {
+	h := newHouses(len(b), regions)
+	if !b.valid(h) {
+		return false
+	}
+
+	solved := b.Clone()
+	if solved.solve(h, inOrder(len(b)), 1) == 0 {
+		return false
+	}
+
+	for row := range b {
+		copy(b[row], solved[row])
+	}
+	return true
+}
+
+// Unique reports whether the board has exactly one solution. nil regions are
+// the usual boxes for the board's size.
+func (b Board) Unique(regions Regions) bool {
+	return b.unique(newHouses(len(b), regions))
+}
+
+func (b Board) unique(h *houses) bool {
+	if !b.valid(h) {
+		return false
+	}
+
+	return b.Clone().solve(h, inOrder(len(b)), 2) == 1
+}
+
+// RandomPuzzle generates a random classic puzzle with a unique solution,
+// removing digits from a random solved board until no more can be removed or
+// only givens are left
+func RandomPuzzle(rng *rand.Rand, givens int) (puzzle Board, solution Board) {
+	n := ClassicShape.Size
+	h := newHouses(n, nil)
+
+	solution = NewBoard(n)
+	solution.solve(h, func() []int {
+		order := inOrder(n)()
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		return order
+	}, 1)
+
+	puzzle = solution.Clone()
+	remaining := n * n
+	for _, idx := range rng.Perm(n * n) {
+		if remaining <= givens {
+			break
+		}
+
+		row, col := idx/n, idx%n
+		val := puzzle[row][col]
+		puzzle[row][col] = 0
+
+		if !puzzle.unique(h) {
+			puzzle[row][col] = val
+			continue
+		}
+		remaining -= 1
+	}
+
+	return puzzle, solution
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRandomPuzzle(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for range 5 {
+		puzzle, solution := RandomPuzzle(rng, 28)
+
+		assert.True(t, solution.Valid(nil))
+		assert.True(t, puzzle.Valid(nil))
+		assert.True(t, puzzle.Unique(nil))
+
+		for row := 0; row < 9; row++ {
+			for col := 0; col < 9; col++ {
+				assert.NotZero(t, solution[row][col])
+				if puzzle[row][col] != 0 {
+					assert.Equal(t, solution[row][col], puzzle[row][col])
+				}
+			}
+		}
+
+		solved := puzzle.Clone()
+		assert.True(t, solved.Solve(nil))
+		assert.Equal(t, solution, solved)
+	}
+}
+
+func TestBoard_Valid(t *testing.T) {
+	b := NewBoard(9)
+	assert.True(t, b.Valid(nil))
+
+	b[0][0] = 5
+	b[4][4] = 5
+	assert.True(t, b.Valid(nil))
+
+	b[1][1] = 5
+	assert.False(t, b.Valid(nil))
+	assert.False(t, b.Solve(nil))
+}
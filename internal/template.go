@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// Template is a single pre-processed representation of a digit. A digit can
+// have several templates, from different sources (apps, themes) and variants
+// within a source (given vs entered fonts, highlighted cells).
+type Template struct {
+	Digit   int
+	Source  string
+	Variant string
+
+	image *GridImage
+}
+
+// Name identifies the template in logs and debug bundles, i.e.
+// sudokucom/3-entered
+func (t *Template) Name() string {
+	name := strconv.Itoa(t.Digit)
+	if t.Variant != "" {
+		name += "-" + t.Variant
+	}
+
+	if t.Source != "" {
+		name = t.Source + "/" + name
+	}
+
+	return name
+}
+
+// TemplateMatch is the best template for an image
+type TemplateMatch struct {
+	Template             *Template
+	DistortionPercentage float64
+}
+
+// BestMatch scores img against every template and returns the one with the
+// lowest distortion, calling score with each comparison made. Returns nil
+// when there are no templates.
+func BestMatch(img *GridImage, templates []*Template, score func(t *Template, distortionPercentage float64)) *TemplateMatch {
+	var best *TemplateMatch
+
+	for _, t := range templates {
+		distortionPercentage := img.DistortionPercentage(t.image)
+		score(t, distortionPercentage)
+
+		if best == nil || distortionPercentage < best.DistortionPercentage {
+			best = &TemplateMatch{Template: t, DistortionPercentage: distortionPercentage}
+		}
+	}
+
+	return best
+}
+
+// <digit>.png or <digit>-<variant>.png, values over 9 are written out (12.png)
+// or as their letter (C.png), see Symbol
+var templateFileName = regexp.MustCompile(`^([1-9]|1[0-6]|[A-Ga-g])(?:-([A-Za-z0-9_-]+))?\.png$`)
+
+// loadTemplates reads every template in dir and its immediate subdirectories,
+// a subdirectory is the source of the templates within it:
+//
+//	t-values/3.png
+//	t-values/3-bold.png
+//	t-values/sudokucom/3.png
+//	t-values/C.png
+//
+// every digit from 1 to 9 must have at least one template, the values of
+// larger grids are optional (see missingTemplates).
+func loadTemplates(dir string, identifierPrefix string) ([]*Template, error) {
+	templates := make([]*Template, 0, 9)
+
+	var walk func(dir string, source string) error
+	walk = func(dir string, source string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return fmt.Errorf("reading template directory: %v", err)
+		}
+
+		for _, e := range entries {
+			if e.IsDir() {
+				if source == "" {
+					if err := walk(path.Join(dir, e.Name()), e.Name()); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+
+			match := templateFileName.FindStringSubmatch(e.Name())
+			if match == nil {
+				Logger.Debug("ignoring file in template directory", "dir", dir, "file", e.Name())
+				continue
+			}
+
+			img, err := LoadImage(path.Join(dir, e.Name()))
+			if err != nil {
+				return fmt.Errorf("loading template %s: %v", e.Name(), err)
+			}
+
+			digit, err := ParseSymbol(match[1])
+			if err != nil {
+				return fmt.Errorf("loading template %s: %v", e.Name(), err)
+			}
+			t := &Template{
+				Digit:   digit,
+				Source:  source,
+				Variant: match[2],
+			}
+			t.image = NewGridImage(img, fmt.Sprintf("%s-%s", identifierPrefix, t.Name()))
+
+			templates = append(templates, t)
+		}
+
+		return nil
+	}
+
+	if err := walk(dir, ""); err != nil {
+		return nil, err
+	}
+
+	if missing := missingTemplates(templates, 9); len(missing) > 0 {
+		return nil, fmt.Errorf("no template for digit %d in %s", missing[0], dir)
+	}
+
+	// deterministic order so ties resolve the same way every time
+	sort.SliceStable(templates, func(i, j int) bool {
+		return templates[i].Name() < templates[j].Name()
+	})
+
+	return templates, nil
+}
+
+// missingTemplates are the values from 1 to size without a template
+func missingTemplates(templates []*Template, size int) []int {
+	var found [maxSymbol + 1]bool
+	for _, t := range templates {
+		found[t.Digit] = true
+	}
+
+	var missing []int
+	for digit := 1; digit <= size; digit++ {
+		if !found[digit] {
+			missing = append(missing, digit)
+		}
+	}
+
+	return missing
+}
+
+func mustLoadTemplates(name string, identifierPrefix string) []*Template {
+	templates, err := loadTemplates(path.Join(templatesDir(), name), identifierPrefix)
+	if err != nil {
+		log.Fatal(fmt.Errorf("loading %s: %w", name, err))
+	}
+
+	return templates
+}
@@ -0,0 +1,158 @@
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// writeTestTemplates writes a small glyph under each of names in dir
+func writeTestTemplates(t *testing.T, dir string, names ...string) {
+	t.Helper()
+
+	for _, name := range names {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, filledRGBA(image.Rect(0, 0, 6, 8), color.Black)); err != nil {
+			t.Fatal(err)
+		}
+
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+var digitTemplateNames = []string{"1.png", "2.png", "3.png", "4.png", "5.png", "6.png", "7.png", "8.png", "9.png"}
+
+func TestLoadTemplates_LargerGrids(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplates(t, dir, digitTemplateNames...)
+	writeTestTemplates(t, dir, "10.png", "B.png", "c-bold.png", "16.png", "17.png")
+
+	templates, err := loadTemplates(dir, "digit")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var names []string
+	for _, tmpl := range templates {
+		if tmpl.Digit > 9 {
+			names = append(names, tmpl.Name())
+		}
+	}
+	// 17 is past the largest grid and ignored
+	assert.Equal(t, []string{"10", "11", "12-bold", "16"}, names)
+
+	assert.Empty(t, missingTemplates(templates, 9))
+	assert.Equal(t, []int{13, 14, 15}, missingTemplates(templates, 16))
+}
+
+func TestLoadTemplates_Names(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplates(t, dir, digitTemplateNames...)
+	writeTestTemplates(t, dir, "3-bold.png", "3-given_2.png", "sudokucom/3-entered.png", "sudokucom/nested/4.png")
+	// none of these are templates
+	writeTestTemplates(t, dir, "3-.png", "3_bold.png", "3-bold.jpg", "0.png", "bold-3.png")
+
+	templates, err := loadTemplates(dir, "digit")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var threes []*Template
+	for _, tmpl := range templates {
+		if tmpl.Digit == 3 {
+			threes = append(threes, tmpl)
+		}
+	}
+	if !assert.Len(t, threes, 4) {
+		return
+	}
+
+	// sorted by name
+	assert.Equal(t, []string{"3", "3-bold", "3-given_2", "sudokucom/3-entered"}, []string{threes[0].Name(), threes[1].Name(), threes[2].Name(), threes[3].Name()})
+	assert.Equal(t, "", threes[0].Variant)
+	assert.Equal(t, "bold", threes[1].Variant)
+	assert.Equal(t, "given_2", threes[2].Variant)
+	assert.Equal(t, "sudokucom", threes[3].Source)
+	assert.Equal(t, "entered", threes[3].Variant)
+
+	// only the immediate subdirectories are sources
+	assert.Len(t, templates, 12)
+}
+
+// squareImage is a white image with a black square in the middle of it,
+// moved dx pixels to the right
+func squareImage(dx int) image.Image {
+	img := filledRGBA(image.Rect(0, 0, 40, 40), color.White)
+	draw.Draw(img, image.Rect(10+dx, 10, 30+dx, 30), image.NewUniform(color.Black), image.Point{}, draw.Src)
+	return img
+}
+
+func TestBestMatch(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	img := NewGridImage(squareImage(0), "cell")
+	templates := []*Template{
+		// close enough to be taken on its own, but not the best
+		{Digit: 3, image: NewGridImage(squareImage(1), "3")},
+		{Digit: 3, Variant: "bold", image: NewGridImage(squareImage(0), "3-bold")},
+		{Digit: 8, image: NewGridImage(squareImage(2), "8")},
+	}
+
+	scores := map[string]float64{}
+	best := BestMatch(img, templates, func(t *Template, distortionPercentage float64) {
+		scores[t.Name()] = distortionPercentage
+	})
+	if !assert.NotNil(t, best) {
+		return
+	}
+
+	assert.Equal(t, "3-bold", best.Template.Name())
+	assert.Zero(t, best.DistortionPercentage)
+
+	// every template is scored, the first is under the comparison threshold
+	// (see Cell.ProcessValues)
+	if assert.Len(t, scores, 3) {
+		assert.Greater(t, scores["3"], 0.0)
+		assert.Less(t, scores["3"], 5.0)
+		assert.Greater(t, scores["8"], scores["3"])
+	}
+
+	assert.Nil(t, BestMatch(img, nil, func(*Template, float64) {}))
+}
+
+func TestGrid_checkTemplates(t *testing.T) {
+	dir := t.TempDir()
+	writeTestTemplates(t, dir, digitTemplateNames...)
+
+	templates, err := loadTemplates(dir, "digit")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	shape, _ := ShapeForSize(12)
+	g := &Grid{Shape: shape, digitComparisons: templates, placeholderComparisons: templates}
+
+	err = g.checkTemplates(ModeComparison)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "A, B, C")
+	}
+	assert.NoError(t, g.checkTemplates(ModeClassifier))
+
+	g.Shape = ClassicShape
+	assert.NoError(t, g.checkTemplates(ModeComparison))
+}
@@ -0,0 +1,186 @@
+package internal
+
+import (
+	"image"
+	"math"
+	"slices"
+)
+
+const (
+	// how far the local threshold drops below the mean of a window without
+	// any contrast, Sauvola's k
+	sauvolaK = 0.2
+	// the standard deviation of a window with as much contrast as a grey
+	// image can have, Sauvola's R
+	sauvolaR = 128.0
+	// the window around each pixel is at least this many pixels either side
+	// of it, bigger images get one in proportion (see sauvolaRadius)
+	minSauvolaRadius = 7
+	// a pixel this far under the global threshold is ink even where the
+	// window around it is solid, inside a thick border or a black dot the
+	// local threshold has nothing to go by
+	solidInkShare = 0.5
+)
+
+// InkMask marks the pixels of an image that are ink, the grid lines, digits
+// and marks, apart from the background and any highlights. It works the
+// same whatever colour the lines are, on light or dark themes and on
+// scanned paper, see Binarise.
+type InkMask struct {
+	bounds image.Rectangle
+	ink    []bool
+}
+
+// Ink reports whether the pixel at x, y is ink, false outside the image
+func (m *InkMask) Ink(x, y int) bool {
+	if !(image.Point{x, y}).In(m.bounds) {
+		return false
+	}
+
+	return m.ink[(y-m.bounds.Min.Y)*m.bounds.Dx()+(x-m.bounds.Min.X)]
+}
+
+// Bounds are the bounds of the image the mask was made from
+func (m *InkMask) Bounds() image.Rectangle {
+	return m.bounds
+}
+
+// luminance is how light each pixel of img is from 0 to 255, row by row.
+// Transparent pixels are taken as over white.
+func luminance(img image.Image) []uint8 {
+	bounds := img.Bounds()
+	lum := make([]uint8, 0, bounds.Dx()*bounds.Dy())
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// the colours are premultiplied, what's missing of alpha is white
+			white := 0xffff - a
+			l := (19595*(r+white) + 38470*(g+white) + 7471*(b+white) + 1<<15) >> 24
+			lum = append(lum, uint8(l))
+		}
+	}
+
+	return lum
+}
+
+// otsu is the level splitting the histogram into the two classes with the
+// most variance between them, the background and the ink. Levels below it
+// are the dark class. 0 when every pixel is the same level.
+func otsu(histogram [256]int) int {
+	var total, sum float64
+	for level, count := range histogram {
+		total += float64(count)
+		sum += float64(level * count)
+	}
+
+	var threshold int
+	var darkCount, darkSum, best float64
+	for level := 1; level < 256; level++ {
+		darkCount += float64(histogram[level-1])
+		darkSum += float64((level - 1) * histogram[level-1])
+
+		lightCount := total - darkCount
+		if darkCount == 0 || lightCount == 0 {
+			continue
+		}
+
+		diff := darkSum/darkCount - (sum-darkSum)/lightCount
+		if variance := darkCount * lightCount * diff * diff; variance > best {
+			threshold, best = level, variance
+		}
+	}
+
+	return threshold
+}
+
+// sauvolaRadius scales the window with the image, about a third of a cell of
+// a grid filling it
+func sauvolaRadius(bounds image.Rectangle) int {
+	return max(minSauvolaRadius, min(bounds.Dx(), bounds.Dy())/60)
+}
+
+// Binarise finds the ink in img. The global (Otsu) threshold tells which way
+// round the image is, ink is the minority, so dark themes are inverted first.
+// Each pixel is then held against a local (Sauvola) threshold from the mean
+// and contrast of the window around it, a grey line or a faint pencil mark is
+// ink next to white paper where a highlighted cell isn't.
+func Binarise(img image.Image) *InkMask {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	mask := &InkMask{bounds: bounds, ink: make([]bool, w*h)}
+	if w == 0 || h == 0 {
+		return mask
+	}
+
+	lum := luminance(img)
+
+	var histogram [256]int
+	for _, l := range lum {
+		histogram[l] += 1
+	}
+
+	threshold := otsu(histogram)
+	var dark int
+	for _, count := range histogram[:threshold] {
+		dark += count
+	}
+	if dark > len(lum)/2 {
+		// light ink on a dark background
+		for idx := range lum {
+			lum[idx] = 255 - lum[idx]
+		}
+		slices.Reverse(histogram[:])
+		threshold = otsu(histogram)
+	}
+	solid := float64(threshold) * solidInkShare
+
+	// the sums of the window around each pixel are kept by column for the
+	// rows it spans, then slid along the row
+	radius := sauvolaRadius(bounds)
+	colSum, colSquares := make([]float64, w), make([]float64, w)
+	addRow := func(y int, sign float64) {
+		if y < 0 || y >= h {
+			return
+		}
+		for x, l := range lum[y*w : (y+1)*w] {
+			colSum[x] += sign * float64(l)
+			colSquares[x] += sign * float64(l) * float64(l)
+		}
+	}
+	for y := 0; y < radius; y++ {
+		addRow(y, 1)
+	}
+
+	for y := 0; y < h; y++ {
+		addRow(y+radius, 1)
+		addRow(y-radius-1, -1)
+		rows := float64(min(h-1, y+radius) - max(0, y-radius) + 1)
+
+		var sum, squares float64
+		for x := 0; x < radius && x < w; x++ {
+			sum += colSum[x]
+			squares += colSquares[x]
+		}
+
+		for x := 0; x < w; x++ {
+			if right := x + radius; right < w {
+				sum += colSum[right]
+				squares += colSquares[right]
+			}
+			if left := x - radius - 1; left >= 0 {
+				sum -= colSum[left]
+				squares -= colSquares[left]
+			}
+
+			n := rows * float64(min(w-1, x+radius)-max(0, x-radius)+1)
+			mean := sum / n
+			deviation := math.Sqrt(max(0, squares/n-mean*mean))
+			local := mean * (1 + sauvolaK*(deviation/sauvolaR-1))
+
+			l := float64(lum[y*w+x])
+			mask.ink[y*w+x] = l < local || l < solid
+		}
+	}
+
+	return mask
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recolour swaps the colours of img for those in theme, any others are kept
+func recolour(img image.Image, theme map[color.RGBA]color.RGBA) *image.RGBA {
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Src)
+	for y := dst.Bounds().Min.Y; y < dst.Bounds().Max.Y; y++ {
+		for x := dst.Bounds().Min.X; x < dst.Bounds().Max.X; x++ {
+			if c, ok := theme[dst.RGBAAt(x, y)]; ok {
+				dst.SetRGBA(x, y, c)
+			}
+		}
+	}
+
+	return dst
+}
+
+func TestBinarise(t *testing.T) {
+	var (
+		white = color.RGBA{0xff, 0xff, 0xff, 0xff}
+		black = color.RGBA{0x00, 0x00, 0x00, 0xff}
+		grey  = color.RGBA{0x99, 0x99, 0x99, 0xff}
+	)
+
+	for _, tc := range []struct {
+		name  string
+		theme map[color.RGBA]color.RGBA
+		// cells painted in a highlight colour, as the app shows a selection
+		highlight color.RGBA
+	}{
+		{name: "black and grey lines"},
+		{name: "blue lines", theme: map[color.RGBA]color.RGBA{
+			black: {0x1f, 0x3a, 0x93, 0xff},
+			grey:  {0x8a, 0xb4, 0xf8, 0xff},
+		}},
+		{name: "dark theme", theme: map[color.RGBA]color.RGBA{
+			white: {0x1e, 0x1e, 0x1e, 0xff},
+			black: {0xe0, 0xe0, 0xe0, 0xff},
+			grey:  {0x70, 0x70, 0x70, 0xff},
+		}},
+		{name: "scanned paper", theme: map[color.RGBA]color.RGBA{
+			white: {0xe8, 0xe2, 0xd0, 0xff},
+			black: {0x3a, 0x36, 0x30, 0xff},
+			grey:  {0x9a, 0x94, 0x86, 0xff},
+		}},
+		{name: "highlighted cells", highlight: color.RGBA{0xbb, 0xde, 0xfb, 0xff}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			img, cells := newShapeTestImage(ClassicShape)
+			themed := recolour(img, tc.theme)
+
+			highlighted := []image.Rectangle{cells[0][0], cells[0][1], cells[1][0], cells[4][4]}
+			if tc.highlight.A != 0 {
+				for _, r := range highlighted {
+					draw.Draw(themed, r, image.NewUniform(tc.highlight), image.Point{}, draw.Src)
+				}
+			}
+
+			mask := Binarise(themed)
+			for _, r := range highlighted {
+				for y := r.Min.Y; y < r.Max.Y; y++ {
+					for x := r.Min.X; x < r.Max.X; x++ {
+						if !assert.False(t, mask.Ink(x, y), "ink in a cell at %d, %d", x, y) {
+							return
+						}
+					}
+				}
+			}
+
+			// the middle of each line between the first cells
+			assert.True(t, mask.Ink(cells[0][0].Min.X-3, cells[0][0].Min.Y+10), "outer border")
+			assert.True(t, mask.Ink(cells[0][1].Min.X-2, cells[0][1].Min.Y+10), "line between cells")
+			assert.True(t, mask.Ink(cells[0][3].Min.X-3, cells[0][3].Min.Y+10), "box line")
+
+			g := GridFromImage(themed, tc.name)
+			if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+				return
+			}
+
+			assert.Equal(t, ClassicShape, g.Shape)
+			for r, row := range g.Cells {
+				for c, cell := range row {
+					assert.Equal(t, cells[r][c].Inset(2), cell.image.Image.Bounds(), cell.Identifier)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+)
+
+const (
+	// samples across and down the grid in a frame hash, a cell is around 10
+	// of them so a pencil mark covers a few
+	frameHashSize = 96
+	// how far apart (out of 255) two samples have to be for the frames to
+	// differ there. Each sample is the mean of a box of pixels, which evens out
+	// compression noise.
+	frameHashTolerance = 12
+)
+
+// frameHash is a perceptual hash of where the grid is in a frame, the area
+// shrunk to frameHashSize by frameHashSize grey samples. Frames that only
+// differ outside the grid, like the clock of a puzzle app, hash the same.
+// A difference hash (of whether each sample is lighter than the next) is too
+// coarse here, a pencil mark only flips the odd bit while compression noise
+// flips those of samples close to each other.
+type frameHash []uint8
+
+func newFrameHash(img *image.RGBA, rect image.Rectangle) frameHash {
+	rect = rect.Add(img.Bounds().Min).Intersect(img.Bounds())
+	if rect.Empty() {
+		return nil
+	}
+	lum := luminance(img.SubImage(rect))
+
+	var sums, counts [frameHashSize * frameHashSize]int
+	w, h := rect.Dx(), rect.Dy()
+	for y := 0; y < h; y++ {
+		row := y * frameHashSize / h
+		for x := 0; x < w; x++ {
+			sample := row*frameHashSize + x*frameHashSize/w
+			sums[sample] += int(lum[y*w+x])
+			counts[sample]++
+		}
+	}
+
+	hash := make(frameHash, len(sums))
+	for idx, sum := range sums {
+		// a grid smaller than the hash leaves samples without pixels
+		if counts[idx] > 0 {
+			hash[idx] = uint8(sum / counts[idx])
+		}
+	}
+
+	return hash
+}
+
+// distance is the number of samples two hashes differ at, hashes of
+// different lengths differ everywhere
+func (h frameHash) distance(other frameHash) int {
+	if len(h) != len(other) {
+		return max(len(h), len(other))
+	}
+
+	var d int
+	for idx := range h {
+		if max(h[idx], other[idx])-min(h[idx], other[idx]) > frameHashTolerance {
+			d++
+		}
+	}
+
+	return d
+}
+
+// TimelineMove is a move and the frame it was first seen in
+type TimelineMove struct {
+	// from 1
+	Frame int `json:"frame"`
+	// seconds from the start of the recording
+	Time float64 `json:"time"`
+	Move
+}
+
+// Timeline is what was played in a recording of a grid being solved
+type Timeline struct {
+	Frames int
+	// frames the grid was read in, the others looked the same as one before
+	// them (see frameHash) or had no grid that could be read
+	Read int
+	// frames no grid could be read in, i.e. a menu covered it
+	Unreadable int
+	Moves      []TimelineMove
+	// the grid as it was last read
+	Grid *Grid
+}
+
+func (t *Timeline) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Frames     int            `json:"frames"`
+		Read       int            `json:"read"`
+		Unreadable int            `json:"unreadable"`
+		Moves      []TimelineMove `json:"moves"`
+		Grid       gridJSON       `json:"grid"`
+	}{t.Frames, t.Read, t.Unreadable, t.Moves, t.Grid.toJSON()})
+}
+
+// TimelineReader reads the grid in each frame of a recording as it's
+// decoded, and the moves made between them, without keeping the frames. A
+// frame is only read when it looks different from the one read before it
+// where the grid was. Frames no grid is read in, or a grid of another size,
+// are skipped. The grid's place is only known in frames that didn't need
+// turning or straightening, frames are always read when it did.
+type TimelineReader struct {
+	name   string
+	worker *GridWorker
+	opts   ReadOptions
+
+	timeline *Timeline
+	last     *Grid
+	lastHash frameHash
+}
+
+func NewTimelineReader(name string, worker *GridWorker, opts ReadOptions) *TimelineReader {
+	return &TimelineReader{name: name, worker: worker, opts: opts, timeline: &Timeline{Moves: []TimelineMove{}}}
+}
+
+// Add reads the next frame of the recording, its image isn't kept
+func (r *TimelineReader) Add(frame Frame) {
+	r.timeline.Frames++
+	idx := r.timeline.Frames
+	img := NormaliseImage(frame.Image)
+
+	var hash frameHash
+	if r.last != nil && r.last.DeskewAngle == 0 && r.last.Orientation == 0 {
+		hash = newFrameHash(img, r.last.Bounds)
+		if r.lastHash != nil && hash.distance(r.lastHash) == 0 {
+			return
+		}
+	}
+
+	grid, err := ReadGrid(img, fmt.Sprintf("%s-%d", r.name, idx), r.worker, r.opts)
+	if err == nil && r.last != nil {
+		var moves []Move
+		moves, err = DiffGrids(r.last, grid)
+		for _, move := range moves {
+			r.timeline.Moves = append(r.timeline.Moves, TimelineMove{Frame: idx, Time: frame.Time.Seconds(), Move: move})
+		}
+	}
+	if err != nil {
+		Logger.Debug("skipping frame", "grid_id", r.name, "frame", idx, "error", err)
+		r.timeline.Unreadable++
+		// the frames after it that look the same are skipped too
+		r.lastHash = hash
+		return
+	}
+
+	r.timeline.Read++
+	r.last, r.lastHash = grid, nil
+	if grid.DeskewAngle == 0 && grid.Orientation == 0 {
+		r.lastHash = newFrameHash(img, grid.Bounds)
+	}
+}
+
+// Timeline is what was played in the frames added so far
+func (r *TimelineReader) Timeline() (*Timeline, error) {
+	if r.last == nil {
+		return nil, errors.New("no grid found in any frame")
+	}
+	r.timeline.Grid = r.last
+
+	return r.timeline, nil
+}
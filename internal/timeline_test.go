@@ -0,0 +1,332 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func filledRGBA(rect image.Rectangle, c color.Color) *image.RGBA {
+	img := image.NewRGBA(rect)
+	draw.Draw(img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+	return img
+}
+
+// apngTestFrame is a partial frame of an APNG written by encodeAPNG
+type apngTestFrame struct {
+	img     *image.RGBA
+	delay   uint16 // hundredths of a second
+	dispose frameDisposal
+	over    bool
+}
+
+// encodeAPNG writes frames as an APNG, the first is the default image. The
+// frames have to be opaque so each is encoded with the same colour type.
+func encodeAPNG(frames []apngTestFrame) ([]byte, error) {
+	out := append([]byte{}, pngSignature...)
+	seq := uint32(0)
+	for idx, f := range frames {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, f.img); err != nil {
+			return nil, err
+		}
+		chunks, err := pngChunks(buf.Bytes())
+		if err != nil {
+			return nil, err
+		}
+
+		if idx == 0 {
+			out = appendPNGChunk(out, "IHDR", chunks[0].data)
+			actl := binary.BigEndian.AppendUint32(nil, uint32(len(frames)))
+			out = appendPNGChunk(out, "acTL", binary.BigEndian.AppendUint32(actl, 0))
+		}
+
+		bounds := f.img.Bounds()
+		fctl := binary.BigEndian.AppendUint32(nil, seq)
+		for _, v := range []int{bounds.Dx(), bounds.Dy(), bounds.Min.X, bounds.Min.Y} {
+			fctl = binary.BigEndian.AppendUint32(fctl, uint32(v))
+		}
+		fctl = append(fctl, byte(f.delay>>8), byte(f.delay), 0, 100, byte(f.dispose), 0)
+		if f.over {
+			fctl[25] = 1
+		}
+		out = appendPNGChunk(out, "fcTL", fctl)
+		seq++
+
+		for _, chunk := range chunks {
+			if chunk.typ != "IDAT" {
+				continue
+			}
+			if idx == 0 {
+				out = appendPNGChunk(out, "IDAT", chunk.data)
+				continue
+			}
+			out = appendPNGChunk(out, "fdAT", append(binary.BigEndian.AppendUint32(nil, seq), chunk.data...))
+			seq++
+		}
+	}
+
+	return appendPNGChunk(out, "IEND", nil), nil
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	return &image.RGBA{Pix: slices.Clone(img.Pix), Stride: img.Stride, Rect: img.Rect}
+}
+
+// collectFrames keeps a copy of each frame it's called with, the frames of an
+// animation are drawn on the same image
+func collectFrames(frames *[]Frame) func(Frame) {
+	return func(f Frame) {
+		if img, ok := f.Image.(*image.RGBA); ok {
+			f.Image = cloneRGBA(img)
+		}
+		*frames = append(*frames, f)
+	}
+}
+
+func TestDecodeFrames(t *testing.T) {
+	white, black := color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 0, 255}
+	red, blue := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 0, 255, 255}
+	transparent := color.RGBA{}
+
+	t.Run("gif", func(t *testing.T) {
+		paletted := func(rect image.Rectangle, c color.Color) *image.Paletted {
+			img := image.NewPaletted(rect, append(palette.WebSafe[:len(palette.WebSafe):len(palette.WebSafe)], color.Transparent))
+			draw.Draw(img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+			return img
+		}
+
+		partial := paletted(image.Rect(4, 0, 8, 4), red)
+		// a transparent pixel shows the frame underneath
+		partial.Set(4, 0, color.Transparent)
+
+		var buf bytes.Buffer
+		err := gif.EncodeAll(&buf, &gif.GIF{
+			Image:    []*image.Paletted{paletted(image.Rect(0, 0, 8, 8), white), partial, paletted(image.Rect(0, 4, 4, 8), black)},
+			Delay:    []int{50, 0, 25},
+			Disposal: []byte{gif.DisposalNone, gif.DisposalBackground, gif.DisposalNone},
+			Config:   image.Config{Width: 8, Height: 8},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		var frames []Frame
+		if !assert.NoError(t, DecodeFrames(buf.Bytes(), collectFrames(&frames))) || !assert.Len(t, frames, 3) {
+			return
+		}
+
+		assert.Equal(t, []time.Duration{0, 500 * time.Millisecond, 600 * time.Millisecond}, []time.Duration{frames[0].Time, frames[1].Time, frames[2].Time})
+
+		second := frames[1].Image.(*image.RGBA)
+		assert.Equal(t, white, second.RGBAAt(4, 0))
+		assert.Equal(t, red, second.RGBAAt(5, 0))
+		assert.Equal(t, white, second.RGBAAt(0, 0))
+
+		// the red frame was cleared once shown
+		third := frames[2].Image.(*image.RGBA)
+		assert.Equal(t, transparent, third.RGBAAt(5, 0))
+		assert.Equal(t, black, third.RGBAAt(0, 5))
+		assert.Equal(t, white, third.RGBAAt(6, 6))
+	})
+
+	t.Run("apng", func(t *testing.T) {
+		b, err := encodeAPNG([]apngTestFrame{
+			{img: filledRGBA(image.Rect(0, 0, 8, 8), white), delay: 100},
+			{img: filledRGBA(image.Rect(4, 0, 8, 4), red), delay: 50, dispose: disposePrevious},
+			{img: filledRGBA(image.Rect(0, 4, 4, 8), blue), delay: 50, over: true},
+		})
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.True(t, isAPNG(b))
+
+		var frames []Frame
+		if !assert.NoError(t, DecodeFrames(b, collectFrames(&frames))) || !assert.Len(t, frames, 3) {
+			return
+		}
+
+		assert.Equal(t, []time.Duration{0, time.Second, 1500 * time.Millisecond}, []time.Duration{frames[0].Time, frames[1].Time, frames[2].Time})
+		assert.Equal(t, red, frames[1].Image.(*image.RGBA).RGBAAt(5, 0))
+
+		// the red frame was put back to white once shown
+		third := frames[2].Image.(*image.RGBA)
+		assert.Equal(t, white, third.RGBAAt(5, 0))
+		assert.Equal(t, blue, third.RGBAAt(0, 5))
+	})
+
+	t.Run("still image", func(t *testing.T) {
+		b, err := os.ReadFile("../formats/grid.png")
+		if !assert.NoError(t, err) {
+			return
+		}
+		assert.False(t, isAPNG(b))
+
+		var frames []Frame
+		if assert.NoError(t, DecodeFrames(b, collectFrames(&frames))) && assert.Len(t, frames, 1) {
+			assert.Equal(t, image.Rect(0, 0, 630, 630), frames[0].Image.Bounds())
+		}
+	})
+}
+
+func TestDecodeFrames_Limits(t *testing.T) {
+	pixel := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.White, color.Black})
+
+	t.Run("gif canvas", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, gif.EncodeAll(&buf, &gif.GIF{Image: []*image.Paletted{pixel}, Delay: []int{0}})) {
+			return
+		}
+		// the logical screen is the first thing after the signature
+		b := buf.Bytes()
+		binary.LittleEndian.PutUint16(b[6:], 65535)
+		binary.LittleEndian.PutUint16(b[8:], 65535)
+
+		err := DecodeFrames(b, func(Frame) { t.Error("decoded a frame") })
+		assert.ErrorContains(t, err, "65535x65535 canvas")
+	})
+
+	t.Run("gif frames", func(t *testing.T) {
+		g := &gif.GIF{Config: image.Config{Width: 1, Height: 1, ColorModel: pixel.Palette}}
+		for range maxFrames + 5 {
+			g.Image = append(g.Image, pixel)
+			g.Delay = append(g.Delay, 0)
+		}
+		var buf bytes.Buffer
+		if !assert.NoError(t, gif.EncodeAll(&buf, g)) {
+			return
+		}
+
+		frames := 0
+		if assert.NoError(t, DecodeFrames(buf.Bytes(), func(Frame) { frames++ })) {
+			assert.Equal(t, maxFrames, frames)
+		}
+	})
+
+	t.Run("apng canvas", func(t *testing.T) {
+		b, err := encodeAPNG([]apngTestFrame{{img: filledRGBA(image.Rect(0, 0, 2, 2), color.White)}})
+		if !assert.NoError(t, err) {
+			return
+		}
+		chunks, err := pngChunks(b)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		// the canvas is IHDR, the frame has to be inside it
+		out := append([]byte{}, pngSignature...)
+		for _, chunk := range chunks {
+			data := chunk.data
+			if chunk.typ == "IHDR" {
+				data = slices.Clone(data)
+				binary.BigEndian.PutUint32(data, 1)
+			}
+			out = appendPNGChunk(out, chunk.typ, data)
+		}
+		assert.ErrorContains(t, DecodeFrames(out, func(Frame) {}), "outside the")
+
+		for idx, chunk := range chunks {
+			if chunk.typ == "IHDR" {
+				chunks[idx].data = slices.Clone(chunk.data)
+				binary.BigEndian.PutUint32(chunks[idx].data, 100000)
+				binary.BigEndian.PutUint32(chunks[idx].data[4:], 100000)
+			}
+		}
+		out = append([]byte{}, pngSignature...)
+		for _, chunk := range chunks {
+			out = appendPNGChunk(out, chunk.typ, chunk.data)
+		}
+		assert.ErrorContains(t, DecodeFrames(out, func(Frame) {}), "100000x100000 canvas")
+	})
+}
+
+func TestLoadFrames(t *testing.T) {
+	dir := t.TempDir()
+	for idx, name := range []string{"frame-10.png", "frame-2.png", "frame-1.png"} {
+		var buf bytes.Buffer
+		if !assert.NoError(t, png.Encode(&buf, filledRGBA(image.Rect(0, 0, idx+1, 1), color.White))) {
+			return
+		}
+		if !assert.NoError(t, os.WriteFile(filepath.Join(dir, name), buf.Bytes(), 0o644)) {
+			return
+		}
+	}
+	if !assert.NoError(t, os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a frame"), 0o644)) {
+		return
+	}
+
+	var frames []Frame
+	if !assert.NoError(t, LoadFrames(dir, 500*time.Millisecond, collectFrames(&frames))) || !assert.Len(t, frames, 3) {
+		return
+	}
+
+	// each frame is as wide as its place in the list of names above
+	for idx, width := range []int{3, 2, 1} {
+		assert.Equal(t, width, frames[idx].Image.Bounds().Dx())
+		assert.Equal(t, time.Duration(idx)*500*time.Millisecond, frames[idx].Time)
+	}
+}
+
+func TestFrameHash(t *testing.T) {
+	img, err := LoadImage("../formats/grid.png")
+	if !assert.NoError(t, err) {
+		return
+	}
+	frame := NormaliseImage(img)
+
+	g := GridFromImage(frame, "frame")
+	if !assert.NoError(t, g.SplitCells(ModeComparison)) {
+		return
+	}
+	hash := newFrameHash(frame, g.Bounds)
+
+	// the page around the grid, where an app would show its clock
+	page := filledRGBA(image.Rect(0, 0, 700, 760), color.White)
+	draw.Draw(page, frame.Bounds().Add(image.Pt(35, 100)), frame, image.Point{}, draw.Src)
+	withClock := func(clock color.Color) *image.RGBA {
+		dst := cloneRGBA(page)
+		draw.Draw(dst, image.Rect(300, 20, 400, 60), image.NewUniform(clock), image.Point{}, draw.Src)
+		return dst
+	}
+	onPage := g.Bounds.Add(image.Pt(35, 100))
+	assert.Equal(t, 0, newFrameHash(withClock(color.Black), onPage).distance(newFrameHash(withClock(color.Gray{128}), onPage)))
+
+	t.Run("compressed", func(t *testing.T) {
+		var buf bytes.Buffer
+		if !assert.NoError(t, jpeg.Encode(&buf, frame, &jpeg.Options{Quality: 80})) {
+			return
+		}
+		compressed, err := jpeg.Decode(&buf)
+		if !assert.NoError(t, err) {
+			return
+		}
+
+		assert.Equal(t, 0, hash.distance(newFrameHash(NormaliseImage(compressed), g.Bounds)))
+	})
+
+	// a thin pencil mark, a 1, in each corner of the middle cell
+	for _, corner := range []image.Point{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+		t.Run(fmt.Sprintf("pencil mark at %v", corner), func(t *testing.T) {
+			cell := g.Cells[4][4].image.Bounds().Inset(8)
+			at := image.Pt(cell.Min.X+corner.X*(cell.Dx()-2), cell.Min.Y+corner.Y*(cell.Dy()-10))
+
+			marked := cloneRGBA(frame)
+			draw.Draw(marked, image.Rectangle{at, at.Add(image.Pt(2, 10))}, image.NewUniform(color.Gray{60}), image.Point{}, draw.Src)
+			assert.Greater(t, hash.distance(newFrameHash(marked, g.Bounds)), 0)
+		})
+	}
+}
@@ -0,0 +1,302 @@
+package internal
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// TrainReport is how many instances of each digit were collected, indexed by
+// the digit minus one. 10 to 16 are the values of larger grids.
+type TrainReport struct {
+	Values       [maxSymbol]int
+	Placeholders [maxSymbol]int
+}
+
+type TrainOptions struct {
+	// most instances of a digit compared when picking its templates
+	MaxSamples int
+	// how many templates to write per digit
+	PerDigit int
+	// written into a subdirectory of this name so several sources can share
+	// one template directory, see loadTemplates
+	Source string
+}
+
+// medoid picks the sample with the lowest total distortion against every
+// other sample, unlike an average it's always a real, crisp glyph. Large
+// sample sets are thinned out evenly to maxSamples first as the comparison is
+// quadratic.
+func medoid(samples []*GridImage) *GridImage {
+	best := -1
+	var bestTotal float64
+	for i, a := range samples {
+		var total float64
+		for j, b := range samples {
+			if i != j {
+				total += a.DistortionPercentage(b)
+			}
+		}
+
+		if best == -1 || total < bestTotal {
+			best = i
+			bestTotal = total
+		}
+	}
+
+	return samples[best]
+}
+
+func thin(samples []*GridImage, maxSamples int) []*GridImage {
+	if len(samples) <= maxSamples {
+		return samples
+	}
+
+	thinned := make([]*GridImage, 0, maxSamples)
+	for i := 0; i < maxSamples; i++ {
+		thinned = append(thinned, samples[i*len(samples)/maxSamples])
+	}
+
+	return thinned
+}
+
+// representatives picks up to k templates for a digit: the medoid, then
+// repeatedly the sample least like any already picked, so less common fonts
+// (entered digits, highlighted cells) get a template of their own
+func representatives(samples []*GridImage, k int, maxSamples int) []*GridImage {
+	samples = thin(samples, maxSamples)
+	picked := []*GridImage{medoid(samples)}
+
+	for len(picked) < min(k, len(samples)) {
+		var farthest *GridImage
+		var farthestDistance float64
+
+		for _, s := range samples {
+			if slices.Contains(picked, s) {
+				continue
+			}
+
+			// distance to the closest template already picked
+			closest := -1.0
+			for _, p := range picked {
+				if d := s.DistortionPercentage(p); closest < 0 || d < closest {
+					closest = d
+				}
+			}
+
+			if farthest == nil || closest > farthestDistance {
+				farthest = s
+				farthestDistance = closest
+			}
+		}
+
+		picked = append(picked, farthest)
+	}
+
+	return picked
+}
+
+// collectSamples splits a labelled grid into cells and pre-processes each one,
+// appending every value and placeholder instance to the samples for its digit
+func collectSamples(dir string, values, placeholders *[maxSymbol][]*GridImage) error {
+	truth, err := LoadTruthTable(filepath.Join(dir, "truth.json"))
+	if err != nil {
+		return err
+	}
+
+	img, err := LoadImage(filepath.Join(dir, "grid.png"))
+	if err != nil {
+		return err
+	}
+
+	g := GridFromImage(img, filepath.Base(dir))
+	if err := g.SplitCells(ModeComparison); err != nil {
+		return fmt.Errorf("splitting cells: %v", err)
+	}
+
+	if len(truth) != len(g.Cells) {
+		return fmt.Errorf("truth table is %dx%d, grid read as %s", len(truth), len(truth), g.Shape)
+	}
+
+	for rIdx, row := range g.Cells {
+		for cIdx, cell := range row {
+			t, val, truthPlaceholders, err := ParseLabel(truth[rIdx][cIdx])
+			if err != nil {
+				return fmt.Errorf("%s: %v", cell.Identifier, err)
+			}
+
+			switch t {
+			case CellTypeValue:
+				if err := cell.image.RunPreProcessing(); err != nil {
+					Logger.Debug("skipping value sample", "grid_id", g.Name, "cell_id", cell.Identifier, "error", err)
+					continue
+				}
+
+				if cell.image.wand.GetImageHeight() == 1 || cell.image.wand.GetImageWidth() == 1 {
+					continue
+				}
+
+				values[val-1] = append(values[val-1], cell.image)
+			case CellTypePlaceholders:
+				glyphs, err := cell.placeholderGlyphs()
+				if err != nil {
+					Logger.Debug("skipping placeholder samples", "grid_id", g.Name, "cell_id", cell.Identifier, "error", err)
+					continue
+				}
+
+				// the corpus is NYT style, placeholders sit in the position
+				// matching their digit
+				for _, glyph := range glyphs {
+					if slices.Contains(truthPlaceholders, glyph.slot) {
+						placeholders[glyph.slot-1] = append(placeholders[glyph.slot-1], glyph.image)
+					}
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeTemplates(dir string, samples [maxSymbol][]*GridImage, opts TrainOptions) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("creating directory: %v", err)
+	}
+
+	for idx, digitSamples := range samples {
+		if len(digitSamples) == 0 {
+			continue
+		}
+
+		for variant, template := range representatives(digitSamples, opts.PerDigit, opts.MaxSamples) {
+			b, err := template.Bytes()
+			if err != nil {
+				return err
+			}
+
+			// values over 9 are written out, i.e. 12.png
+			name := fmt.Sprintf("%d.png", idx+1)
+			if variant > 0 {
+				name = fmt.Sprintf("%d-%d.png", idx+1, variant+1)
+			}
+
+			if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+				return fmt.Errorf("writing template: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// collectCorpus gathers the value and placeholder instances of every labelled
+// grid in corpus, indexed by the digit minus one
+func collectCorpus(corpus string) (values, placeholders [maxSymbol][]*GridImage, err error) {
+	entries, err := os.ReadDir(corpus)
+	if err != nil {
+		return values, placeholders, fmt.Errorf("reading corpus directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		if err := collectSamples(filepath.Join(corpus, entry.Name()), &values, &placeholders); err != nil {
+			return values, placeholders, fmt.Errorf("%s: %v", entry.Name(), err)
+		}
+	}
+
+	return values, placeholders, nil
+}
+
+func newTrainReport(values, placeholders [maxSymbol][]*GridImage) *TrainReport {
+	var report TrainReport
+	for idx := range values {
+		report.Values[idx] = len(values[idx])
+		report.Placeholders[idx] = len(placeholders[idx])
+	}
+
+	return &report
+}
+
+// Train builds t-values and t-placeholders templates under out from a corpus
+// of labelled grids (the same layout as grids/), so supporting a new app or
+// theme only needs labelled screenshots. Point TEMPLATES_DIR at out to use
+// them. Digits without any instances in the corpus are not written.
+func Train(corpus string, out string, opts TrainOptions) (*TrainReport, error) {
+	values, placeholders, err := collectCorpus(corpus)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeTemplates(filepath.Join(out, "t-values", opts.Source), values, opts); err != nil {
+		return nil, fmt.Errorf("writing value templates: %v", err)
+	}
+
+	if err := writeTemplates(filepath.Join(out, "t-placeholders", opts.Source), placeholders, opts); err != nil {
+		return nil, fmt.Errorf("writing placeholder templates: %v", err)
+	}
+
+	return newTrainReport(values, placeholders), nil
+}
+
+// classifierSamples thins each digit's instances out to maxSamples and takes
+// their features
+func classifierSamples(templates []*Template, instances [maxSymbol][]*GridImage, maxSamples int) ([]ClassifierSample, error) {
+	samples := make([]ClassifierSample, 0)
+	add := func(digit int, img *GridImage) error {
+		processed, err := img.Processed()
+		if err != nil {
+			return err
+		}
+
+		if processed != nil {
+			samples = append(samples, ClassifierSample{Digit: digit, Features: glyphFeatures(processed)})
+		}
+
+		return nil
+	}
+
+	for _, t := range templates {
+		if err := add(t.Digit, t.image); err != nil {
+			return nil, fmt.Errorf("template %s: %v", t.Name(), err)
+		}
+	}
+
+	for idx, digitInstances := range instances {
+		for _, img := range thin(digitInstances, maxSamples) {
+			if err := add(idx+1, img); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return samples, nil
+}
+
+// TrainClassifier builds a classifier model from a corpus of labelled grids
+// and the templates in use (so a digit the corpus lacks is still known),
+// each digit keeps at most opts.MaxSamples corpus instances
+func TrainClassifier(corpus string, out string, opts TrainOptions) (*TrainReport, error) {
+	values, placeholders, err := collectCorpus(corpus)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Classifier{K: classifierK}
+	if c.Values, err = classifierSamples(loadDigitComparisons(), values, opts.MaxSamples); err != nil {
+		return nil, fmt.Errorf("collecting value samples: %v", err)
+	}
+
+	if c.Placeholders, err = classifierSamples(loadPlaceholderComparisons(), placeholders, opts.MaxSamples); err != nil {
+		return nil, fmt.Errorf("collecting placeholder samples: %v", err)
+	}
+
+	if err := c.Save(out); err != nil {
+		return nil, err
+	}
+
+	return newTrainReport(values, placeholders), nil
+}
@@ -0,0 +1,84 @@
+package internal
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/gographics/imagick.v3/imagick"
+)
+
+// offsetSamples are squares moved by each of offsets (see squareImage), the
+// distortion between two of them grows with how far apart they are
+func offsetSamples(offsets ...int) []*GridImage {
+	samples := make([]*GridImage, len(offsets))
+	for idx, dx := range offsets {
+		samples[idx] = NewGridImage(squareImage(dx), fmt.Sprintf("sample%+d", dx))
+	}
+
+	return samples
+}
+
+func TestThin(t *testing.T) {
+	samples := offsetSamples(0, 1, 2, 3, 4, 5)
+
+	assert.Equal(t, samples, thin(samples, 6))
+	assert.Equal(t, samples, thin(samples, 10))
+	assert.Equal(t, []*GridImage{samples[0], samples[2], samples[4]}, thin(samples, 3))
+}
+
+func TestMedoid(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	samples := offsetSamples(2, -1, 0, -2, 1)
+	assert.Same(t, samples[2], medoid(samples))
+}
+
+func TestRepresentatives(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	samples := offsetSamples(-1, 2, 0, -2, 1)
+
+	// the medoid, then the samples furthest from those already picked
+	picked := representatives(samples, 3, 10)
+	assert.Equal(t, []*GridImage{samples[2], samples[1], samples[3]}, picked)
+
+	// no more than there are samples, each picked once
+	picked = representatives(samples, 8, 10)
+	if assert.Len(t, picked, len(samples)) {
+		assert.ElementsMatch(t, samples, picked)
+	}
+
+	assert.Equal(t, []*GridImage{samples[0]}, representatives(samples[:1], 3, 10))
+}
+
+func TestWriteTemplates(t *testing.T) {
+	imagick.Initialize()
+	defer imagick.Terminate()
+
+	var samples [maxSymbol][]*GridImage
+	for _, digit := range []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 12} {
+		samples[digit-1] = offsetSamples(-2, 0, 2)
+	}
+
+	dir := t.TempDir()
+	if !assert.NoError(t, writeTemplates(dir, samples, TrainOptions{PerDigit: 2, MaxSamples: 10})) {
+		return
+	}
+
+	templates, err := loadTemplates(dir, "digit")
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var names []string
+	for _, tmpl := range templates {
+		names = append(names, tmpl.Name())
+	}
+	assert.Equal(t, []string{"1", "1-2", "12", "12-2", "2", "2-2", "3", "3-2", "4", "4-2", "5", "5-2", "6", "6-2", "7", "7-2", "8", "8-2", "9", "9-2"}, names)
+
+	// the first template of each digit is its medoid
+	assert.Equal(t, 0.0, templates[0].image.DistortionPercentage(samples[0][1]))
+}
@@ -1,18 +1,112 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
 	"log"
+	"os"
 
 	"github.com/joho/godotenv"
 	"github.com/korziee/grid-reader/internal"
+	"gopkg.in/gographics/imagick.v3/imagick"
 )
 
+const usage = `usage: grid-reader <command> [arguments]
+
+commands:
+  read <file...>   read grids and print them in any supported format
+  serve            run the http server
+  timeline <dir>   read the moves made in a recording, screenshots or an animated GIF/APNG
+  diff <a> <b>     compare two screenshots of a puzzle, the moves and highlights since the first
+  debug <file>     write every pre-processing stage, score and the overlay for a grid
+  bench <dir>      measure accuracy over a directory of grid.png/truth.json pairs
+  generate <dir>   write synthetic grid.png/truth.json pairs for testing
+  train <dir>      build t-values/t-placeholders templates from labelled grids
+
+run grid-reader <command> -h for the arguments of each command
+`
+
+// commands are the subcommands by name, each is given the arguments after
+// its name
+var commands = map[string]func(args []string) error{
+	"read":     runRead,
+	"serve":    runServe,
+	"timeline": runTimeline,
+	"diff":     runDiff,
+	"debug":    runDebug,
+	"bench":    runBench,
+	"generate": runGenerate,
+	"train":    runTrain,
+}
+
+// errUsage is returned by a command given the wrong arguments, once its usage
+// has been printed
+var errUsage = errors.New("wrong arguments")
+
+// parseArgs parses the flags of a command, printing its usage when they're
+// wrong or there aren't nargs arguments after them (-1 for at least one)
+func parseArgs(flags *flag.FlagSet, args []string, nargs int) error {
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+
+	if (nargs == -1 && flags.NArg() == 0) || (nargs >= 0 && flags.NArg() != nargs) {
+		flags.Usage()
+		return errUsage
+	}
+
+	return nil
+}
+
+// run runs the command named by the first of args, returning the exit code:
+// 2 when the command or its arguments are wrong and 1 when it fails
+func run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return 2
+	}
+
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(stdout, usage)
+		return 0
+	}
+
+	command, ok := commands[cmd]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", cmd, usage)
+		return 2
+	}
+
+	err := command(args)
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		return 2
+	}
+
+	fmt.Fprintf(stderr, "%s: %v\n", cmd, err)
+	return 1
+}
+
 func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Fatal("error loading .env file")
+	// the .env file is optional, it only sets defaults like DEBUG
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		log.Fatal(fmt.Errorf("loading .env file: %w", err))
 	}
 
 	internal.LoadLogger()
-	server := internal.NewSudokuServer()
-	server.Start()
+	imagick.Initialize()
+	code := run(os.Args[1:], os.Stdout, os.Stderr)
+	imagick.Terminate()
+
+	os.Exit(code)
 }
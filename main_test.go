@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		args []string
+		code int
+		// in stdout for 0, stderr otherwise
+		output string
+	}{
+		{name: "no command", code: 2, output: "usage: grid-reader <command>"},
+		{name: "help", args: []string{"help"}, code: 0, output: "commands:"},
+		{name: "unknown command", args: []string{"scan", "grid.png"}, code: 2, output: `unknown command "scan"`},
+		{name: "command help", args: []string{"read", "-h"}, code: 0},
+		{name: "unknown flag", args: []string{"read", "-colour", "grid.png"}, code: 2},
+		{name: "read without files", args: []string{"read", "-format", "line"}, code: 2},
+		{name: "read unknown format", args: []string{"read", "-format", "xml", "grid.png"}, code: 1, output: `read: unsupported format "xml"`},
+		{name: "read unknown mode", args: []string{"read", "-mode", "guess", "grid.png"}, code: 1, output: "read: "},
+		{name: "read unknown orient", args: []string{"read", "-orient", "left", "grid.png"}, code: 1, output: `read: unsupported orient "left"`},
+		{name: "read missing file", args: []string{"read", "missing.png"}, code: 1, output: "read: missing.png"},
+		{name: "serve with arguments", args: []string{"serve", "8080"}, code: 2},
+		{name: "timeline without a recording", args: []string{"timeline"}, code: 2},
+		{name: "timeline missing recording", args: []string{"timeline", "-mode", "comparison", "missing"}, code: 1, output: "timeline: missing"},
+		{name: "diff of one screenshot", args: []string{"diff", "before.png"}, code: 2},
+		{name: "diff unknown mode", args: []string{"diff", "-mode", "guess", "before.png", "after.png"}, code: 1, output: "diff: "},
+		{name: "debug without a file", args: []string{"debug"}, code: 2},
+		{name: "bench of two corpora", args: []string{"bench", "a", "b"}, code: 2},
+		{name: "generate without a directory", args: []string{"generate", "-n", "3"}, code: 2},
+		{name: "train without a corpus", args: []string{"train", "-k", "2"}, code: 2},
+		{name: "train no templates", args: []string{"train", "-k", "0", "corpus"}, code: 1, output: "train: max-samples and k must be at least 1"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			assert.Equal(t, tc.code, run(tc.args, &stdout, &stderr))
+
+			output := stderr.String()
+			if tc.code == 0 {
+				output = stdout.String()
+			}
+			assert.Contains(t, output, tc.output)
+		})
+	}
+}